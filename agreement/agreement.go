@@ -0,0 +1,119 @@
+// Package agreement renders loan agreements as PDF documents from a text template.
+package agreement
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/models"
+	"sme_fin_backend/money"
+	"sme_fin_backend/pdf"
+)
+
+//go:embed templates/loan_agreement.tmpl
+var templates embed.FS
+
+// DefaultTemplate names the built-in template
+const DefaultTemplate = "loan_agreement.tmpl"
+
+// Data is everything the template can refer to
+type Data struct {
+	AgreementNumber string
+	Date            time.Time
+	Lender          string
+	Borrower        models.PersonalDetails
+	Business        models.BusinessDetails
+	Request         models.FinancingRequest
+	Offer           *models.LoanOffer // nil when the request was approved without an offer
+	Schedule        *models.RepaymentSchedule
+}
+
+// Number derives the agreement number from the financing request ID
+func Number(request *models.FinancingRequest) string {
+	return "SMEFIN-" + strings.ToUpper(strings.ReplaceAll(request.ID.String(), "-", "")[:12])
+}
+
+// LenderName reads AGREEMENT_LENDER_NAME (default "SMEfin")
+func LenderName() string {
+	if name := os.Getenv("AGREEMENT_LENDER_NAME"); name != "" {
+		return name
+	}
+	return "SMEfin"
+}
+
+var funcs = template.FuncMap{
+	"money": func(m money.Money) string { return m.Display() },
+	"rate":  func(bps int) string { return fmt.Sprintf("%d.%02d%%", bps/100, bps%100) },
+	"date":  func(t time.Time) string { return t.Format("2 January 2006") },
+	"method": func(m loan.Method) string {
+		if m == loan.MethodFlat {
+			return "flat rate"
+		}
+		return "reducing balance"
+	},
+}
+
+// loadTemplate returns the template from AGREEMENT_TEMPLATE_FILE, or the built-in one, and its name
+func loadTemplate() (*template.Template, string, error) {
+	if path := os.Getenv("AGREEMENT_TEMPLATE_FILE"); path != "" {
+		t, err := template.New(filepath.Base(path)).Funcs(funcs).ParseFiles(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("loading agreement template: %w", err)
+		}
+		return t, filepath.Base(path), nil
+	}
+	t, err := template.New(DefaultTemplate).Funcs(funcs).ParseFS(templates, "templates/"+DefaultTemplate)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, DefaultTemplate, nil
+}
+
+// Render fills in the template and lays it out as a PDF. It returns the PDF and the template name.
+// Text the PDF fonts cannot show, such as a name in Arabic script, fails with a
+// *pdf.UnsupportedTextError rather than being altered in the contract.
+func Render(data Data) ([]byte, string, error) {
+	t, name, err := loadTemplate()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var text bytes.Buffer
+	if err := t.Execute(&text, data); err != nil {
+		return nil, "", fmt.Errorf("rendering agreement: %w", err)
+	}
+
+	doc := pdf.New("Loan Agreement " + data.AgreementNumber)
+	scanner := bufio.NewScanner(&text)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if err := pdf.CheckText(line); err != nil {
+			return nil, "", fmt.Errorf("rendering agreement: %w", err)
+		}
+		switch {
+		case line == "":
+			doc.Blank()
+		case strings.HasPrefix(line, "## "):
+			doc.Subheading(line[3:])
+		case strings.HasPrefix(line, "# "):
+			doc.Heading(line[2:])
+		case strings.HasPrefix(line, "| "):
+			doc.Preformatted(line[2:])
+		default:
+			doc.Text(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return doc.Bytes(), name, nil
+}
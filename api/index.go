@@ -11,18 +11,33 @@ import (
 	"sync"
 
 	"sme_fin_backend/database"
+	"sme_fin_backend/filescan"
 	"sme_fin_backend/handlers"
 	"sme_fin_backend/middleware"
+	"sme_fin_backend/models"
+	"sme_fin_backend/notify"
+	"sme_fin_backend/scoring"
+	"sme_fin_backend/storage"
 	"sme_fin_backend/utils"
 
 	"github.com/gorilla/mux"
 )
 
 var (
-	router     *mux.Router
-	db         *sql.DB
-	dbOnce     sync.Once
-	routerOnce sync.Once
+	router       *mux.Router
+	db           *sql.DB
+	notifier     notify.Notifier
+	notifierErr  error
+	dbOnce       sync.Once
+	notifierOnce sync.Once
+	scorer       scoring.Scorer
+	scorerErr    error
+	scorerOnce   sync.Once
+	fileStorage  storage.Backend
+	storageOnce  sync.Once
+	scanner      filescan.Scanner
+	scannerOnce  sync.Once
+	routerOnce   sync.Once
 )
 
 func getDB() (*sql.DB, error) {
@@ -56,6 +71,62 @@ func dbOrError(w http.ResponseWriter) *sql.DB {
 	return d
 }
 
+// getNotifier returns the notifier, or nil if none is configured
+func getNotifier() notify.Notifier {
+	notifierOnce.Do(func() {
+		notifier, notifierErr = notify.NewFromEnv()
+		if notifierErr != nil {
+			log.Printf("Failed to configure notifier: %v", notifierErr)
+		}
+	})
+	return notifier
+}
+
+func notifierOrError(w http.ResponseWriter) notify.Notifier {
+	getNotifier()
+	if notifierErr != nil {
+		utils.SendErrorResponse(w, "Notification service is not configured", http.StatusInternalServerError)
+		return nil
+	}
+	return notifier
+}
+
+func scorerOrError(w http.ResponseWriter) scoring.Scorer {
+	scorerOnce.Do(func() {
+		scorer, scorerErr = scoring.NewFromEnv()
+		if scorerErr != nil {
+			log.Printf("Failed to load scoring rules: %v", scorerErr)
+		}
+	})
+	if scorerErr != nil {
+		utils.SendErrorResponse(w, "Credit scoring is not configured", http.StatusInternalServerError)
+		return nil
+	}
+	return scorer
+}
+
+func getStorage() storage.Backend {
+	storageOnce.Do(func() {
+		var err error
+		fileStorage, err = storage.NewFromEnv()
+		if err != nil {
+			log.Printf("Failed to configure file storage: %v", err)
+		}
+	})
+	return fileStorage
+}
+
+func getScanner() filescan.Scanner {
+	scannerOnce.Do(func() {
+		var err error
+		scanner, err = filescan.NewFromEnv()
+		if err != nil {
+			log.Printf("Failed to configure malware scanner, uploads stay in quarantine: %v", err)
+		}
+	})
+	return scanner
+}
+
 func getRouter() *mux.Router {
 	routerOnce.Do(func() {
 		router = mux.NewRouter()
@@ -108,6 +179,9 @@ func getRouter() *mux.Router {
 			})
 		}).Methods("GET")
 
+		// Public token verification keys
+		router.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
+
 		// Public routes
 		api := router.PathPrefix("/api").Subrouter()
 		api.HandleFunc("/auth/send-otp", func(w http.ResponseWriter, r *http.Request) {
@@ -115,7 +189,11 @@ func getRouter() *mux.Router {
 			if d == nil {
 				return
 			}
-			(&handlers.AuthHandler{DB: d}).SendOTP(w, r)
+			n := notifierOrError(w)
+			if n == nil {
+				return
+			}
+			(&handlers.AuthHandler{DB: d, Notifier: n}).SendOTP(w, r)
 		}).Methods("POST")
 		api.HandleFunc("/auth/verify-otp", func(w http.ResponseWriter, r *http.Request) {
 			d := dbOrError(w)
@@ -124,16 +202,69 @@ func getRouter() *mux.Router {
 			}
 			(&handlers.AuthHandler{DB: d}).VerifyOTP(w, r)
 		}).Methods("POST")
+		api.HandleFunc("/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AuthHandler{DB: d}).Refresh(w, r)
+		}).Methods("POST")
+		api.HandleFunc("/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AuthHandler{DB: d}).Logout(w, r)
+		}).Methods("POST")
+		api.HandleFunc("/financing/quote", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d}).Quote(w, r)
+		}).Methods("GET")
+		api.HandleFunc("/financing/products", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d}).ListProducts(w, r)
+		}).Methods("GET")
+		// tus discovery and browser preflight for resumable uploads
+		api.HandleFunc("/user/uploads", handlers.UploadOptions).Methods("OPTIONS")
+		api.HandleFunc("/user/uploads/{id}", handlers.UploadOptions).Methods("OPTIONS")
+		api.HandleFunc("/jobs/daily", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.JobsHandler{DB: d, Storage: getStorage(), Scanner: getScanner(), Notifier: getNotifier()}).Daily(w, r)
+		}).Methods("GET", "POST")
 
 		// Protected routes
 		protected := api.PathPrefix("").Subrouter()
-		protected.Use(middleware.JWTAuthMiddleware)
+		authMiddleware := middleware.JWTAuthMiddleware(getDB)
+		protected.Use(authMiddleware)
+		protected.HandleFunc("/auth/sessions", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AuthHandler{DB: d}).ListSessions(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/auth/sessions", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AuthHandler{DB: d}).RevokeSession(w, r)
+		}).Methods("DELETE")
 		protected.HandleFunc("/user/full-registration", func(w http.ResponseWriter, r *http.Request) {
 			d := dbOrError(w)
 			if d == nil {
 				return
 			}
-			(&handlers.UserHandler{DB: d}).FullRegistration(w, r)
+			(&handlers.UserHandler{DB: d, Storage: getStorage(), Scanner: getScanner()}).FullRegistration(w, r)
 		}).Methods("POST")
 		protected.HandleFunc("/user/status", func(w http.ResponseWriter, r *http.Request) {
 			d := dbOrError(w)
@@ -149,13 +280,119 @@ func getRouter() *mux.Router {
 			}
 			(&handlers.UserHandler{DB: d}).GetUserData(w, r)
 		}).Methods("GET")
+		protected.HandleFunc("/user/personal", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d}).UpdatePersonal(w, r)
+		}).Methods("PUT")
+		protected.HandleFunc("/user/business", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d}).UpdateBusiness(w, r)
+		}).Methods("PUT")
+		protected.HandleFunc("/user/trade-license", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d, Storage: getStorage(), Scanner: getScanner()}).UpdateTradeLicense(w, r)
+		}).Methods("PUT")
+		protected.HandleFunc("/user/documents/{id}/download", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d, Storage: getStorage()}).DownloadDocument(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/documents", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d}).ListDocuments(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/documents", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d, Storage: getStorage(), Scanner: getScanner()}).UploadDocument(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/user/documents/versions", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d}).GetDocumentVersions(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/uploads", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d, Storage: getStorage()}).CreateUpload(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d}).UploadOffset(w, r)
+		}).Methods("HEAD")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d}).GetUpload(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d, Storage: getStorage(), Scanner: getScanner()}).PatchUpload(w, r)
+		}).Methods("PATCH")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.UserHandler{DB: d, Storage: getStorage()}).DeleteUpload(w, r)
+		}).Methods("DELETE")
 		protected.HandleFunc("/financing/request", func(w http.ResponseWriter, r *http.Request) {
 			d := dbOrError(w)
 			if d == nil {
 				return
 			}
-			(&handlers.FinancingHandler{DB: d}).RequestFinancing(w, r)
+			sc := scorerOrError(w)
+			if sc == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d, Scorer: sc}).RequestFinancing(w, r)
 		}).Methods("POST")
+		protected.HandleFunc("/financing/request", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			sc := scorerOrError(w)
+			if sc == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d, Scorer: sc}).UpdateFinancingRequest(w, r)
+		}).Methods("PATCH")
+		protected.HandleFunc("/financing/request", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d}).WithdrawFinancingRequest(w, r)
+		}).Methods("DELETE")
 		protected.HandleFunc("/financing/requests", func(w http.ResponseWriter, r *http.Request) {
 			d := dbOrError(w)
 			if d == nil {
@@ -177,15 +414,187 @@ func getRouter() *mux.Router {
 			}
 			(&handlers.FinancingHandler{DB: d}).GetLatestFinancingRequest(w, r)
 		}).Methods("GET")
+		protected.HandleFunc("/financing/offer/accept", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d, Storage: getStorage()}).AcceptOffer(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/financing/offer/decline", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d}).DeclineOffer(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/financing/agreement", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d, Storage: getStorage()}).GetAgreement(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/financing/agreement/sign", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d}).SignAgreement(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/financing/statement", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.FinancingHandler{DB: d}).GetStatement(w, r)
+		}).Methods("GET")
+
+		// Back-office routes (underwriters and administrators)
+		backOffice := api.PathPrefix("/admin").Subrouter()
+		backOffice.Use(authMiddleware)
+		backOffice.Use(middleware.RequireRoles(models.RoleUnderwriter, models.RoleAdmin))
+		backOffice.HandleFunc("/financing/requests", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).ListFinancingRequests(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/financing/request-detail", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).GetFinancingRequest(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/financing/review", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).ReviewFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/approve", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).ApproveFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/reject", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).RejectFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/disburse", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).DisburseFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/offer", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).IssueOffer(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/repayment", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).RecordRepayment(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/fee", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).ChargeFee(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/ledger", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).GetLoanLedger(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/collections", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).ListCollectionCases(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/collections/case", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).GetCollectionCase(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/collections/note", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).AddCollectionNote(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/collections/assign", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).AssignCollectionCase(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/documents", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).ListDocumentsForReview(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/documents/review", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).ReviewDocument(w, r)
+		}).Methods("POST")
+
+		// Administrator-only routes
+		adminOnly := backOffice.PathPrefix("").Subrouter()
+		adminOnly.Use(middleware.RequireRoles(models.RoleAdmin))
+		adminOnly.HandleFunc("/users/role", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).SetUserRole(w, r)
+		}).Methods("POST")
+		adminOnly.HandleFunc("/financing/write-off", func(w http.ResponseWriter, r *http.Request) {
+			d := dbOrError(w)
+			if d == nil {
+				return
+			}
+			(&handlers.AdminHandler{DB: d}).WriteOffLoan(w, r)
+		}).Methods("POST")
 
 		// CORS middleware
 		corsHandler := func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.Header().Set("Access-Control-Allow-Origin", "*")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+				w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires")
 
-				if r.Method == "OPTIONS" {
+				// Preflight requests are answered here; other OPTIONS requests reach their route
+				if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
 					w.WriteHeader(http.StatusOK)
 					return
 				}
@@ -202,5 +611,11 @@ func getRouter() *mux.Router {
 // Handler is the entry point for Vercel serverless functions
 // This function must be exported for Vercel to detect it
 func Handler(w http.ResponseWriter, r *http.Request) {
+	// Refuse to serve with an insecure or broken token signing setup
+	if err := utils.CheckJWTConfig(); err != nil {
+		log.Printf("Invalid JWT configuration: %v", err)
+		utils.SendErrorResponse(w, "Server is misconfigured", http.StatusInternalServerError)
+		return
+	}
 	getRouter().ServeHTTP(w, r)
 }
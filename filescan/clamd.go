@@ -0,0 +1,104 @@
+package filescan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ClamdScanner streams files to a ClamAV daemon with the INSTREAM command
+type ClamdScanner struct {
+	Network   string // "tcp" or "unix"
+	Address   string
+	Timeout   time.Duration
+	ChunkSize int
+}
+
+// NewClamdScannerFromEnv reads CLAMD_ADDRESS, either host:port, tcp://host:port or
+// unix:///path/to/clamd.sock
+func NewClamdScannerFromEnv() (*ClamdScanner, error) {
+	address := os.Getenv("CLAMD_ADDRESS")
+	if address == "" {
+		return nil, fmt.Errorf("CLAMD_ADDRESS environment variable is required")
+	}
+
+	s := &ClamdScanner{Network: "tcp", Address: address, Timeout: 60 * time.Second, ChunkSize: 64 << 10}
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		s.Network, s.Address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		s.Address = strings.TrimPrefix(address, "tcp://")
+	}
+	return s, nil
+}
+
+// Scan sends r to clamd in length-prefixed chunks and parses the verdict
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("writing to clamd: %w", err)
+	}
+
+	chunkSize := s.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 64 << 10
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return nil, fmt.Errorf("writing to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("reading file: %w", readErr)
+		}
+	}
+	// A zero-length chunk ends the stream
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, fmt.Errorf("writing to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading clamd reply: %w", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply reads replies such as "stream: OK" and "stream: Eicar-Test-Signature FOUND"
+func parseClamdReply(reply string) (*Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -0,0 +1,164 @@
+package filescan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the standard antivirus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd is a stand-in clamd that answers INSTREAM. It reports the EICAR test file as
+// infected, replies with reply when it is set, and records what it received.
+type fakeClamd struct {
+	listener net.Listener
+	reply    string
+	received chan []byte
+}
+
+func startFakeClamd(t *testing.T, reply string) *fakeClamd {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	d := &fakeClamd{listener: listener, reply: reply, received: make(chan []byte, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go d.serve()
+	return d
+}
+
+func (d *fakeClamd) scanner(chunkSize int) *ClamdScanner {
+	return &ClamdScanner{Network: "tcp", Address: d.listener.Addr().String(), Timeout: 5 * time.Second, ChunkSize: chunkSize}
+}
+
+func (d *fakeClamd) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		d.handle(conn)
+	}
+}
+
+func (d *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var data []byte
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		data = append(data, chunk...)
+	}
+	d.received <- data
+
+	reply := "stream: OK"
+	switch {
+	case d.reply != "":
+		reply = d.reply
+	case bytes.Contains(data, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")):
+		reply = "stream: Eicar FOUND"
+	}
+	conn.Write([]byte(reply + "\x00"))
+}
+
+func TestClamdScan(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		chunkSize int
+		infected  bool
+		signature string
+	}{
+		{name: "clean", data: "%PDF-1.7 an ordinary document", chunkSize: 64 << 10},
+		{name: "infected", data: eicar, chunkSize: 64 << 10, infected: true, signature: "Eicar"},
+		{name: "several chunks", data: strings.Repeat("0123456789", 100), chunkSize: 64},
+		{name: "empty", data: "", chunkSize: 64 << 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := startFakeClamd(t, "")
+			result, err := d.scanner(tt.chunkSize).Scan(context.Background(), strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if got := <-d.received; string(got) != tt.data {
+				t.Errorf("clamd received %d bytes, want %d", len(got), len(tt.data))
+			}
+			if result.Infected != tt.infected || result.Signature != tt.signature {
+				t.Errorf("Scan = %+v, want infected %v with signature %q", result, tt.infected, tt.signature)
+			}
+		})
+	}
+}
+
+func TestClamdScanErrorReply(t *testing.T) {
+	d := startFakeClamd(t, "INSTREAM size limit exceeded. ERROR")
+	if _, err := d.scanner(0).Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Fatal("Scan succeeded on an error reply")
+	}
+}
+
+func TestClamdScanUnreachable(t *testing.T) {
+	d := startFakeClamd(t, "")
+	s := d.scanner(0)
+	d.listener.Close()
+	if _, err := s.Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Fatal("Scan succeeded without a daemon")
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		wantErr   bool
+	}{
+		{reply: "stream: OK\x00"},
+		{reply: "stream: OK\n"},
+		{reply: "stream: Eicar-Test-Signature FOUND\x00", infected: true, signature: "Eicar-Test-Signature"},
+		{reply: "stream: Win.Trojan.Agent-1 FOUND", infected: true, signature: "Win.Trojan.Agent-1"},
+		{reply: "INSTREAM size limit exceeded. ERROR\x00", wantErr: true},
+		{reply: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		result, err := parseClamdReply(tt.reply)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseClamdReply(%q) = %+v, want an error", tt.reply, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseClamdReply(%q): %v", tt.reply, err)
+			continue
+		}
+		if result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("parseClamdReply(%q) = %+v, want infected %v with signature %q", tt.reply, result, tt.infected, tt.signature)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package filescan checks uploaded documents before they are stored: the content has to be
+// what the filename claims, structurally sound, and free of malware.
+package filescan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for image.DecodeConfig
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// maxImageSide bounds image dimensions, so a small file cannot claim a huge bitmap
+const maxImageSide = 20000
+
+var (
+	ErrUnsupportedType = errors.New("file content is not a PDF, JPG or PNG")
+	ErrTypeMismatch    = errors.New("file content does not match its extension")
+	ErrMalformed       = errors.New("file is damaged or malformed")
+)
+
+// contentTypes maps the accepted file extensions to the content type they must contain
+var contentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+}
+
+// SniffLen is the number of leading bytes CheckType looks at
+const SniffLen = 512
+
+// pdfTailLen is how far from the end of a PDF the end-of-file marker is looked for
+const pdfTailLen = 2048
+
+// Detect returns the content type of data from its leading bytes
+func Detect(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// CheckType checks that head, the first SniffLen bytes of a file, is a PDF, PNG or JPEG
+// matching the extension of filename, and returns its content type. It lets a stream be
+// rejected before the rest of it is read.
+func CheckType(head []byte, filename string) (string, error) {
+	contentType := Detect(head)
+	expected, ok := contentTypes[strings.ToLower(filepath.Ext(filename))]
+	if !ok || !isAccepted(contentType) {
+		return "", ErrUnsupportedType
+	}
+	if contentType != expected {
+		return "", ErrTypeMismatch
+	}
+	return contentType, nil
+}
+
+// Validate checks that data is a well-formed PDF, PNG or JPEG matching the extension of
+// filename, and returns its content type
+func Validate(data []byte, filename string) (string, error) {
+	return ValidateReader(bytes.NewReader(data), filename)
+}
+
+// ValidateReader is Validate for a stream. It holds only the leading and trailing bytes the
+// checks need, and reads r to the end unless the file is rejected.
+func ValidateReader(r io.Reader, filename string) (string, error) {
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+
+	contentType, err := CheckType(head, filename)
+	if err != nil {
+		return "", err
+	}
+	switch contentType {
+	case "application/pdf":
+		err = validatePDF(head, io.MultiReader(bytes.NewReader(head), r))
+	default:
+		err = validateImage(io.MultiReader(bytes.NewReader(head), r))
+		if err == nil {
+			_, err = io.Copy(io.Discard, r)
+		}
+	}
+	return contentType, err
+}
+
+func isAccepted(contentType string) bool {
+	for _, accepted := range contentTypes {
+		if contentType == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePDF checks the header and that the file ends with a cross-reference pointer and
+// an end-of-file marker, which truncated or disguised files lack. r is the whole file.
+func validatePDF(head []byte, r io.Reader) error {
+	if !bytes.HasPrefix(head, []byte("%PDF-1.")) && !bytes.HasPrefix(head, []byte("%PDF-2.")) {
+		return fmt.Errorf("%w: unknown PDF version", ErrMalformed)
+	}
+
+	var tail []byte
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(buf)
+		tail = append(tail, buf[:n]...)
+		if len(tail) > pdfTailLen {
+			tail = append(tail[:0], tail[len(tail)-pdfTailLen:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return fmt.Errorf("%w: PDF has no end-of-file marker", ErrMalformed)
+	}
+	if !bytes.Contains(tail, []byte("startxref")) {
+		return fmt.Errorf("%w: PDF has no cross-reference table", ErrMalformed)
+	}
+	return nil
+}
+
+// validateImage decodes the image header
+func validateImage(r io.Reader) error {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxImageSide || config.Height > maxImageSide {
+		return fmt.Errorf("%w: image is %dx%d pixels", ErrMalformed, config.Width, config.Height)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package filescan
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const minimalPDF = "%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\nxref\n0 1\n0000000000 65535 f \ntrailer\n<< /Root 1 0 R >>\nstartxref\n9\n%%EOF\n"
+
+func encodePNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// oversizedJPEG is a valid JPEG whose frame header claims 30000x30000 pixels
+func oversizedJPEG(t *testing.T) []byte {
+	t.Helper()
+	data := encodeJPEG(t)
+	sof := bytes.Index(data, []byte{0xFF, 0xC0})
+	if sof < 0 {
+		t.Fatal("encoded JPEG has no SOF0 marker")
+	}
+	// marker, length, precision, then height and width
+	copy(data[sof+5:], []byte{0x75, 0x30, 0x75, 0x30})
+	return data
+}
+
+func TestCheckType(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		filename string
+		want     string
+		wantErr  error
+	}{
+		{name: "pdf", head: []byte(minimalPDF), filename: "license.pdf", want: "application/pdf"},
+		{name: "upper case extension", head: []byte(minimalPDF), filename: "LICENSE.PDF", want: "application/pdf"},
+		{name: "png", head: encodePNG(t), filename: "passport.png", want: "image/png"},
+		{name: "jpeg as jpg", head: encodeJPEG(t), filename: "passport.jpg", want: "image/jpeg"},
+		{name: "renamed windows executable", head: append([]byte("MZ\x90\x00\x03"), make([]byte, 64)...), filename: "statement.pdf", wantErr: ErrUnsupportedType},
+		{name: "renamed elf executable", head: append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 64)...), filename: "statement.png", wantErr: ErrUnsupportedType},
+		{name: "html", head: []byte("<html><body>hi</body></html>"), filename: "statement.pdf", wantErr: ErrUnsupportedType},
+		{name: "unaccepted extension", head: []byte(minimalPDF), filename: "statement.exe", wantErr: ErrUnsupportedType},
+		{name: "png named pdf", head: encodePNG(t), filename: "statement.pdf", wantErr: ErrTypeMismatch},
+		{name: "pdf named jpg", head: []byte(minimalPDF), filename: "passport.jpg", wantErr: ErrTypeMismatch},
+		{name: "empty", head: nil, filename: "statement.pdf", wantErr: ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckType(tt.head, tt.filename)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckType error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CheckType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReader(t *testing.T) {
+	// A PDF larger than the sniffed head and the tail buffer, so the tail is found by streaming
+	largePDF := "%PDF-1.7\n" + strings.Repeat("% padding line\n", 5000) + "startxref\n9\n%%EOF\n"
+
+	tests := []struct {
+		name     string
+		data     []byte
+		filename string
+		want     string
+		wantErr  error
+	}{
+		{name: "pdf", data: []byte(minimalPDF), filename: "license.pdf", want: "application/pdf"},
+		{name: "large pdf", data: []byte(largePDF), filename: "license.pdf", want: "application/pdf"},
+		{name: "truncated pdf", data: []byte(minimalPDF[:len(minimalPDF)/2]), filename: "license.pdf", wantErr: ErrMalformed},
+		{name: "pdf without startxref", data: []byte("%PDF-1.4\n1 0 obj\nendobj\n%%EOF\n"), filename: "license.pdf", wantErr: ErrMalformed},
+		{name: "unknown pdf version", data: []byte("%PDF-9.0\nstartxref\n9\n%%EOF\n"), filename: "license.pdf", wantErr: ErrMalformed},
+		{name: "png", data: encodePNG(t), filename: "passport.png", want: "image/png"},
+		{name: "jpeg", data: encodeJPEG(t), filename: "passport.jpeg", want: "image/jpeg"},
+		{name: "jpeg with oversized header", data: oversizedJPEG(t), filename: "passport.jpg", wantErr: ErrMalformed},
+		{name: "truncated png", data: encodePNG(t)[:12], filename: "passport.png", wantErr: ErrMalformed},
+		{name: "renamed executable", data: append([]byte("MZ\x90\x00\x03"), make([]byte, 1024)...), filename: "statement.pdf", wantErr: ErrUnsupportedType},
+		{name: "png named jpg", data: encodePNG(t), filename: "passport.jpg", wantErr: ErrTypeMismatch},
+		{name: "empty", data: nil, filename: "statement.pdf", wantErr: ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateReader(bytes.NewReader(tt.data), tt.filename)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateReader error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != tt.want {
+				t.Errorf("ValidateReader = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
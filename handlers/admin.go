@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// AdminHandler serves back-office endpoints for underwriters and administrators
+type AdminHandler struct {
+	DB *sql.DB
+}
+
+type SetUserRoleRequest struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+func (h *AdminHandler) getUserIDFromRequest(r *http.Request) (uuid.UUID, error) {
+	userIDStr := r.Header.Get("X-User-ID")
+	if userIDStr == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(userIDStr)
+}
+
+// SetUserRole assigns a role to a user (admin only). The user's sessions are revoked
+// so the new role applies immediately instead of when the current tokens expire.
+func (h *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminID, err := h.getUserIDFromRequest(r)
+	if err != nil || adminID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SetUserRoleRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.UserID = r.FormValue("user_id")
+		req.Role = r.FormValue("role")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate inputs
+	if req.UserID == "" {
+		utils.SendErrorResponse(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if !models.ValidRole(req.Role) {
+		utils.SendErrorResponse(w, "Invalid role. Must be one of: sme, underwriter, admin", http.StatusBadRequest)
+		return
+	}
+	if userID == adminID && req.Role != models.RoleAdmin {
+		utils.SendErrorResponse(w, "Administrators cannot remove their own admin role", http.StatusBadRequest)
+		return
+	}
+
+	user, err := models.GetUserByID(h.DB, userID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		utils.SendErrorResponse(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if user.Role != req.Role {
+		// Revokes the user's sessions too, so the old role's tokens stop working
+		if _, err := user.UpdateRole(h.DB, req.Role); err != nil {
+			log.Printf("Failed to update role of %s: %v", user.ID, err)
+			utils.SendErrorResponse(w, "Failed to update role", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	utils.SendSuccessResponse(w, "User role updated successfully", user, http.StatusOK)
+}
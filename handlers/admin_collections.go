@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/money"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// CollectionNoteRequest is a note on a collection case, optionally recording a promise to pay
+type CollectionNoteRequest struct {
+	Note           string `json:"note"`
+	PromisedDate   string `json:"promised_date"`   // YYYY-MM-DD
+	PromisedAmount string `json:"promised_amount"` // in the loan currency
+}
+
+type AssignCollectionCaseRequest struct {
+	AssignedTo string `json:"assigned_to"` // user ID; empty assigns the caller, "none" unassigns
+}
+
+// CollectionCaseDetail shows a case with its log and the loan it is about
+type CollectionCaseDetail struct {
+	Case           *models.CollectionCase    `json:"case"`
+	Notes          []models.CollectionNote   `json:"notes"`
+	Request        *models.FinancingRequest  `json:"request"`
+	ApplicantEmail string                    `json:"applicant_email"`
+	Schedule       *models.RepaymentSchedule `json:"schedule,omitempty"`
+}
+
+// ListCollectionCases lists the collections queue, most days past due first.
+// Filters: status (open, promise_to_pay or resolved; defaults to the cases still being worked),
+// assigned_to (user ID, "me" or "none"), limit, offset.
+func (h *AdminHandler) ListCollectionCases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.CollectionCaseFilter{
+		Status: query.Get("status"),
+		Limit:  50,
+	}
+
+	switch filter.Status {
+	case "", models.CollectionStatusOpen, models.CollectionStatusPromiseToPay, models.CollectionStatusResolved:
+	default:
+		utils.SendErrorResponse(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	switch value := query.Get("assigned_to"); value {
+	case "":
+	case "none":
+		filter.Unassigned = true
+	case "me":
+		userID, err := h.getUserIDFromRequest(r)
+		if err != nil || userID == uuid.Nil {
+			utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		filter.AssignedTo = &userID
+	default:
+		userID, err := uuid.Parse(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid assigned_to", http.StatusBadRequest)
+			return
+		}
+		filter.AssignedTo = &userID
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > 200 {
+			utils.SendErrorResponse(w, "Invalid limit. Must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			utils.SendErrorResponse(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	cases, err := models.ListCollectionCases(h.DB, filter)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Collection cases retrieved successfully", cases, http.StatusOK)
+}
+
+// GetCollectionCase returns a case with its notes, the loan and its repayment schedule
+func (h *AdminHandler) GetCollectionCase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c := h.loadCollectionCase(w, r)
+	if c == nil {
+		return
+	}
+
+	notes, err := models.GetCollectionNotes(h.DB, c.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	request, err := models.GetFinancingRequestByID(h.DB, c.FinancingRequestID)
+	if err != nil || request == nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	applicant, err := models.GetUserByID(h.DB, request.UserID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	schedule, err := models.GetRepaymentSchedule(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	detail := CollectionCaseDetail{
+		Case:     c,
+		Notes:    notes,
+		Request:  request,
+		Schedule: schedule,
+	}
+	if applicant != nil {
+		detail.ApplicantEmail = applicant.Email
+	}
+
+	utils.SendSuccessResponse(w, "Collection case retrieved successfully", detail, http.StatusOK)
+}
+
+// AddCollectionNote logs a note on a case. A promised_date, today or later, records a promise
+// to pay and moves the case to promise_to_pay; the daily job reopens it if the date passes
+// with installments still overdue.
+func (h *AdminHandler) AddCollectionNote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, err := h.getUserIDFromRequest(r)
+	if err != nil || actorID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CollectionNoteRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Note = r.FormValue("note")
+		req.PromisedDate = r.FormValue("promised_date")
+		req.PromisedAmount = r.FormValue("promised_amount")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Note == "" {
+		utils.SendErrorResponse(w, "Note is required", http.StatusBadRequest)
+		return
+	}
+	if req.PromisedAmount != "" && req.PromisedDate == "" {
+		utils.SendErrorResponse(w, "promised_date is required with promised_amount", http.StatusBadRequest)
+		return
+	}
+
+	c := h.loadCollectionCase(w, r)
+	if c == nil {
+		return
+	}
+
+	note := &models.CollectionNote{AuthorID: &actorID, Note: req.Note}
+	if req.PromisedDate != "" {
+		promisedDate, err := time.Parse("2006-01-02", req.PromisedDate)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid promised_date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if promisedDate.Format("2006-01-02") < time.Now().UTC().Format("2006-01-02") {
+			utils.SendErrorResponse(w, "promised_date cannot be in the past", http.StatusBadRequest)
+			return
+		}
+		note.PromisedDate = promisedDate.Format("2006-01-02")
+	}
+	if req.PromisedAmount != "" {
+		amount, err := money.Parse(req.PromisedAmount, c.Currency)
+		if err != nil || amount.Minor <= 0 {
+			utils.SendErrorResponse(w, "Invalid promised_amount. Must be a positive amount in the loan currency", http.StatusBadRequest)
+			return
+		}
+		note.PromisedAmount = &amount
+	}
+
+	updated, err := models.AddCollectionNote(h.DB, c.ID, note)
+	if err != nil {
+		sendCollectionError(w, err)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Note added successfully", map[string]interface{}{
+		"case": updated,
+		"note": note,
+	}, http.StatusCreated)
+}
+
+// AssignCollectionCase assigns a case to a back-office user (the caller by default)
+func (h *AdminHandler) AssignCollectionCase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, err := h.getUserIDFromRequest(r)
+	if err != nil || actorID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req AssignCollectionCaseRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.AssignedTo = r.FormValue("assigned_to")
+	} else if r.ContentLength != 0 {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var assignee *uuid.UUID
+	switch value := strings.TrimSpace(req.AssignedTo); value {
+	case "":
+		assignee = &actorID
+	case "none":
+	default:
+		userID, err := uuid.Parse(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid assigned_to", http.StatusBadRequest)
+			return
+		}
+		user, err := models.GetUserByID(h.DB, userID)
+		if err != nil {
+			utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if user == nil || (user.Role != models.RoleUnderwriter && user.Role != models.RoleAdmin) {
+			utils.SendErrorResponse(w, "Cases can only be assigned to underwriters and administrators", http.StatusBadRequest)
+			return
+		}
+		assignee = &userID
+	}
+
+	c := h.loadCollectionCase(w, r)
+	if c == nil {
+		return
+	}
+
+	updated, err := models.AssignCollectionCase(h.DB, c.ID, assignee)
+	if err != nil {
+		sendCollectionError(w, err)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Collection case assigned successfully", updated, http.StatusOK)
+}
+
+// sendCollectionError maps a resolved case to 409 and anything else to 500
+func sendCollectionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrCollectionCaseResolved) {
+		utils.SendErrorResponse(w, "Collection case is resolved", http.StatusConflict)
+		return
+	}
+	utils.SendErrorResponse(w, "Failed to update collection case", http.StatusInternalServerError)
+}
+
+// loadCollectionCase reads the "id" query parameter and loads the case,
+// writing the error response itself when that fails
+func (h *AdminHandler) loadCollectionCase(w http.ResponseWriter, r *http.Request) *models.CollectionCase {
+	caseIDStr := r.URL.Query().Get("id")
+	if caseIDStr == "" {
+		utils.SendErrorResponse(w, "Case ID is required", http.StatusBadRequest)
+		return nil
+	}
+
+	caseID, err := uuid.Parse(caseIDStr)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid case ID", http.StatusBadRequest)
+		return nil
+	}
+
+	c, err := models.GetCollectionCaseByID(h.DB, caseID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+	if c == nil {
+		utils.SendErrorResponse(w, "Collection case not found", http.StatusNotFound)
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// ReviewDocumentRequest is a review decision on a document version
+type ReviewDocumentRequest struct {
+	Status    string `json:"status"`     // approved or rejected
+	Note      string `json:"note"`       // required when rejecting; shown to the applicant
+	ExpiresOn string `json:"expires_on"` // YYYY-MM-DD; sets or corrects the expiry date
+}
+
+// ListDocumentsForReview lists the documents awaiting review, trade licenses included, oldest
+// first. Documents still in quarantine are left out until they are scanned. Filters: limit,
+// offset.
+func (h *AdminHandler) ListDocumentsForReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, offset := 50, 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > 200 {
+			utils.SendErrorResponse(w, "Invalid limit. Must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		var err error
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			utils.SendErrorResponse(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	documents, err := models.GetBusinessDocumentsForReview(h.DB, limit, offset)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Documents retrieved successfully", documents, http.StatusOK)
+}
+
+// ReviewDocument approves or rejects a document version (?id=). A rejected document no longer
+// counts toward the applicant's checklist and has to be uploaded again; a rejected trade
+// license also reopens the registration step.
+func (h *AdminHandler) ReviewDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reviewerID, err := h.getUserIDFromRequest(r)
+	if err != nil || reviewerID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	documentID, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReviewDocumentRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Status = r.FormValue("status")
+		req.Note = r.FormValue("note")
+		req.ExpiresOn = r.FormValue("expires_on")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	req.Note = strings.TrimSpace(req.Note)
+	switch req.Status {
+	case models.ReviewStatusApproved:
+	case models.ReviewStatusRejected:
+		if req.Note == "" {
+			utils.SendErrorResponse(w, "A note is required when rejecting a document", http.StatusBadRequest)
+			return
+		}
+	default:
+		utils.SendErrorResponse(w, "Invalid status. Must be approved or rejected", http.StatusBadRequest)
+		return
+	}
+	expiresOn, message := parseDocumentExpiry(req.ExpiresOn)
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+
+	document, err := models.GetBusinessDocument(h.DB, documentID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if document == nil {
+		utils.SendErrorResponse(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	switch document.ScanStatus {
+	case models.ScanStatusPending:
+		utils.SendErrorResponse(w, "Document is awaiting a malware scan", http.StatusConflict)
+		return
+	case models.ScanStatusInfected:
+		utils.SendErrorResponse(w, "Document failed the malware scan and was removed", http.StatusGone)
+		return
+	}
+
+	document, err = models.ReviewBusinessDocument(h.DB, documentID, req.Status, req.Note, expiresOn, reviewerID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if document == nil {
+		utils.SendErrorResponse(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Document reviewed successfully", document, http.StatusOK)
+}
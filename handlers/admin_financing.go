@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/money"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+type FinancingDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdminFinancingRequestDetail shows a request next to the applicant's registration data
+type AdminFinancingRequestDetail struct {
+	Request        *models.FinancingRequest       `json:"request"`
+	ApplicantEmail string                         `json:"applicant_email"`
+	Registration   *models.RegistrationSummary    `json:"registration"`
+	History        []models.FinancingRequestEvent `json:"history"`
+	Offers         []LoanOfferDetail              `json:"offers"`
+	Schedule       *models.RepaymentSchedule      `json:"schedule,omitempty"`
+	Score          *models.FinancingRequestScore  `json:"score"` // null if the request was never scored
+	Agreement      *models.LoanAgreement          `json:"agreement,omitempty"`
+}
+
+// ListFinancingRequests lists financing requests across all users.
+// Filters: status, product_id, risk_band, currency, min_amount, max_amount, from, to (YYYY-MM-DD, inclusive), limit, offset.
+func (h *AdminHandler) ListFinancingRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.FinancingRequestFilter{
+		Status:   query.Get("status"),
+		RiskBand: query.Get("risk_band"),
+		Limit:    50,
+	}
+
+	if value := query.Get("product_id"); value != "" {
+		productID, err := uuid.Parse(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+		filter.ProductID = &productID
+	}
+
+	// Amount filters are expressed in the filter currency
+	filter.Currency = strings.ToUpper(query.Get("currency"))
+	if (query.Get("min_amount") != "" || query.Get("max_amount") != "") && filter.Currency == "" {
+		filter.Currency = money.DefaultCurrency()
+	}
+	if filter.Currency != "" {
+		if _, ok := money.LookupCurrency(filter.Currency); !ok {
+			utils.SendErrorResponse(w, "Unsupported currency", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, param := range []struct {
+		name   string
+		target **int64
+	}{{"min_amount", &filter.MinAmount}, {"max_amount", &filter.MaxAmount}} {
+		if value := query.Get(param.name); value != "" {
+			amount, err := money.Parse(value, filter.Currency)
+			if err != nil || amount.Minor < 0 {
+				utils.SendErrorResponse(w, "Invalid "+param.name+". Must be a non-negative amount", http.StatusBadRequest)
+				return
+			}
+			*param.target = &amount.Minor
+		}
+	}
+
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid from date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid to date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		// The end date is inclusive
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > 200 {
+			utils.SendErrorResponse(w, "Invalid limit. Must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			utils.SendErrorResponse(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	requests, err := models.ListFinancingRequests(h.DB, filter)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Financing requests retrieved successfully", requests, http.StatusOK)
+}
+
+// GetFinancingRequest returns a financing request together with the applicant's registration summary
+func (h *AdminHandler) GetFinancingRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := h.loadFinancingRequest(w, r)
+	if request == nil {
+		return
+	}
+
+	applicant, err := models.GetUserByID(h.DB, request.UserID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	summary, err := models.GetRegistrationSummary(h.DB, request.UserID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := models.GetFinancingRequestEvents(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	schedule, err := models.GetRepaymentSchedule(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	score, err := models.GetLatestFinancingRequestScore(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	offers, err := models.GetLoanOffersByRequestID(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	loanAgreement, err := models.GetLoanAgreementByRequestID(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	detail := AdminFinancingRequestDetail{
+		Request:      request,
+		Registration: summary,
+		History:      history,
+		Offers:       offerDetails(offers),
+		Schedule:     schedule,
+		Score:        score,
+		Agreement:    loanAgreement,
+	}
+	if applicant != nil {
+		detail.ApplicantEmail = applicant.Email
+	}
+
+	utils.SendSuccessResponse(w, "Financing request retrieved successfully", detail, http.StatusOK)
+}
+
+// ReviewFinancingRequest starts the review of a pending request. The reason is optional.
+func (h *AdminHandler) ReviewFinancingRequest(w http.ResponseWriter, r *http.Request) {
+	h.transitionFinancingRequest(w, r, models.FinancingStatusUnderReview, false, "Financing request moved to review")
+}
+
+// ApproveFinancingRequest approves a request under review and fixes its repayment schedule
+func (h *AdminHandler) ApproveFinancingRequest(w http.ResponseWriter, r *http.Request) {
+	h.transitionFinancingRequest(w, r, models.FinancingStatusApproved, true, "Financing request approved")
+}
+
+// RejectFinancingRequest rejects a pending request or one under review
+func (h *AdminHandler) RejectFinancingRequest(w http.ResponseWriter, r *http.Request) {
+	h.transitionFinancingRequest(w, r, models.FinancingStatusRejected, true, "Financing request rejected")
+}
+
+// DisburseFinancingRequest marks an approved request as disbursed and posts the disbursement to
+// the ledger. The borrower must have signed the loan agreement.
+func (h *AdminHandler) DisburseFinancingRequest(w http.ResponseWriter, r *http.Request) {
+	h.transitionFinancingRequest(w, r, models.FinancingStatusDisbursed, true, "Financing request disbursed")
+}
+
+func (h *AdminHandler) transitionFinancingRequest(w http.ResponseWriter, r *http.Request, status string, reasonRequired bool, message string) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, err := h.getUserIDFromRequest(r)
+	if err != nil || actorID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req FinancingDecisionRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Reason = r.FormValue("reason")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if reasonRequired && req.Reason == "" {
+		utils.SendErrorResponse(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	request := h.loadFinancingRequest(w, r)
+	if request == nil {
+		return
+	}
+
+	if status == models.FinancingStatusDisbursed {
+		loanAgreement, err := models.GetLoanAgreementByRequestID(h.DB, request.ID)
+		if err != nil {
+			utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if loanAgreement == nil || !loanAgreement.IsSigned() {
+			utils.SendErrorResponse(w, "The loan agreement has not been signed", http.StatusConflict)
+			return
+		}
+	}
+
+	if status == models.FinancingStatusApproved {
+		// Approval fixes the repayment schedule at the product's current pricing
+		var product *models.FinancingProduct
+		if request.ProductID != nil {
+			if product, err = models.GetFinancingProductByID(h.DB, *request.ProductID); err != nil {
+				utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+		}
+		pricing, pricingErr := financingPricing(product)
+		if pricingErr != nil {
+			log.Printf("Invalid financing pricing configuration: %v", pricingErr)
+			utils.SendErrorResponse(w, "Financing pricing is misconfigured", http.StatusInternalServerError)
+			return
+		}
+		request, err = models.ApproveFinancingRequest(h.DB, request.ID, &actorID, req.Reason, pricing)
+	} else if status == models.FinancingStatusDisbursed {
+		request, err = models.DisburseFinancingRequest(h.DB, request.ID, &actorID, req.Reason)
+	} else {
+		request, err = models.TransitionFinancingRequest(h.DB, request.ID, status, &actorID, req.Reason)
+	}
+	if err != nil {
+		sendTransitionError(w, err)
+		return
+	}
+	if request == nil {
+		utils.SendErrorResponse(w, "Financing request not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendSuccessResponse(w, message, request, http.StatusOK)
+}
+
+// sendTransitionError maps state machine errors to 409 and anything else to 500
+func sendTransitionError(w http.ResponseWriter, err error) {
+	var transitionErr *models.InvalidTransitionError
+	if errors.As(err, &transitionErr) {
+		utils.SendErrorResponse(w, fmt.Sprintf("Financing request cannot move from %s to %s", transitionErr.From, transitionErr.To), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, models.ErrNoRepaymentSchedule) {
+		utils.SendErrorResponse(w, "Financing request has no repayment schedule", http.StatusConflict)
+		return
+	}
+	log.Printf("Failed to update financing request: %v", err)
+	utils.SendErrorResponse(w, "Failed to update financing request", http.StatusInternalServerError)
+}
+
+// loadFinancingRequest reads the "id" query parameter and loads the request,
+// writing the error response itself when that fails
+func (h *AdminHandler) loadFinancingRequest(w http.ResponseWriter, r *http.Request) *models.FinancingRequest {
+	requestIDStr := r.URL.Query().Get("id")
+	if requestIDStr == "" {
+		utils.SendErrorResponse(w, "Request ID is required", http.StatusBadRequest)
+		return nil
+	}
+
+	requestID, err := uuid.Parse(requestIDStr)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid request ID", http.StatusBadRequest)
+		return nil
+	}
+
+	request, err := models.GetFinancingRequestByID(h.DB, requestID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+	if request == nil {
+		utils.SendErrorResponse(w, "Financing request not found", http.StatusNotFound)
+		return nil
+	}
+
+	return request
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/money"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// LedgerPostingRequest holds the fields of the back-office ledger actions.
+// Each action uses the subset it needs.
+type LedgerPostingRequest struct {
+	Amount      string `json:"amount"`
+	ReceivedOn  string `json:"received_on"` // YYYY-MM-DD, repayments only
+	Reference   string `json:"reference"`
+	Description string `json:"description"`
+	Reason      string `json:"reason"`
+}
+
+// AdminLoanLedger is the statement of a disbursed loan together with its raw journal entries
+type AdminLoanLedger struct {
+	Statement *models.LoanStatement `json:"statement"`
+	Entries   []models.JournalEntry `json:"entries"`
+}
+
+// parseLedgerPostingRequest parses form-data or JSON, writing the error response itself on failure
+func parseLedgerPostingRequest(w http.ResponseWriter, r *http.Request) (*LedgerPostingRequest, bool) {
+	var req LedgerPostingRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return nil, false
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return nil, false
+			}
+		}
+		req.Amount = r.FormValue("amount")
+		req.ReceivedOn = r.FormValue("received_on")
+		req.Reference = r.FormValue("reference")
+		req.Description = r.FormValue("description")
+		req.Reason = r.FormValue("reason")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	req.Reference = strings.TrimSpace(req.Reference)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Reason = strings.TrimSpace(req.Reason)
+	return &req, true
+}
+
+// parseLedgerAmount parses a positive amount in the loan currency. Unlike validateAmount it
+// does not apply the financing limits, since repayments and fees are usually small.
+func parseLedgerAmount(value, currencyCode string) (money.Money, string) {
+	if value == "" {
+		return money.Money{}, "Amount is required"
+	}
+	currency, ok := money.LookupCurrency(currencyCode)
+	if !ok {
+		return money.Money{}, "Unsupported currency"
+	}
+	amount, err := money.Parse(value, currency.Code)
+	if err != nil || amount.Minor <= 0 {
+		return money.Money{}, fmt.Sprintf("Invalid amount. Must be a positive number with at most %d decimal places", currency.Exponent)
+	}
+	return amount, ""
+}
+
+// sendLedgerError maps ledger errors to 409 and anything else to 500
+func sendLedgerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrLoanNotDisbursed):
+		utils.SendErrorResponse(w, "Financing request has not been disbursed", http.StatusConflict)
+	case errors.Is(err, models.ErrRepaymentExceedsBalance):
+		utils.SendErrorResponse(w, "Repayment exceeds the outstanding balance", http.StatusConflict)
+	case errors.Is(err, models.ErrNothingOutstanding):
+		utils.SendErrorResponse(w, "Nothing is outstanding on this loan", http.StatusConflict)
+	case errors.Is(err, models.ErrCurrencyMismatch):
+		utils.SendErrorResponse(w, "Amount is not in the loan currency", http.StatusBadRequest)
+	default:
+		log.Printf("Failed to post to the ledger: %v", err)
+		utils.SendErrorResponse(w, "Failed to post to the ledger", http.StatusInternalServerError)
+	}
+}
+
+// RecordRepayment posts a repayment received from the borrower of a disbursed request.
+// received_on defaults to today and cannot be in the future.
+func (h *AdminHandler) RecordRepayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, err := h.getUserIDFromRequest(r)
+	if err != nil || actorID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	req, ok := parseLedgerPostingRequest(w, r)
+	if !ok {
+		return
+	}
+
+	request := h.loadFinancingRequest(w, r)
+	if request == nil {
+		return
+	}
+
+	amount, message := parseLedgerAmount(req.Amount, request.Currency)
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+
+	receivedOn := time.Now().UTC()
+	if req.ReceivedOn != "" {
+		receivedOn, err = time.Parse("2006-01-02", req.ReceivedOn)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid received_on. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if receivedOn.After(time.Now().UTC()) {
+			utils.SendErrorResponse(w, "received_on cannot be in the future", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entry, err := models.RecordRepayment(h.DB, request.ID, amount, receivedOn, req.Reference, &actorID)
+	if err != nil {
+		sendLedgerError(w, err)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Repayment recorded successfully", entry, http.StatusCreated)
+}
+
+// ChargeFee charges a fee to the borrower of a disbursed request. The description is required.
+func (h *AdminHandler) ChargeFee(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, err := h.getUserIDFromRequest(r)
+	if err != nil || actorID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	req, ok := parseLedgerPostingRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Description == "" {
+		utils.SendErrorResponse(w, "Description is required", http.StatusBadRequest)
+		return
+	}
+
+	request := h.loadFinancingRequest(w, r)
+	if request == nil {
+		return
+	}
+
+	amount, message := parseLedgerAmount(req.Amount, request.Currency)
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+
+	entry, err := models.ChargeFee(h.DB, request.ID, amount, req.Description, &actorID)
+	if err != nil {
+		sendLedgerError(w, err)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Fee charged successfully", entry, http.StatusCreated)
+}
+
+// WriteOffLoan writes off the outstanding balance of a disbursed request. The reason is required.
+func (h *AdminHandler) WriteOffLoan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, err := h.getUserIDFromRequest(r)
+	if err != nil || actorID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	req, ok := parseLedgerPostingRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Reason == "" {
+		utils.SendErrorResponse(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	request := h.loadFinancingRequest(w, r)
+	if request == nil {
+		return
+	}
+
+	entry, err := models.WriteOffLoan(h.DB, request.ID, req.Reason, &actorID)
+	if err != nil {
+		sendLedgerError(w, err)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Loan written off successfully", entry, http.StatusCreated)
+}
+
+// GetLoanLedger returns the statement and journal entries of a disbursed request
+func (h *AdminHandler) GetLoanLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := h.loadFinancingRequest(w, r)
+	if request == nil {
+		return
+	}
+
+	statement, ok := loanStatement(w, h.DB, request)
+	if !ok {
+		return
+	}
+
+	entries, err := models.GetJournalEntries(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Loan ledger retrieved successfully", AdminLoanLedger{Statement: statement, Entries: entries}, http.StatusOK)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// LoanOfferRequest holds the terms of an offer. Omitted terms default to the requested amount
+// and period and to the product's pricing.
+type LoanOfferRequest struct {
+	Amount          string `json:"amount"`
+	RepaymentPeriod string `json:"repayment_period"`
+	AnnualRate      string `json:"annual_rate"`    // percent
+	Method          string `json:"method"`         // flat or reducing_balance
+	ProcessingFee   string `json:"processing_fee"` // percent
+	ExpiresInDays   string `json:"expires_in_days"`
+	Note            string `json:"note"`
+}
+
+// IssueOffer issues an offer on a request under review, replacing any open offer.
+// Offers expire after expires_in_days, or OFFER_VALIDITY_DAYS (default 7).
+func (h *AdminHandler) IssueOffer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actorID, err := h.getUserIDFromRequest(r)
+	if err != nil || actorID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req LoanOfferRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Amount = r.FormValue("amount")
+		req.RepaymentPeriod = r.FormValue("repayment_period")
+		req.AnnualRate = r.FormValue("annual_rate")
+		req.Method = r.FormValue("method")
+		req.ProcessingFee = r.FormValue("processing_fee")
+		req.ExpiresInDays = r.FormValue("expires_in_days")
+		req.Note = r.FormValue("note")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	request := h.loadFinancingRequest(w, r)
+	if request == nil {
+		return
+	}
+	if request.Status != models.FinancingStatusUnderReview {
+		utils.SendErrorResponse(w, "Offers can only be issued on requests under review", http.StatusConflict)
+		return
+	}
+
+	offer := &models.LoanOffer{
+		FinancingRequestID: request.ID,
+		Amount:             request.Amount,
+		RepaymentPeriod:    request.RepaymentPeriod,
+		Note:               strings.TrimSpace(req.Note),
+		IssuedBy:           actorID,
+	}
+
+	if req.Amount != "" {
+		amount, message := validateAmount(req.Amount, request.Currency)
+		if message != "" {
+			utils.SendErrorResponse(w, message, http.StatusBadRequest)
+			return
+		}
+		offer.Amount = amount
+	}
+	if req.RepaymentPeriod != "" {
+		months, message := validateRepaymentPeriod(req.RepaymentPeriod)
+		if message != "" {
+			utils.SendErrorResponse(w, message, http.StatusBadRequest)
+			return
+		}
+		offer.RepaymentPeriod = months
+	}
+
+	var product *models.FinancingProduct
+	if request.ProductID != nil {
+		if product, err = models.GetFinancingProductByID(h.DB, *request.ProductID); err != nil {
+			utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if offer.Pricing, err = financingPricing(product); err != nil {
+		log.Printf("Invalid financing pricing configuration: %v", err)
+		utils.SendErrorResponse(w, "Financing pricing is misconfigured", http.StatusInternalServerError)
+		return
+	}
+	if req.AnnualRate != "" {
+		if offer.Pricing.AnnualRateBps, err = loan.ParseRate(req.AnnualRate); err != nil {
+			utils.SendErrorResponse(w, "Invalid annual_rate. The "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ProcessingFee != "" {
+		if offer.Pricing.ProcessingFeeBps, err = loan.ParseRate(req.ProcessingFee); err != nil {
+			utils.SendErrorResponse(w, "Invalid processing_fee. The "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Method != "" {
+		method, ok := loan.ParseMethod(req.Method)
+		if !ok {
+			utils.SendErrorResponse(w, "Invalid method. Must be flat or reducing_balance", http.StatusBadRequest)
+			return
+		}
+		offer.Pricing.Method = method
+	}
+
+	validityDays := utils.GetEnvInt("OFFER_VALIDITY_DAYS", 7)
+	if req.ExpiresInDays != "" {
+		days, err := strconv.Atoi(req.ExpiresInDays)
+		if err != nil || days <= 0 || days > 90 {
+			utils.SendErrorResponse(w, "Invalid expires_in_days. Must be between 1 and 90", http.StatusBadRequest)
+			return
+		}
+		validityDays = days
+	}
+	offer.ExpiresAt = time.Now().Add(time.Duration(validityDays) * 24 * time.Hour)
+
+	if err := offer.Issue(h.DB); err != nil {
+		sendOfferError(w, err)
+		return
+	}
+
+	utils.SendSuccessResponse(w, fmt.Sprintf("Offer issued, valid for %d days", validityDays), offerDetails([]models.LoanOffer{*offer})[0], http.StatusCreated)
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sme_fin_backend/agreement"
+	"sme_fin_backend/models"
+	"sme_fin_backend/pdf"
+	"sme_fin_backend/storage"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+type SignAgreementRequest struct {
+	Accept bool   `json:"accept"`
+	SHA256 string `json:"sha256"` // fingerprint of the document the borrower reviewed
+}
+
+// ensureAgreement returns the loan agreement of an approved request, generating and storing
+// the PDF the first time it is needed
+func (h *FinancingHandler) ensureAgreement(ctx context.Context, request *models.FinancingRequest) (*models.LoanAgreement, error) {
+	existing, err := models.GetLoanAgreementByRequestID(h.DB, request.ID)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	schedule, err := models.GetRepaymentSchedule(h.DB, request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		return nil, errors.New("approved request has no repayment schedule")
+	}
+
+	personal, err := models.GetPersonalDetails(h.DB, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+	business, err := models.GetBusinessDetails(h.DB, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if personal == nil || business == nil {
+		return nil, errors.New("borrower registration is incomplete")
+	}
+
+	offer, err := models.GetAcceptedLoanOffer(h.DB, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	number := agreement.Number(request)
+	document, template, err := agreement.Render(agreement.Data{
+		AgreementNumber: number,
+		Date:            time.Now(),
+		Lender:          agreement.LenderName(),
+		Borrower:        *personal,
+		Business:        *business,
+		Request:         *request,
+		Offer:           offer,
+		Schedule:        schedule,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Storage == nil {
+		return nil, fmt.Errorf("file storage is not configured")
+	}
+	filename := number + ".pdf"
+	objectKey := storage.NewObjectKey(filename)
+	if err := h.Storage.Put(ctx, objectKey, bytes.NewReader(document), int64(len(document)), "application/pdf"); err != nil {
+		return nil, fmt.Errorf("uploading agreement: %w", err)
+	}
+
+	sum := sha256.Sum256(document)
+	loanAgreement := &models.LoanAgreement{
+		FinancingRequestID: request.ID,
+		AgreementNumber:    number,
+		Template:           template,
+		Filename:           filename,
+		ObjectKey:          objectKey,
+		SizeBytes:          int64(len(document)),
+		SHA256:             hex.EncodeToString(sum[:]),
+	}
+	if offer != nil {
+		loanAgreement.OfferID = &offer.ID
+	}
+	if err := loanAgreement.Create(h.DB); err != nil {
+		return nil, err
+	}
+	return loanAgreement, nil
+}
+
+// GetAgreement returns the loan agreement of the caller's approved request, generating it on first access
+func (h *FinancingHandler) GetAgreement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := h.loadOwnedFinancingRequest(w, r, userID)
+	if request == nil {
+		return
+	}
+
+	var loanAgreement *models.LoanAgreement
+	switch request.Status {
+	case models.FinancingStatusApproved:
+		loanAgreement, err = h.ensureAgreement(r.Context(), request)
+	case models.FinancingStatusDisbursed:
+		loanAgreement, err = models.GetLoanAgreementByRequestID(h.DB, request.ID)
+	default:
+		utils.SendErrorResponse(w, "The loan agreement is available once the request is approved", http.StatusConflict)
+		return
+	}
+	var unsupported *pdf.UnsupportedTextError
+	if errors.As(err, &unsupported) {
+		log.Printf("Cannot generate loan agreement for %s: %v", request.ID, err)
+		utils.SendErrorResponse(w, fmt.Sprintf("The loan agreement cannot show the character %q in your registration details. Please contact support", unsupported.Char),
+			http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to prepare loan agreement for %s: %v", request.ID, err)
+		utils.SendErrorResponse(w, "Failed to prepare loan agreement", http.StatusInternalServerError)
+		return
+	}
+	if loanAgreement == nil {
+		utils.SendErrorResponse(w, "Loan agreement not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Loan agreement retrieved successfully", loanAgreement, http.StatusOK)
+}
+
+// SignAgreement records the borrower's click-to-sign acceptance of the agreement of their
+// approved request. The caller sends back the SHA-256 of the document they reviewed, so the
+// signature is tied to that exact document. Time, IP address and user agent are recorded.
+func (h *FinancingHandler) SignAgreement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SignAgreementRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Accept = r.FormValue("accept") == "true"
+		req.SHA256 = r.FormValue("sha256")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !req.Accept {
+		utils.SendErrorResponse(w, "The agreement must be accepted to sign it", http.StatusBadRequest)
+		return
+	}
+	if req.SHA256 == "" {
+		utils.SendErrorResponse(w, "Document SHA-256 is required", http.StatusBadRequest)
+		return
+	}
+
+	request := h.loadOwnedFinancingRequest(w, r, userID)
+	if request == nil {
+		return
+	}
+	if request.Status != models.FinancingStatusApproved {
+		utils.SendErrorResponse(w, "Only agreements of approved requests can be signed", http.StatusConflict)
+		return
+	}
+
+	loanAgreement, err := models.GetLoanAgreementByRequestID(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if loanAgreement == nil {
+		utils.SendErrorResponse(w, "Loan agreement not found. Retrieve it before signing", http.StatusNotFound)
+		return
+	}
+	if !strings.EqualFold(req.SHA256, loanAgreement.SHA256) {
+		utils.SendErrorResponse(w, "The document fingerprint does not match the current agreement", http.StatusConflict)
+		return
+	}
+
+	if err := loanAgreement.Sign(h.DB, userID, utils.ClientIP(r), r.UserAgent()); err != nil {
+		if errors.Is(err, models.ErrAgreementAlreadySigned) {
+			utils.SendErrorResponse(w, "The loan agreement is already signed", http.StatusConflict)
+			return
+		}
+		utils.SendErrorResponse(w, "Failed to sign loan agreement", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Loan agreement signed successfully", loanAgreement, http.StatusOK)
+}
@@ -1,18 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"sme_fin_backend/models"
+	"sme_fin_backend/notify"
 	"sme_fin_backend/utils"
 )
 
 type AuthHandler struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Notifier notify.Notifier
 }
 
 type SendOTPRequest struct {
@@ -20,17 +26,40 @@ type SendOTPRequest struct {
 }
 
 type VerifyOTPRequest struct {
-	Email string `json:"email"`
-	OTP   string `json:"otp"`
+	Email      string `json:"email"`
+	OTP        string `json:"otp"`
+	DeviceName string `json:"device_name"`
 }
 
 type VerifyOTPResponse struct {
 	Token         string `json:"token"`
+	RefreshToken  string `json:"refresh_token"`
+	ExpiresIn     int    `json:"expires_in"` // access token lifetime in seconds
+	SessionID     string `json:"session_id"`
 	UserID        string `json:"user_id"`
 	Email         string `json:"email"`
 	AccountStatus string `json:"account_status"`
 }
 
+// otpLimits is the OTP throttling policy, configurable through the environment
+type otpLimits struct {
+	MaxAttemptsPerEmail int
+	MaxAttemptsPerIP    int
+	AttemptWindow       time.Duration
+	ResendCooldown      time.Duration
+	DailyLimit          int
+}
+
+func otpLimitsFromEnv() otpLimits {
+	return otpLimits{
+		MaxAttemptsPerEmail: utils.GetEnvInt("OTP_MAX_ATTEMPTS", 5),
+		MaxAttemptsPerIP:    utils.GetEnvInt("OTP_MAX_ATTEMPTS_PER_IP", 20),
+		AttemptWindow:       time.Duration(utils.GetEnvInt("OTP_ATTEMPT_WINDOW_MINUTES", 15)) * time.Minute,
+		ResendCooldown:      time.Duration(utils.GetEnvInt("OTP_RESEND_COOLDOWN_SECONDS", 60)) * time.Second,
+		DailyLimit:          utils.GetEnvInt("OTP_DAILY_LIMIT", 10),
+	}
+}
+
 func (h *AuthHandler) SendOTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -74,10 +103,9 @@ func (h *AuthHandler) SendOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get default OTP from environment
-	defaultOTP := os.Getenv("DEFAULT_OTP")
-	if defaultOTP == "" {
-		defaultOTP = "123456"
+	if h.Notifier == nil {
+		utils.SendErrorResponse(w, "OTP delivery is not configured", http.StatusInternalServerError)
+		return
 	}
 
 	// Create or get user
@@ -95,24 +123,72 @@ func (h *AuthHandler) SendOTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Create OTP verification record
+	// Create OTP verification record. A random code is generated unless a fixed
+	// DEFAULT_OTP is configured, which is only honoured in dev mode.
 	otpVerification := &models.OTPVerification{
 		Email: req.Email,
-		OTP:   defaultOTP,
+	}
+	if utils.IsDevMode() {
+		otpVerification.OTP = os.Getenv("DEFAULT_OTP")
 	}
 
-	if err := otpVerification.Create(h.DB); err != nil {
+	// Enforce the resend cooldown and the daily cap
+	limits := otpLimitsFromEnv()
+	now := time.Now()
+	var limited string
+	var wait time.Duration
+	created, err := otpVerification.CreateIfAllowed(h.DB, now.Add(-24*time.Hour), func(stats *models.OTPSendStats) bool {
+		if stats.Count > 0 {
+			if wait = stats.Latest.Add(limits.ResendCooldown).Sub(now); wait > 0 {
+				limited = "Please wait before requesting another OTP"
+				return false
+			}
+		}
+		if stats.Count >= limits.DailyLimit {
+			limited, wait = "Daily OTP limit reached. Please try again later", stats.Oldest.Add(24*time.Hour).Sub(now)
+			return false
+		}
+		return true
+	})
+	if err != nil {
 		utils.SendErrorResponse(w, "Failed to create OTP verification", http.StatusInternalServerError)
 		return
 	}
+	if !created {
+		utils.SendTooManyRequestsResponse(w, limited, wait)
+		return
+	}
 
-	// In production, send OTP via email/SMS
-	// For now, we'll just return success
+	// Deliver the code
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+	if err := h.Notifier.Send(ctx, otpEmail(req.Email, otpVerification)); err != nil {
+		log.Printf("Failed to deliver OTP to %s: %v", req.Email, err)
+		utils.SendErrorResponse(w, "Failed to send OTP", http.StatusInternalServerError)
+		return
+	}
 
-	utils.SendSuccessResponse(w, "OTP sent successfully", map[string]string{
+	response := map[string]string{
 		"email":   req.Email,
-		"message": "OTP sent to email (use default OTP: " + defaultOTP + " for testing)",
-	}, http.StatusOK)
+		"message": "OTP sent to email",
+	}
+	// The code is only echoed back in dev mode
+	if utils.IsDevMode() {
+		response["otp"] = otpVerification.OTP
+	}
+
+	utils.SendSuccessResponse(w, "OTP sent successfully", response, http.StatusOK)
+}
+
+// otpEmail builds the notification carrying a freshly generated OTP
+func otpEmail(email string, otp *models.OTPVerification) notify.Message {
+	minutes := int(time.Until(otp.ExpiresAt).Round(time.Minute).Minutes())
+	return notify.Message{
+		To:      email,
+		Subject: "Your SMEfin verification code",
+		Body: fmt.Sprintf("Your SMEfin verification code is %s.\n\nIt expires in %d minutes. If you did not request this code, you can ignore this email.",
+			otp.OTP, minutes),
+	}
 }
 
 func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
@@ -133,6 +209,7 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 			}
 			req.Email = r.FormValue("email")
 			req.OTP = r.FormValue("otp")
+			req.DeviceName = r.FormValue("device_name")
 		} else {
 			if err := r.ParseForm(); err != nil {
 				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
@@ -140,6 +217,7 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 			}
 			req.Email = r.FormValue("email")
 			req.OTP = r.FormValue("otp")
+			req.DeviceName = r.FormValue("device_name")
 		}
 	} else {
 		// JSON fallback
@@ -165,6 +243,27 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject callers that already used up their attempts. The attempt is counted as a failure
+	// before the code is checked, so parallel guesses cannot get past the limits.
+	limits := otpLimitsFromEnv()
+	ip := utils.ClientIP(r)
+	now := time.Now()
+
+	check, err := models.ReserveOTPAttempt(h.DB, req.Email, ip, now.Add(-limits.AttemptWindow),
+		limits.MaxAttemptsPerEmail, limits.MaxAttemptsPerIP)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if check.Attempt == nil {
+		if check.IPFailures == nil {
+			utils.SendTooManyRequestsResponse(w, "Too many failed attempts. Please request a new OTP later", check.EmailFailures.Oldest.Add(limits.AttemptWindow).Sub(now))
+			return
+		}
+		utils.SendTooManyRequestsResponse(w, "Too many failed attempts. Please try again later", check.IPFailures.Oldest.Add(limits.AttemptWindow).Sub(now))
+		return
+	}
+
 	// Verify OTP
 	otpVerification, err := models.VerifyOTP(h.DB, req.Email, req.OTP)
 	if err != nil {
@@ -173,9 +272,20 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if otpVerification == nil {
+		// Too many failures burn every outstanding code for this email
+		if check.EmailFailures.Count+1 >= limits.MaxAttemptsPerEmail {
+			if err := models.InvalidateOTPs(h.DB, req.Email); err != nil {
+				log.Printf("Failed to invalidate OTPs for %s: %v", req.Email, err)
+			}
+			utils.SendTooManyRequestsResponse(w, "Too many failed attempts. Please request a new OTP later", limits.AttemptWindow)
+			return
+		}
 		utils.SendErrorResponse(w, "Invalid or expired OTP", http.StatusUnauthorized)
 		return
 	}
+	if err := models.MarkOTPAttemptSucceeded(h.DB, check.Attempt.ID); err != nil {
+		log.Printf("Failed to record OTP attempt for %s: %v", req.Email, err)
+	}
 
 	// Get user
 	user, err := models.GetUserByEmail(h.DB, req.Email)
@@ -189,9 +299,10 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID, user.Email)
+	// Start a session for this device and issue its token pair
+	tokens, err := h.startSession(r, user, req.DeviceName)
 	if err != nil {
+		log.Printf("Failed to start session for %s: %v", user.Email, err)
 		utils.SendErrorResponse(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
@@ -204,7 +315,10 @@ func (h *AuthHandler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := VerifyOTPResponse{
-		Token:         token,
+		Token:         tokens.Token,
+		RefreshToken:  tokens.RefreshToken,
+		ExpiresIn:     tokens.ExpiresIn,
+		SessionID:     tokens.SessionID,
 		UserID:        user.ID.String(),
 		Email:         user.Email,
 		AccountStatus: accountStatus.Status,
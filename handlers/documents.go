@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/storage"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// documentURLTTL is how long signed download URLs stay valid
+func documentURLTTL() time.Duration {
+	return time.Duration(utils.GetEnvInt("DOCUMENT_URL_TTL_SECONDS", 300)) * time.Second
+}
+
+// DownloadDocument gives the owner of a document, or back-office staff, access to it. By default
+// it returns a short-lived signed URL; with ?stream=true, or when the storage backend cannot
+// sign URLs, the file itself is streamed. Uploads are only released once scanned clean.
+func (h *UserHandler) DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	documentID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	document, err := models.GetDocumentByID(h.DB, documentID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if document == nil {
+		utils.SendErrorResponse(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	role := r.Header.Get("X-User-Role")
+	if document.OwnerID != userID && role != models.RoleUnderwriter && role != models.RoleAdmin {
+		utils.SendErrorResponse(w, "Unauthorized to access this document", http.StatusForbidden)
+		return
+	}
+
+	switch document.ScanStatus {
+	case models.ScanStatusPending:
+		utils.SendErrorResponse(w, "Document is awaiting a malware scan", http.StatusConflict)
+		return
+	case models.ScanStatusInfected:
+		utils.SendErrorResponse(w, "Document failed the malware scan and was removed", http.StatusGone)
+		return
+	}
+
+	// Documents registered by URL live elsewhere
+	if document.ObjectKey == "" {
+		utils.SendSuccessResponse(w, "Document URL retrieved successfully", map[string]interface{}{
+			"url":      document.FileURL,
+			"filename": document.Filename,
+		}, http.StatusOK)
+		return
+	}
+
+	if h.Storage == nil {
+		utils.SendErrorResponse(w, "File storage is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	stream, _ := strconv.ParseBool(r.URL.Query().Get("stream"))
+	if !stream {
+		ttl := documentURLTTL()
+		url, err := h.Storage.SignedURL(r.Context(), document.ObjectKey, ttl)
+		if err == nil {
+			utils.SendSuccessResponse(w, "Download URL created successfully", map[string]interface{}{
+				"url":        url,
+				"filename":   document.Filename,
+				"expires_at": time.Now().Add(ttl),
+			}, http.StatusOK)
+			return
+		}
+		if !errors.Is(err, storage.ErrSignedURLUnsupported) {
+			log.Printf("Failed to sign download URL for document %s: %v", document.ID, err)
+			utils.SendErrorResponse(w, "Failed to create download URL", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	body, info, err := h.Storage.Get(r.Context(), document.ObjectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		utils.SendErrorResponse(w, "Document file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read document %s: %v", document.ID, err)
+		utils.SendErrorResponse(w, "Failed to read document", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", document.Filename))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Failed to stream document %s: %v", document.ID, err)
+	}
+}
+
+// parseDocumentExpiry parses an optional expiry date (YYYY-MM-DD). It returns the error message
+// if the date is invalid or already passed.
+func parseDocumentExpiry(value string) (*time.Time, string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, ""
+	}
+	expiresOn, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, "Invalid expires_on. Use YYYY-MM-DD"
+	}
+	if value < time.Now().UTC().Format("2006-01-02") {
+		return nil, "The document has already expired"
+	}
+	return &expiresOn, ""
+}
+
+// saveVaultDocument stores an uploaded file as the next version of a vault document. A file
+// that could not be scanned on upload stays in quarantine until the daily job rescans it.
+func (h *UserHandler) saveVaultDocument(userID uuid.UUID, documentType string, expiresOn *time.Time, upload *storedUpload) (*models.BusinessDocument, error) {
+	document := &models.BusinessDocument{
+		UserID:       userID,
+		DocumentType: documentType,
+		Filename:     upload.Filename,
+		ObjectKey:    upload.Key,
+		FileSize:     upload.Size,
+		SHA256:       upload.SHA256,
+		ScanStatus:   upload.scanStatus(),
+		ExpiresOn:    expiresOn,
+	}
+	if err := models.CreateBusinessDocument(h.DB, document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// UploadDocument adds a document to the caller's vault from a multipart form with document_type,
+// file and, for documents that expire, expires_on (YYYY-MM-DD). Every upload of a type is a
+// new version that awaits back-office review; earlier versions are kept.
+func (h *UserHandler) UploadDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		utils.SendErrorResponse(w, "Documents must be uploaded as multipart/form-data", http.StatusBadRequest)
+		return
+	}
+	upload, ok := h.parseUploadForm(w, r, "file")
+	if !ok {
+		return
+	}
+	if upload == nil {
+		utils.SendErrorResponse(w, "File is required", http.StatusBadRequest)
+		return
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			h.deleteUpload(upload.Key)
+		}
+	}()
+
+	documentType := getFormValue(r, "document_type")
+	if !models.ValidVaultDocumentType(documentType) {
+		utils.SendErrorResponse(w, "Invalid document_type. Must be one of "+strings.Join(models.VaultDocumentTypes, ", "), http.StatusBadRequest)
+		return
+	}
+	expiresOn, message := parseDocumentExpiry(getFormValue(r, "expires_on"))
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+
+	document, err := h.saveVaultDocument(userID, documentType, expiresOn, upload)
+	if err != nil {
+		log.Printf("Failed to save %s document for %s: %v", documentType, userID, err)
+		utils.SendErrorResponse(w, "Failed to save document", http.StatusInternalServerError)
+		return
+	}
+	saved = true
+
+	utils.SendSuccessResponse(w, "Document uploaded successfully", document, http.StatusCreated)
+}
+
+// ListDocuments returns the caller's document checklist and the current version of each vault
+// document. With ?product_id= the checklist includes the documents the product requires.
+func (h *UserHandler) ListDocuments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requirements := models.AccountRequiredDocuments
+	if value := r.URL.Query().Get("product_id"); value != "" {
+		productID, err := uuid.Parse(value)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+		product, err := models.GetFinancingProductByID(h.DB, productID)
+		if err != nil {
+			utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if product == nil {
+			utils.SendErrorResponse(w, "Financing product not found", http.StatusNotFound)
+			return
+		}
+		seen := map[string]bool{}
+		for _, requirement := range requirements {
+			seen[requirement] = true
+		}
+		requirements = append([]string{}, requirements...)
+		for _, requirement := range product.RequiredDocuments {
+			if !seen[requirement] {
+				requirements = append(requirements, requirement)
+			}
+		}
+	}
+
+	checklist, err := models.GetDocumentChecklist(h.DB, userID, requirements, time.Now())
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	documents, err := models.GetCurrentBusinessDocuments(h.DB, userID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Documents retrieved successfully", map[string]interface{}{
+		"checklist": checklist,
+		"documents": documents,
+	}, http.StatusOK)
+}
+
+// GetDocumentVersions returns every version of one of the caller's documents (?type=), trade
+// licenses included, newest first
+func (h *UserHandler) GetDocumentVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	documentType := r.URL.Query().Get("type")
+	if !models.ValidDocumentType(documentType) {
+		types := append([]string{models.DocumentTypeTradeLicense}, models.VaultDocumentTypes...)
+		utils.SendErrorResponse(w, "Invalid type. Must be one of "+strings.Join(types, ", "), http.StatusBadRequest)
+		return
+	}
+
+	versions, err := models.GetBusinessDocumentVersions(h.DB, userID, documentType)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Document versions retrieved successfully", versions, http.StatusOK)
+}
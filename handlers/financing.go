@@ -3,22 +3,44 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"sme_fin_backend/loan"
 	"sme_fin_backend/models"
+	"sme_fin_backend/money"
+	"sme_fin_backend/scoring"
+	"sme_fin_backend/storage"
 	"sme_fin_backend/utils"
 
 	"github.com/google/uuid"
 )
 
 type FinancingHandler struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Scorer  scoring.Scorer  // nil disables scoring of new and edited requests
+	Storage storage.Backend // needed to generate loan agreements
+}
+
+// FinancingRequestDetail is a financing request together with its status history, its offers
+// and, once approved, its repayment schedule and loan agreement
+type FinancingRequestDetail struct {
+	*models.FinancingRequest
+	History   []models.FinancingRequestEvent `json:"history"`
+	Offers    []LoanOfferDetail              `json:"offers"`
+	Schedule  *models.RepaymentSchedule      `json:"schedule,omitempty"`
+	Agreement *models.LoanAgreement          `json:"agreement,omitempty"`
 }
 
 type FinancingRequestRequest struct {
+	ProductID       string `json:"product_id"`
 	Amount          string `json:"amount"`
+	Currency        string `json:"currency"`
 	Purpose         string `json:"purpose"`
 	RepaymentPeriod string `json:"repayment_period"`
 }
@@ -31,6 +53,195 @@ func (h *FinancingHandler) getUserIDFromRequest(r *http.Request) (uuid.UUID, err
 	return uuid.Parse(userIDStr)
 }
 
+// financingTerms are the validated, editable fields of a financing request
+type financingTerms struct {
+	Product         *models.FinancingProduct
+	Amount          money.Money
+	Purpose         string
+	RepaymentPeriod int
+}
+
+// parseFinancingRequestRequest reads the request fields from form-data or JSON,
+// writing the error response itself when parsing fails
+func parseFinancingRequestRequest(w http.ResponseWriter, r *http.Request) (*FinancingRequestRequest, bool) {
+	var req FinancingRequestRequest
+
+	// Parse form-data or JSON
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return nil, false
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return nil, false
+			}
+		}
+		req.ProductID = r.FormValue("product_id")
+		req.Amount = r.FormValue("amount")
+		req.Currency = r.FormValue("currency")
+		req.Purpose = r.FormValue("purpose")
+		req.RepaymentPeriod = r.FormValue("repayment_period")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	return &req, true
+}
+
+// validateFinancingRequest applies the rules shared by creating and editing a request,
+// including the product's amount and tenor limits. It returns a user-facing message when
+// the input is invalid.
+func validateFinancingRequest(req *FinancingRequestRequest, product *models.FinancingProduct) (*financingTerms, string) {
+	if req.Currency == "" {
+		req.Currency = product.Currency
+	}
+	amount, message := validateAmount(req.Amount, req.Currency)
+	if message != "" {
+		return nil, message
+	}
+
+	if req.Purpose == "" {
+		return nil, "Purpose is required"
+	}
+
+	if req.RepaymentPeriod == "" {
+		return nil, "Repayment period is required"
+	}
+	repaymentPeriod, message := validateRepaymentPeriod(req.RepaymentPeriod)
+	if message != "" {
+		return nil, message
+	}
+
+	if reasons := product.CheckTerms(amount, repaymentPeriod); len(reasons) > 0 {
+		return nil, notEligibleMessage(product, reasons)
+	}
+
+	return &financingTerms{
+		Product:         product,
+		Amount:          amount,
+		Purpose:         req.Purpose,
+		RepaymentPeriod: repaymentPeriod,
+	}, ""
+}
+
+// validateAmount parses an amount in the given currency and checks the currency's limits
+func validateAmount(value, currencyCode string) (money.Money, string) {
+	if value == "" {
+		return money.Money{}, "Amount is required"
+	}
+	currency, ok := money.LookupCurrency(currencyCode)
+	if !ok {
+		return money.Money{}, "Unsupported currency"
+	}
+	amount, err := money.Parse(value, currency.Code)
+	if err != nil || amount.Minor <= 0 {
+		return money.Money{}, fmt.Sprintf("Invalid amount. Must be a positive number with at most %d decimal places", currency.Exponent)
+	}
+	if err := amount.CheckLimits(); err != nil {
+		return money.Money{}, "Invalid amount. The " + err.Error()
+	}
+	return amount, ""
+}
+
+// validateRepaymentPeriod parses a repayment period in months
+func validateRepaymentPeriod(value string) (int, string) {
+	repaymentPeriod, err := strconv.Atoi(value)
+	if err != nil || repaymentPeriod <= 0 || repaymentPeriod > loan.MaxMonths {
+		return 0, fmt.Sprintf("Invalid repayment period. Must be between 1 and %d months", loan.MaxMonths)
+	}
+	return repaymentPeriod, ""
+}
+
+func notEligibleMessage(product *models.FinancingProduct, reasons []string) string {
+	return fmt.Sprintf("Not eligible for %s: %s", product.Name, strings.Join(reasons, "; "))
+}
+
+// loadFinancingProduct loads an active product by ID, writing the error response itself when that fails
+func (h *FinancingHandler) loadFinancingProduct(w http.ResponseWriter, productIDStr string) *models.FinancingProduct {
+	if productIDStr == "" {
+		utils.SendErrorResponse(w, "Product is required", http.StatusBadRequest)
+		return nil
+	}
+
+	productID, err := uuid.Parse(productIDStr)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return nil
+	}
+
+	product, err := models.GetFinancingProductByID(h.DB, productID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+	if product == nil || !product.Active {
+		utils.SendErrorResponse(w, "Financing product not found", http.StatusBadRequest)
+		return nil
+	}
+
+	return product
+}
+
+// checkEligibility applies the product's applicant rules, writing the error response itself
+// when the caller is not eligible
+func (h *FinancingHandler) checkEligibility(w http.ResponseWriter, userID uuid.UUID, product *models.FinancingProduct) bool {
+	profile, err := models.GetEligibilityProfile(h.DB, userID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+
+	if reasons := product.CheckEligibility(profile, time.Now()); len(reasons) > 0 {
+		utils.SendErrorResponse(w, notEligibleMessage(product, reasons), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// loadOwnedFinancingRequest reads the "id" query parameter and loads the request, making sure
+// it belongs to the caller. It writes the error response itself when that fails.
+func (h *FinancingHandler) loadOwnedFinancingRequest(w http.ResponseWriter, r *http.Request, userID uuid.UUID) *models.FinancingRequest {
+	requestIDStr := r.URL.Query().Get("id")
+	if requestIDStr == "" {
+		utils.SendErrorResponse(w, "Request ID is required", http.StatusBadRequest)
+		return nil
+	}
+
+	requestID, err := uuid.Parse(requestIDStr)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid request ID", http.StatusBadRequest)
+		return nil
+	}
+
+	request, err := models.GetFinancingRequestByID(h.DB, requestID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+
+	if request == nil {
+		utils.SendErrorResponse(w, "Financing request not found", http.StatusNotFound)
+		return nil
+	}
+
+	// Verify the request belongs to the user
+	if request.UserID != userID {
+		utils.SendErrorResponse(w, "Unauthorized to access this request", http.StatusForbidden)
+		return nil
+	}
+
+	return request
+}
+
 // RequestFinancing creates a new financing request
 func (h *FinancingHandler) RequestFinancing(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -50,74 +261,50 @@ func (h *FinancingHandler) RequestFinancing(w http.ResponseWriter, r *http.Reque
 		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	if accountStatus == nil || !accountStatus.IsComplete {
-		utils.SendErrorResponse(w, "Please complete your registration before requesting financing", http.StatusBadRequest)
+	if accountStatus == nil {
+		utils.SendErrorResponse(w, "Please complete your registration and required documents before requesting financing", http.StatusBadRequest)
 		return
 	}
-
-	var req FinancingRequestRequest
-
-	// Parse form-data or JSON
-	contentType := r.Header.Get("Content-Type")
-	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
-		if strings.HasPrefix(contentType, "multipart/form-data") {
-			if err := r.ParseMultipartForm(32 << 20); err != nil {
-				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
-				return
-			}
-			req.Amount = r.FormValue("amount")
-			req.Purpose = r.FormValue("purpose")
-			req.RepaymentPeriod = r.FormValue("repayment_period")
-		} else {
-			if err := r.ParseForm(); err != nil {
-				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
-				return
-			}
-			req.Amount = r.FormValue("amount")
-			req.Purpose = r.FormValue("purpose")
-			req.RepaymentPeriod = r.FormValue("repayment_period")
-		}
-	} else {
-		// JSON fallback
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+	// An expired trade license blocks new requests until the renewed one is uploaded
+	for _, item := range accountStatus.Documents.Items {
+		if item.Requirement == models.DocumentTypeTradeLicense && item.Status == models.ChecklistExpired {
+			utils.SendErrorResponse(w, fmt.Sprintf("Your trade license expired on %s. Please upload the renewed license before requesting financing",
+				item.ExpiresOn.Format("2006-01-02")), http.StatusBadRequest)
 			return
 		}
 	}
-
-	// Validate inputs
-	if req.Amount == "" {
-		utils.SendErrorResponse(w, "Amount is required", http.StatusBadRequest)
+	if !accountStatus.IsComplete {
+		utils.SendErrorResponse(w, "Please complete your registration and required documents before requesting financing", http.StatusBadRequest)
 		return
 	}
-	amount, err := strconv.ParseFloat(req.Amount, 64)
-	if err != nil || amount <= 0 {
-		utils.SendErrorResponse(w, "Invalid amount. Must be a positive number", http.StatusBadRequest)
+
+	req, ok := parseFinancingRequestRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if req.Purpose == "" {
-		utils.SendErrorResponse(w, "Purpose is required", http.StatusBadRequest)
+	product := h.loadFinancingProduct(w, req.ProductID)
+	if product == nil {
 		return
 	}
 
-	if req.RepaymentPeriod == "" {
-		utils.SendErrorResponse(w, "Repayment period is required", http.StatusBadRequest)
+	terms, message := validateFinancingRequest(req, product)
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
 		return
 	}
-	repaymentPeriod, err := strconv.Atoi(req.RepaymentPeriod)
-	if err != nil || repaymentPeriod <= 0 {
-		utils.SendErrorResponse(w, "Invalid repayment period. Must be a positive number of months", http.StatusBadRequest)
+
+	if !h.checkEligibility(w, userID, product) {
 		return
 	}
 
 	// Create financing request
 	financingRequest := &models.FinancingRequest{
 		UserID:          userID,
-		Amount:          amount,
-		Purpose:         req.Purpose,
-		RepaymentPeriod: repaymentPeriod,
-		Status:          "pending",
+		ProductID:       &product.ID,
+		Amount:          terms.Amount,
+		Purpose:         terms.Purpose,
+		RepaymentPeriod: terms.RepaymentPeriod,
 	}
 
 	if err := financingRequest.Create(h.DB); err != nil {
@@ -125,7 +312,12 @@ func (h *FinancingHandler) RequestFinancing(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	utils.SendSuccessResponse(w, "Financing request submitted successfully", financingRequest, http.StatusCreated)
+	message = "Financing request submitted successfully"
+	if financingRequest = h.scoreOrLog(financingRequest, product); financingRequest.Status == models.FinancingStatusRejected {
+		message = "Financing request submitted and automatically rejected"
+	}
+
+	utils.SendSuccessResponse(w, message, financingRequest, http.StatusCreated)
 }
 
 // GetFinancingRequests retrieves all financing requests for the authenticated user
@@ -163,37 +355,44 @@ func (h *FinancingHandler) GetFinancingRequest(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// Get request ID from URL path
-	requestIDStr := r.URL.Query().Get("id")
-	if requestIDStr == "" {
-		utils.SendErrorResponse(w, "Request ID is required", http.StatusBadRequest)
+	request := h.loadOwnedFinancingRequest(w, r, userID)
+	if request == nil {
 		return
 	}
 
-	requestID, err := uuid.Parse(requestIDStr)
+	history, err := models.GetFinancingRequestEvents(h.DB, request.ID)
 	if err != nil {
-		utils.SendErrorResponse(w, "Invalid request ID", http.StatusBadRequest)
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	request, err := models.GetFinancingRequestByID(h.DB, requestID)
+	schedule, err := models.GetRepaymentSchedule(h.DB, request.ID)
 	if err != nil {
 		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	if request == nil {
-		utils.SendErrorResponse(w, "Financing request not found", http.StatusNotFound)
+	offers, err := models.GetLoanOffersByRequestID(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	// Verify the request belongs to the user
-	if request.UserID != userID {
-		utils.SendErrorResponse(w, "Unauthorized to access this request", http.StatusForbidden)
+	loanAgreement, err := models.GetLoanAgreementByRequestID(h.DB, request.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	utils.SendSuccessResponse(w, "Financing request retrieved successfully", request, http.StatusOK)
+	detail := FinancingRequestDetail{
+		FinancingRequest: request,
+		History:          history,
+		Offers:           offerDetails(offers),
+		Schedule:         schedule,
+		Agreement:        loanAgreement,
+	}
+
+	utils.SendSuccessResponse(w, "Financing request retrieved successfully", detail, http.StatusOK)
 }
 
 // GetLatestFinancingRequest retrieves the latest financing request for the authenticated user
@@ -222,3 +421,248 @@ func (h *FinancingHandler) GetLatestFinancingRequest(w http.ResponseWriter, r *h
 
 	utils.SendSuccessResponse(w, "Latest financing request retrieved successfully", request, http.StatusOK)
 }
+
+// UpdateFinancingRequest edits the caller's own request while it is still pending.
+// Omitted fields keep their current value; the result is validated like a new request.
+func (h *FinancingHandler) UpdateFinancingRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := h.loadOwnedFinancingRequest(w, r, userID)
+	if request == nil {
+		return
+	}
+	if request.Status != models.FinancingStatusPending {
+		utils.SendErrorResponse(w, "Only pending financing requests can be edited", http.StatusConflict)
+		return
+	}
+
+	req, ok := parseFinancingRequestRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.ProductID == "" && request.ProductID != nil {
+		req.ProductID = request.ProductID.String()
+	}
+	if req.Amount == "" {
+		req.Amount = request.Amount.String()
+	}
+	if req.Currency == "" {
+		req.Currency = request.Currency
+	}
+	if req.Purpose == "" {
+		req.Purpose = request.Purpose
+	}
+	if req.RepaymentPeriod == "" {
+		req.RepaymentPeriod = strconv.Itoa(request.RepaymentPeriod)
+	}
+
+	product := h.loadFinancingProduct(w, req.ProductID)
+	if product == nil {
+		return
+	}
+
+	terms, message := validateFinancingRequest(req, product)
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkEligibility(w, userID, product) {
+		return
+	}
+
+	request.ProductID = &product.ID
+	request.Amount = terms.Amount
+	request.Purpose = terms.Purpose
+	request.RepaymentPeriod = terms.RepaymentPeriod
+
+	updated, err := request.UpdatePending(h.DB)
+	if err != nil {
+		utils.SendErrorResponse(w, "Failed to update financing request", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		// The status changed since the request was loaded
+		utils.SendErrorResponse(w, "Only pending financing requests can be edited", http.StatusConflict)
+		return
+	}
+
+	message = "Financing request updated successfully"
+	if request = h.scoreOrLog(request, product); request.Status == models.FinancingStatusRejected {
+		message = "Financing request updated and automatically rejected"
+	}
+
+	utils.SendSuccessResponse(w, message, request, http.StatusOK)
+}
+
+// WithdrawFinancingRequest withdraws the caller's own request while it is still pending
+func (h *FinancingHandler) WithdrawFinancingRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := h.loadOwnedFinancingRequest(w, r, userID)
+	if request == nil {
+		return
+	}
+	if request.Status != models.FinancingStatusPending {
+		utils.SendErrorResponse(w, "Only pending financing requests can be withdrawn", http.StatusConflict)
+		return
+	}
+
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	request, err = models.TransitionFinancingRequestFrom(h.DB, request.ID, models.FinancingStatusPending, models.FinancingStatusWithdrawn, &userID, reason)
+	if err != nil {
+		var transitionErr *models.InvalidTransitionError
+		if errors.As(err, &transitionErr) {
+			utils.SendErrorResponse(w, "Only pending financing requests can be withdrawn", http.StatusConflict)
+			return
+		}
+		utils.SendErrorResponse(w, "Failed to withdraw financing request", http.StatusInternalServerError)
+		return
+	}
+	if request == nil {
+		utils.SendErrorResponse(w, "Financing request not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Financing request withdrawn successfully", request, http.StatusOK)
+}
+
+// Quote is a public loan calculator. It returns the month-by-month repayment schedule for
+// amount, currency and repayment_period (months). With product_id the product's pricing and
+// limits apply. annual_rate and processing_fee (percent), method (flat or reducing_balance)
+// and start_date (YYYY-MM-DD) default to the product or configured pricing and today.
+func (h *FinancingHandler) Quote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var product *models.FinancingProduct
+	if query.Get("product_id") != "" {
+		if product = h.loadFinancingProduct(w, query.Get("product_id")); product == nil {
+			return
+		}
+	}
+
+	currency := query.Get("currency")
+	if currency == "" && product != nil {
+		currency = product.Currency
+	}
+	if currency == "" {
+		currency = money.DefaultCurrency()
+	}
+	amount, message := validateAmount(query.Get("amount"), currency)
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("repayment_period") == "" {
+		utils.SendErrorResponse(w, "Repayment period is required", http.StatusBadRequest)
+		return
+	}
+	months, message := validateRepaymentPeriod(query.Get("repayment_period"))
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+
+	if product != nil {
+		if reasons := product.CheckTerms(amount, months); len(reasons) > 0 {
+			utils.SendErrorResponse(w, notEligibleMessage(product, reasons), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pricing, err := financingPricing(product)
+	if err != nil {
+		log.Printf("Invalid financing pricing configuration: %v", err)
+		utils.SendErrorResponse(w, "Financing pricing is misconfigured", http.StatusInternalServerError)
+		return
+	}
+	if value := query.Get("annual_rate"); value != "" {
+		if pricing.AnnualRateBps, err = loan.ParseRate(value); err != nil {
+			utils.SendErrorResponse(w, "Invalid annual_rate. The "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("processing_fee"); value != "" {
+		if pricing.ProcessingFeeBps, err = loan.ParseRate(value); err != nil {
+			utils.SendErrorResponse(w, "Invalid processing_fee. The "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("method"); value != "" {
+		method, ok := loan.ParseMethod(value)
+		if !ok {
+			utils.SendErrorResponse(w, "Invalid method. Must be flat or reducing_balance", http.StatusBadRequest)
+			return
+		}
+		pricing.Method = method
+	}
+
+	startDate := time.Now().UTC()
+	if value := query.Get("start_date"); value != "" {
+		if startDate, err = time.Parse("2006-01-02", value); err != nil {
+			utils.SendErrorResponse(w, "Invalid start_date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	schedule, err := loan.BuildSchedule(loan.Terms{
+		Pricing:   pricing,
+		Principal: amount,
+		Months:    months,
+		StartDate: startDate,
+	})
+	if err != nil {
+		utils.SendErrorResponse(w, "Unable to calculate schedule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Quote calculated successfully", schedule, http.StatusOK)
+}
+
+// financingPricing returns the product's pricing, or the configured default for requests without a product
+func financingPricing(product *models.FinancingProduct) (loan.Pricing, error) {
+	if product != nil {
+		return product.Pricing, nil
+	}
+	return loan.DefaultPricing()
+}
+
+// ListProducts returns the active financing products with their limits, pricing and eligibility rules
+func (h *FinancingHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	products, err := models.GetActiveFinancingProducts(h.DB)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Financing products retrieved successfully", products, http.StatusOK)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"sme_fin_backend/filescan"
+	"sme_fin_backend/jobs"
+	"sme_fin_backend/loan"
+	"sme_fin_backend/notify"
+	"sme_fin_backend/storage"
+	"sme_fin_backend/utils"
+)
+
+type JobsHandler struct {
+	DB       *sql.DB
+	Storage  storage.Backend
+	Scanner  filescan.Scanner // nil skips rescanning quarantined uploads
+	Notifier notify.Notifier  // nil skips trade license reminders
+}
+
+// authorizeCron checks the "Authorization: Bearer <CRON_SECRET>" header that Vercel Cron sends.
+// Without CRON_SECRET the job endpoints are disabled.
+func authorizeCron(r *http.Request) bool {
+	secret := os.Getenv("CRON_SECRET")
+	if secret == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// Daily runs the daily job: expiring offers, posting due installments, marking overdue
+// installments, charging late fees, updating the collections queue, rescanning quarantined
+// uploads, removing abandoned resumable uploads and flagging expiring trade licenses
+func (h *JobsHandler) Daily(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !authorizeCron(r) {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	policy, err := loan.LateFeePolicyFromEnv()
+	if err != nil {
+		log.Printf("Invalid late fee policy: %v", err)
+		utils.SendErrorResponse(w, "Late fee policy is misconfigured", http.StatusInternalServerError)
+		return
+	}
+
+	report, err := jobs.RunDaily(h.DB, time.Now(), policy, jobs.Files{Storage: h.Storage, Scanner: h.Scanner}, h.Notifier)
+	if errors.Is(err, jobs.ErrAlreadyRunning) {
+		utils.SendErrorResponse(w, "Daily job is already running", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Daily job failed: %v", err)
+		utils.SendErrorResponse(w, "Daily job failed", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Daily job finished", report, http.StatusOK)
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"sme_fin_backend/utils"
+)
+
+// JWKS serves the public token verification keys so other services can validate
+// SMEfin access tokens. The body is a bare JWK Set (RFC 7517), not the usual
+// response envelope, because standard JWT libraries consume it directly.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	set, err := utils.JWKS()
+	if err != nil {
+		log.Printf("Failed to load JWT keys: %v", err)
+		utils.SendErrorResponse(w, "Signing keys are not available", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(set)
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// LoanOfferDetail is an offer together with the repayment schedule its terms produce.
+// The schedule is only included while the offer is open.
+type LoanOfferDetail struct {
+	models.LoanOffer
+	Schedule *loan.Schedule `json:"schedule,omitempty"`
+}
+
+type OfferResponseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// offerDetails previews the schedule of each open offer as if it were accepted today
+func offerDetails(offers []models.LoanOffer) []LoanOfferDetail {
+	details := make([]LoanOfferDetail, 0, len(offers))
+	for _, offer := range offers {
+		detail := LoanOfferDetail{LoanOffer: offer}
+		if offer.Status == models.OfferStatusPending {
+			if schedule, err := loan.BuildSchedule(offer.Terms(time.Now().UTC())); err == nil {
+				detail.Schedule = schedule
+			}
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+// sendOfferError maps offer and state machine errors to 404/409 and anything else to 500
+func sendOfferError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.SendErrorResponse(w, "Offer not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrOfferExpired):
+		utils.SendErrorResponse(w, "Offer has expired", http.StatusConflict)
+	case errors.Is(err, models.ErrOfferNotPending):
+		utils.SendErrorResponse(w, "Offer is no longer open", http.StatusConflict)
+	case errors.Is(err, models.ErrRequestNotUnderReview):
+		utils.SendErrorResponse(w, "Offers can only be issued on requests under review", http.StatusConflict)
+	default:
+		sendTransitionError(w, err)
+	}
+}
+
+// loadOwnedOffer reads the "id" query parameter and loads the offer, making sure its request
+// belongs to the caller. It writes the error response itself when that fails.
+func (h *FinancingHandler) loadOwnedOffer(w http.ResponseWriter, r *http.Request, userID uuid.UUID) *models.LoanOffer {
+	offerIDStr := r.URL.Query().Get("id")
+	if offerIDStr == "" {
+		utils.SendErrorResponse(w, "Offer ID is required", http.StatusBadRequest)
+		return nil
+	}
+
+	offerID, err := uuid.Parse(offerIDStr)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid offer ID", http.StatusBadRequest)
+		return nil
+	}
+
+	offer, err := models.GetLoanOfferByID(h.DB, offerID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+	if offer == nil {
+		utils.SendErrorResponse(w, "Offer not found", http.StatusNotFound)
+		return nil
+	}
+
+	request, err := models.GetFinancingRequestByID(h.DB, offer.FinancingRequestID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil
+	}
+	if request == nil || request.UserID != userID {
+		utils.SendErrorResponse(w, "Unauthorized to access this offer", http.StatusForbidden)
+		return nil
+	}
+
+	return offer
+}
+
+// AcceptOffer accepts an open offer on the caller's request. The request is approved and its
+// repayment schedule is fixed from the offer's terms.
+func (h *FinancingHandler) AcceptOffer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	offer := h.loadOwnedOffer(w, r, userID)
+	if offer == nil {
+		return
+	}
+
+	offer, request, err := models.AcceptLoanOffer(h.DB, offer.ID, userID)
+	if err != nil {
+		sendOfferError(w, err)
+		return
+	}
+
+	// The agreement can also be generated later on first retrieval
+	loanAgreement, err := h.ensureAgreement(r.Context(), request)
+	if err != nil {
+		log.Printf("Failed to generate loan agreement for %s: %v", request.ID, err)
+	}
+
+	utils.SendSuccessResponse(w, "Offer accepted successfully", map[string]interface{}{
+		"offer":     offer,
+		"request":   request,
+		"agreement": loanAgreement,
+	}, http.StatusOK)
+}
+
+// DeclineOffer declines an open offer on the caller's request. The reason is optional.
+func (h *FinancingHandler) DeclineOffer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req OfferResponseRequest
+
+	// Parse form-data or JSON; the body is optional
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+		}
+		req.Reason = r.FormValue("reason")
+	} else if r.ContentLength != 0 {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	offer := h.loadOwnedOffer(w, r, userID)
+	if offer == nil {
+		return
+	}
+
+	offer, err = models.DeclineLoanOffer(h.DB, offer.ID, strings.TrimSpace(req.Reason))
+	if err != nil {
+		sendOfferError(w, err)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Offer declined successfully", offer, http.StatusOK)
+}
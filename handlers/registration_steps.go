@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// parseStepForm parses form-data or urlencoded bodies. It reports false for other content
+// types, which are read as JSON.
+func parseStepForm(r *http.Request) (bool, error) {
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		return true, r.ParseMultipartForm(32 << 20)
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return true, r.ParseForm()
+	}
+	return false, nil
+}
+
+// stepUser checks the method and returns the caller, writing the error response if either is wrong
+func (h *UserHandler) stepUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	if r.Method != http.MethodPut {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return uuid.Nil, false
+	}
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// sendRegistrationStep responds with the state of a saved step and the overall account status
+func (h *UserHandler) sendRegistrationStep(w http.ResponseWriter, userID uuid.UUID, result *models.RegistrationStepResult) {
+	accountStatus, err := models.GetAccountStatus(h.DB, userID)
+	if err != nil || accountStatus == nil {
+		utils.SendErrorResponse(w, "Failed to get account status", http.StatusInternalServerError)
+		return
+	}
+
+	message := "Step saved successfully"
+	if !result.Complete {
+		message = "Draft saved"
+	}
+	// Object keys stay internal; uploaded files are reached through the documents endpoint
+	fields := make(map[string]string, len(result.Fields))
+	for name, value := range result.Fields {
+		if name != "object_key" {
+			fields[name] = value
+		}
+	}
+	utils.SendSuccessResponse(w, message, map[string]interface{}{
+		"step":      result.Step,
+		"complete":  result.Complete,
+		"fields":    fields,
+		"missing":   result.Missing,
+		"next_step": accountStatus.NextStep,
+		"status":    accountStatus,
+	}, http.StatusOK)
+}
+
+// UpdatePersonal saves the personal details step. Missing fields are kept as a draft.
+func (h *UserHandler) UpdatePersonal(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.stepUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req PersonalDetailsRequest
+	isForm, err := parseStepForm(r)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	if isForm {
+		req.FullName = getFormValue(r, "personal[full_name]", "personal_full_name", "full_name")
+		req.Email = getFormValue(r, "personal[email]", "personal_email", "email")
+		req.PhoneNumber = getFormValue(r, "personal[phone_number]", "personal_phone_number", "phone_number")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{
+		"full_name":    strings.TrimSpace(req.FullName),
+		"email":        strings.TrimSpace(req.Email),
+		"phone_number": strings.TrimSpace(req.PhoneNumber),
+	}
+	if fields["email"] != "" && !utils.ValidateEmail(fields["email"]) {
+		utils.SendErrorResponse(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+	if fields["phone_number"] != "" && !utils.ValidatePhone(fields["phone_number"]) {
+		utils.SendErrorResponse(w, "Invalid phone number format", http.StatusBadRequest)
+		return
+	}
+
+	result, err := models.SaveRegistrationStep(h.DB, userID, models.RegistrationStepPersonal, fields)
+	if err != nil {
+		log.Printf("Failed to save personal step for %s: %v", userID, err)
+		utils.SendErrorResponse(w, "Failed to save personal details", http.StatusInternalServerError)
+		return
+	}
+	h.sendRegistrationStep(w, userID, result)
+}
+
+// UpdateBusiness saves the business details step. Missing fields are kept as a draft.
+func (h *UserHandler) UpdateBusiness(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.stepUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req BusinessDetailsRequest
+	isForm, err := parseStepForm(r)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	if isForm {
+		req.BusinessName = getFormValue(r, "business[business_name]", "business_business_name", "business_name")
+		req.TradeLicenseNumber = getFormValue(r, "business[trade_license_number]", "business_trade_license_number", "trade_license_number")
+		req.EstablishedOn = getFormValue(r, "business[established_on]", "business_established_on", "established_on")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{
+		"business_name":        strings.TrimSpace(req.BusinessName),
+		"trade_license_number": strings.TrimSpace(req.TradeLicenseNumber),
+		"established_on":       strings.TrimSpace(req.EstablishedOn),
+	}
+	if fields["established_on"] != "" {
+		date, err := time.Parse("2006-01-02", fields["established_on"])
+		if err != nil || date.After(time.Now()) {
+			utils.SendErrorResponse(w, "Invalid establishment date. Use a past date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := models.SaveRegistrationStep(h.DB, userID, models.RegistrationStepBusiness, fields)
+	if err != nil {
+		log.Printf("Failed to save business step for %s: %v", userID, err)
+		utils.SendErrorResponse(w, "Failed to save business details", http.StatusInternalServerError)
+		return
+	}
+	h.sendRegistrationStep(w, userID, result)
+}
+
+// UpdateTradeLicense saves the trade license step from an uploaded file (trade[file]) or from
+// a filename and file URL, with the license's issue date, expiry date and issuing authority.
+// Until all of them are known the step is kept as a draft. An uploaded file is streamed to
+// storage and deleted again if the step cannot be saved.
+func (h *UserHandler) UpdateTradeLicense(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.stepUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req TradeLicenseRequest
+	var upload *storedUpload
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if upload, ok = h.parseUploadForm(w, r, "trade[file]"); !ok {
+			return
+		}
+		if upload != nil {
+			req.Filename = upload.Filename
+		} else {
+			req.Filename = getFormValue(r, "trade[filename]", "trade_filename", "filename")
+			req.FileURL = getFormValue(r, "trade[file_url]", "trade_file_url", "file_url")
+		}
+		readLicenseDetails(r, &req)
+	} else {
+		isForm, err := parseStepForm(r)
+		if err != nil {
+			utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		if isForm {
+			req.Filename = getFormValue(r, "trade[filename]", "trade_filename", "filename")
+			req.FileURL = getFormValue(r, "trade[file_url]", "trade_file_url", "file_url")
+			readLicenseDetails(r, &req)
+		} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fields := map[string]string{
+		"filename":          strings.TrimSpace(req.Filename),
+		"file_url":          strings.TrimSpace(req.FileURL),
+		"issued_on":         strings.TrimSpace(req.IssuedOn),
+		"expires_on":        strings.TrimSpace(req.ExpiresOn),
+		"issuing_authority": strings.TrimSpace(req.IssuingAuthority),
+	}
+	// The file's size, digest and scan result travel with it, through the draft if the step
+	// is not complete yet
+	if upload != nil {
+		for name, value := range upload.fileFields() {
+			fields[name] = value
+		}
+	}
+	if _, _, message := parseLicenseDates(fields["issued_on"], fields["expires_on"]); message != "" {
+		if upload != nil {
+			h.deleteUpload(upload.Key)
+		}
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+	result, err := models.SaveRegistrationStep(h.DB, userID, models.RegistrationStepTradeLicense, fields)
+	if err != nil {
+		log.Printf("Failed to save trade license step for %s: %v", userID, err)
+		// Nothing references the file we just uploaded
+		if upload != nil {
+			h.deleteUpload(upload.Key)
+		}
+		utils.SendErrorResponse(w, "Failed to save trade license", http.StatusInternalServerError)
+		return
+	}
+	if result.ReplacedObjectKey != "" {
+		h.deleteUpload(result.ReplacedObjectKey)
+	}
+	h.sendRegistrationStep(w, userID, result)
+}
@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/storage"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Resumable uploads follow the tus 1.0 protocol (https://tus.io/protocols/resumable-upload)
+// with the creation, expiration and termination extensions. Every PATCH request is stored as
+// a chunk object of its own, so a dropped connection loses at most the bytes in flight. When
+// the last byte arrives the chunks are read back in order through the same pipeline as a
+// direct upload, which validates, scans and stores the file, and the document is saved.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+// uploadAssemblyTimeout bounds reading back, checking and saving a complete upload
+const uploadAssemblyTimeout = 10 * time.Minute
+
+// uploadExpiry is how long an upload may sit idle before the daily job removes it
+func uploadExpiry() time.Duration {
+	return time.Duration(utils.GetEnvInt("UPLOAD_EXPIRY_HOURS", 24)) * time.Hour
+}
+
+// uploadPath is the URL of a resumable upload
+func uploadPath(id uuid.UUID) string {
+	return "/api/user/uploads/" + id.String()
+}
+
+// UploadOptions describes the server's tus support. It needs no authentication.
+func UploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusRequest checks the protocol version of a tus request, writing the error response if it
+// is not supported
+func tusRequest(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		utils.SendErrorResponse(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated pairs of a key and
+// a base64-encoded value, which may be left out
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid metadata %q", pair)
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata value for %q", fields[0])
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata, nil
+}
+
+// ownUpload loads the upload named in the URL, writing the error response unless it exists
+// and belongs to the caller
+func (h *UserHandler) ownUpload(w http.ResponseWriter, r *http.Request) (*models.ResumableUpload, bool) {
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.SendErrorResponse(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	upload, err := models.GetResumableUpload(h.DB, id)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	// Other users' uploads are reported missing rather than forbidden
+	if upload == nil || upload.UserID != userID {
+		utils.SendErrorResponse(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	return upload, true
+}
+
+// CreateUpload starts a resumable upload. The file size goes in Upload-Length; Upload-Metadata
+// carries the filename and optionally the document type (trade_license, the default, or a vault
+// document type) and the expiry date of a vault document (expires_on).
+func (h *UserHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if h.Storage == nil {
+		utils.SendErrorResponse(w, "File storage is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		utils.SendErrorResponse(w, "Upload-Length must be a positive number of bytes", http.StatusBadRequest)
+		return
+	}
+	if length > maxUploadSize {
+		utils.SendErrorResponse(w, errUploadTooLarge.Message, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid Upload-Metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	filename = filepath.Base(filename)
+	if filename == "" || filename == "." || filename == "/" {
+		utils.SendErrorResponse(w, "Filename is required in Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+	if !utils.ValidateFileType(filename, allowedUploadTypes) {
+		utils.SendErrorResponse(w, "Invalid file type. Only PDF, JPG, and PNG files are allowed", http.StatusBadRequest)
+		return
+	}
+	documentType := metadata["document_type"]
+	if documentType == "" {
+		documentType = models.DocumentTypeTradeLicense
+	}
+	if documentType != models.DocumentTypeTradeLicense && !models.ValidVaultDocumentType(documentType) {
+		utils.SendErrorResponse(w, "Unsupported document type", http.StatusBadRequest)
+		return
+	}
+	upload := &models.ResumableUpload{
+		UserID:       userID,
+		DocumentType: documentType,
+		Filename:     filename,
+		Length:       length,
+		ExpiresAt:    time.Now().Add(uploadExpiry()),
+	}
+	var message string
+	if documentType == models.DocumentTypeTradeLicense {
+		// The license is saved when the upload finishes, so its details come with it
+		issuedOn, expiresOn, authority := strings.TrimSpace(metadata["issued_on"]), strings.TrimSpace(metadata["expires_on"]),
+			strings.TrimSpace(metadata["issuing_authority"])
+		if issuedOn == "" || expiresOn == "" || authority == "" {
+			utils.SendErrorResponse(w, "issued_on, expires_on and issuing_authority are required in Upload-Metadata for a trade license", http.StatusBadRequest)
+			return
+		}
+		upload.DocumentIssuedOn, upload.DocumentExpiresOn, message = parseLicenseDates(issuedOn, expiresOn)
+		upload.DocumentIssuingAuthority = authority
+	} else {
+		upload.DocumentExpiresOn, message = parseDocumentExpiry(metadata["expires_on"])
+	}
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
+	if err := models.CreateResumableUpload(h.DB, upload); err != nil {
+		log.Printf("Failed to create upload for %s: %v", userID, err)
+		utils.SendErrorResponse(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", uploadPath(upload.ID))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	utils.SendSuccessResponse(w, "Upload created successfully", upload, http.StatusCreated)
+}
+
+// UploadOffset answers a tus HEAD request with the number of bytes received so far, so the
+// client knows where to resume
+func (h *UserHandler) UploadOffset(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	upload, ok := h.ownUpload(w, r)
+	if !ok {
+		return
+	}
+	if upload.Status == models.UploadStatusExpired {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Status == models.UploadStatusUploading {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetUpload returns the state of an upload, including the document it produced once completed
+func (h *UserHandler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	upload, ok := h.ownUpload(w, r)
+	if !ok {
+		return
+	}
+	data := map[string]interface{}{"upload": upload}
+	if upload.DocumentID != nil {
+		data["download_url"] = models.DocumentDownloadPath(*upload.DocumentID)
+	}
+	utils.SendSuccessResponse(w, "Upload retrieved successfully", data, http.StatusOK)
+}
+
+// PatchUpload appends the request body to an upload at the offset given in Upload-Offset. The
+// bytes received are kept even if the connection drops part way. When the upload is complete
+// the file is assembled and saved as its document before the response is sent.
+func (h *UserHandler) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		utils.SendErrorResponse(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	upload, ok := h.ownUpload(w, r)
+	if !ok {
+		return
+	}
+	if h.Storage == nil {
+		utils.SendErrorResponse(w, "File storage is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.SendErrorResponse(w, "Upload-Offset must be a number of bytes", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case upload.Status == models.UploadStatusExpired || (upload.Status == models.UploadStatusUploading && time.Now().After(upload.ExpiresAt)):
+		utils.SendErrorResponse(w, "Upload has expired", http.StatusGone)
+		return
+	case upload.Status != models.UploadStatusUploading:
+		utils.SendErrorResponse(w, "Upload is "+upload.Status, http.StatusConflict)
+		return
+	case offset != upload.Offset:
+		utils.SendErrorResponse(w, "Upload-Offset does not match the upload", http.StatusConflict)
+		return
+	}
+
+	// An empty PATCH at the end retries an assembly that failed for a server-side reason
+	if upload.Offset < upload.Length {
+		chunk, ok := h.storeChunk(w, r, upload)
+		if !ok {
+			return
+		}
+		updated, err := models.AppendUploadChunk(h.DB, upload.ID, *chunk, time.Now().Add(uploadExpiry()))
+		if err != nil {
+			h.deleteUpload(chunk.ObjectKey)
+			if errors.Is(err, models.ErrUploadOffsetMismatch) {
+				utils.SendErrorResponse(w, "Upload-Offset does not match the upload", http.StatusConflict)
+				return
+			}
+			log.Printf("Failed to record chunk of upload %s: %v", upload.ID, err)
+			utils.SendErrorResponse(w, "Failed to save chunk", http.StatusInternalServerError)
+			return
+		}
+		upload = updated
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.Offset < upload.Length {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if h.assembleUpload(w, r, upload) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// storeChunk streams the request body to a chunk object. It writes the error response and
+// reports false if nothing could be stored.
+func (h *UserHandler) storeChunk(w http.ResponseWriter, r *http.Request, upload *models.ResumableUpload) (*models.UploadChunk, bool) {
+	chunk := &models.UploadChunk{
+		Offset:    upload.Offset,
+		ObjectKey: fmt.Sprintf("uploads/%s/%d_%s", upload.ID, upload.Offset, uuid.New()),
+	}
+	remaining := upload.Length - upload.Offset
+	body := &partialReader{r: io.LimitReader(r.Body, remaining+1)}
+
+	// Detached from the request, so the bytes received before a disconnect are still stored
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := h.Storage.Put(ctx, chunk.ObjectKey, body, -1, "application/octet-stream"); err != nil {
+		log.Printf("Failed to store chunk of upload %s: %v", upload.ID, err)
+		utils.SendErrorResponse(w, "Failed to save chunk", http.StatusInternalServerError)
+		return nil, false
+	}
+	if body.err != nil {
+		log.Printf("Upload %s: connection lost after %d bytes: %v", upload.ID, body.n, body.err)
+	}
+
+	chunk.Size = body.n
+	switch {
+	case chunk.Size == 0:
+		h.deleteUpload(chunk.ObjectKey)
+		utils.SendErrorResponse(w, "Request body is empty", http.StatusBadRequest)
+		return nil, false
+	case chunk.Size > remaining:
+		h.deleteUpload(chunk.ObjectKey)
+		utils.SendErrorResponse(w, "Request body exceeds Upload-Length", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return chunk, true
+}
+
+// assembleUpload reads the chunks of a complete upload back in order, runs them through the
+// upload pipeline and saves the document. A rejected file fails the upload; a server-side
+// failure leaves it complete but unassembled, so an empty PATCH can retry. It writes the error
+// response and reports false on failure.
+func (h *UserHandler) assembleUpload(w http.ResponseWriter, r *http.Request, upload *models.ResumableUpload) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), uploadAssemblyTimeout)
+	defer cancel()
+	started, err := models.StartUploadAssembly(h.DB, upload.ID, time.Now().Add(uploadAssemblyTimeout))
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if !started {
+		utils.SendErrorResponse(w, "Upload is already being assembled", http.StatusConflict)
+		return false
+	}
+
+	retry := func(message string, cause error) bool {
+		log.Printf("Failed to assemble upload %s: %v", upload.ID, cause)
+		if err := models.EndUploadAssembly(h.DB, upload.ID, models.UploadStatusUploading, nil, ""); err != nil {
+			log.Printf("Failed to reset upload %s: %v", upload.ID, err)
+		}
+		utils.SendErrorResponse(w, message, http.StatusInternalServerError)
+		return false
+	}
+
+	chunks, err := models.GetUploadChunks(h.DB, upload.ID)
+	if err != nil {
+		return retry("Failed to read upload", err)
+	}
+	reader := &chunkReader{ctx: ctx, storage: h.Storage, chunks: chunks}
+	stored, err := h.streamUpload(ctx, reader, upload.Filename)
+	reader.Close()
+	if reader.err != nil {
+		return retry("Failed to read upload", reader.err)
+	}
+
+	var rejected *uploadError
+	if errors.As(err, &rejected) && rejected.Status < http.StatusInternalServerError {
+		if err := models.EndUploadAssembly(h.DB, upload.ID, models.UploadStatusFailed, nil, rejected.Message); err != nil {
+			log.Printf("Failed to record failure of upload %s: %v", upload.ID, err)
+		}
+		h.deleteChunks(chunks)
+		utils.SendErrorResponse(w, rejected.Message, rejected.Status)
+		return false
+	}
+	if err != nil {
+		return retry(err.Error(), err)
+	}
+
+	documentID, err := h.saveUploadedDocument(upload, stored)
+	if err != nil {
+		h.deleteUpload(stored.Key)
+		return retry("Failed to save document", err)
+	}
+
+	if err := models.EndUploadAssembly(h.DB, upload.ID, models.UploadStatusCompleted, &documentID, ""); err != nil {
+		log.Printf("Failed to complete upload %s: %v", upload.ID, err)
+	}
+	h.deleteChunks(chunks)
+	return true
+}
+
+// saveUploadedDocument saves an assembled file as the document the upload was created for
+// and returns the document ID
+func (h *UserHandler) saveUploadedDocument(upload *models.ResumableUpload, stored *storedUpload) (uuid.UUID, error) {
+	if upload.DocumentType != models.DocumentTypeTradeLicense {
+		document, err := h.saveVaultDocument(upload.UserID, upload.DocumentType, upload.DocumentExpiresOn, stored)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return document.ID, nil
+	}
+
+	fields := stored.fileFields()
+	fields["issuing_authority"] = upload.DocumentIssuingAuthority
+	for name, date := range map[string]*time.Time{"issued_on": upload.DocumentIssuedOn, "expires_on": upload.DocumentExpiresOn} {
+		if date != nil {
+			fields[name] = date.Format("2006-01-02")
+		}
+	}
+	result, err := models.SaveRegistrationStep(h.DB, upload.UserID, models.RegistrationStepTradeLicense, fields)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !result.Complete {
+		return uuid.Nil, fmt.Errorf("trade license of %s is missing %v", upload.UserID, result.Missing)
+	}
+	if result.ReplacedObjectKey != "" {
+		h.deleteUpload(result.ReplacedObjectKey)
+	}
+	tl, err := models.GetTradeLicense(h.DB, upload.UserID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if tl == nil {
+		return uuid.Nil, fmt.Errorf("trade license of %s not found after saving", upload.UserID)
+	}
+	return tl.DocumentID, nil
+}
+
+// DeleteUpload cancels an upload and deletes the chunks received so far. A completed upload
+// is only forgotten; its document is kept.
+func (h *UserHandler) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	upload, ok := h.ownUpload(w, r)
+	if !ok {
+		return
+	}
+
+	chunks, err := models.GetUploadChunks(h.DB, upload.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	deleted, err := models.DeleteResumableUpload(h.DB, upload.ID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		utils.SendErrorResponse(w, "Upload is being assembled", http.StatusConflict)
+		return
+	}
+	if h.Storage != nil {
+		h.deleteChunks(chunks)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) deleteChunks(chunks []models.UploadChunk) {
+	for _, chunk := range chunks {
+		h.deleteUpload(chunk.ObjectKey)
+	}
+}
+
+// partialReader ends the stream at the first read error instead of failing it, so that the
+// bytes received before a dropped connection can be kept. The error is kept in err.
+type partialReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (p *partialReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if err != nil && err != io.EOF {
+		p.err = err
+		err = io.EOF
+	}
+	return n, err
+}
+
+// chunkReader reads the chunks of an upload one after another, opening each when it is
+// reached. A storage error is kept in err, to tell it apart from a rejected file.
+type chunkReader struct {
+	ctx     context.Context
+	storage storage.Backend
+	chunks  []models.UploadChunk
+	current io.ReadCloser
+	err     error
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			body, _, err := c.storage.Get(c.ctx, c.chunks[0].ObjectKey)
+			if err != nil {
+				c.err = fmt.Errorf("reading chunk at offset %d: %w", c.chunks[0].Offset, err)
+				return 0, c.err
+			}
+			c.current, c.chunks = body, c.chunks[1:]
+		}
+
+		n, err := c.current.Read(b)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		if err != nil {
+			c.err = err
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.Close()
+}
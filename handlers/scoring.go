@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/scoring"
+)
+
+// scoreFinancingRequest scores a submitted or edited request from the applicant's registration
+// and request history and records the result. A request scoring above the auto-reject threshold
+// is rejected straight away; the returned request reflects that.
+func (h *FinancingHandler) scoreFinancingRequest(request *models.FinancingRequest, product *models.FinancingProduct) (*models.FinancingRequest, error) {
+	summary, err := models.GetRegistrationSummary(h.DB, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := models.GetFinancingRequestsByUserID(h.DB, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	input := scoring.Input{
+		Amount:               request.Amount,
+		RepaymentPeriod:      request.RepaymentPeriod,
+		RegistrationComplete: summary != nil,
+	}
+	if product != nil {
+		input.ProductCode = product.Code
+		input.ProductMaxAmount = &product.MaxAmount
+	}
+	if summary != nil && summary.BusinessInfo.EstablishedOn != nil {
+		age := models.MonthsBetween(*summary.BusinessInfo.EstablishedOn, time.Now())
+		input.BusinessAgeMonths = &age
+	}
+	for _, previous := range history {
+		if previous.ID == request.ID {
+			continue
+		}
+		input.PreviousRequests++
+		switch previous.Status {
+		case models.FinancingStatusApproved, models.FinancingStatusDisbursed:
+			input.PreviousApproved++
+		case models.FinancingStatusRejected:
+			input.PreviousRejected++
+		case models.FinancingStatusWithdrawn:
+			input.PreviousWithdrawn++
+		case models.FinancingStatusPending, models.FinancingStatusUnderReview:
+			input.OpenRequests++
+		}
+	}
+
+	result := h.Scorer.Score(input)
+	score := &models.FinancingRequestScore{
+		FinancingRequestID: request.ID,
+		Score:              result.Score,
+		Band:               result.Band,
+		FiredRules:         result.FiredRules,
+		RulesVersion:       result.RulesVersion,
+		AutoRejected:       result.AutoReject && request.Status == models.FinancingStatusPending,
+	}
+
+	reason := fmt.Sprintf("Automatically rejected: risk score %d (%s)", result.Score, result.Band)
+	rejected, err := models.RecordFinancingRequestScore(h.DB, score, reason)
+	if err != nil {
+		return nil, err
+	}
+	if rejected != nil {
+		return rejected, nil
+	}
+	return request, nil
+}
+
+// scoreOrLog scores the request when a scorer is configured. A scoring failure must not fail
+// the submission, so it is logged and the request is returned unchanged.
+func (h *FinancingHandler) scoreOrLog(request *models.FinancingRequest, product *models.FinancingProduct) *models.FinancingRequest {
+	if h.Scorer == nil {
+		return request
+	}
+	scored, err := h.scoreFinancingRequest(request, product)
+	if err != nil {
+		log.Printf("Failed to score financing request %s: %v", request.ID, err)
+		return request
+	}
+	return scored
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+	SessionID    string `json:"session_id"`
+}
+
+// startSession creates a session for the user and returns a fresh token pair
+func (h *AuthHandler) startSession(r *http.Request, user *models.User, deviceName string) (*TokenResponse, error) {
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := r.UserAgent()
+	if deviceName == "" {
+		deviceName = userAgent
+	}
+	if len(deviceName) > 255 {
+		// Cut at a rune boundary, so multi-byte names stay valid UTF-8
+		cut := 255
+		for cut > 0 && !utf8.RuneStart(deviceName[cut]) {
+			cut--
+		}
+		deviceName = deviceName[:cut]
+	}
+
+	session := &models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		DeviceName:       deviceName,
+		UserAgent:        userAgent,
+		IPAddress:        utils.ClientIP(r),
+		ExpiresAt:        time.Now().Add(utils.RefreshTokenTTL()),
+	}
+	if err := session.Create(h.DB); err != nil {
+		return nil, err
+	}
+
+	return issueTokens(user, session, refreshToken)
+}
+
+func issueTokens(user *models.User, session *models.Session, refreshToken string) (*TokenResponse, error) {
+	token, err := utils.GenerateJWT(user.ID, user.Email, user.Role, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+		SessionID:    session.ID.String(),
+	}, nil
+}
+
+// parseRefreshTokenRequest reads refresh_token from form-data or JSON
+func parseRefreshTokenRequest(r *http.Request) (*RefreshTokenRequest, error) {
+	var req RefreshTokenRequest
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return nil, err
+		}
+		req.RefreshToken = r.FormValue("refresh_token")
+	} else if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		req.RefreshToken = r.FormValue("refresh_token")
+	} else {
+		// JSON fallback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+	}
+
+	return &req, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair, rotating the refresh token
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := parseRefreshTokenRequest(r)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		utils.SendErrorResponse(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	hash := utils.HashToken(req.RefreshToken)
+	session, err := models.GetSessionByRefreshTokenHash(h.DB, hash)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if session == nil {
+		// A rotated-out token being replayed means it leaked: revoke the whole session
+		reused, err := models.GetSessionByPreviousTokenHash(h.DB, hash)
+		if err != nil {
+			utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if reused != nil {
+			log.Printf("Refresh token reuse detected for session %s, revoking", reused.ID)
+			if _, err := models.RevokeSession(h.DB, reused.ID, reused.UserID); err != nil {
+				log.Printf("Failed to revoke session %s: %v", reused.ID, err)
+			}
+		}
+		utils.SendErrorResponse(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if !session.IsActive() {
+		utils.SendErrorResponse(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := models.GetUserByID(h.DB, session.UserID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		utils.SendErrorResponse(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		utils.SendErrorResponse(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	rotated, err := session.Rotate(h.DB, utils.HashToken(refreshToken), time.Now().Add(utils.RefreshTokenTTL()), utils.ClientIP(r))
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !rotated {
+		// Another request rotated (or revoked) the session first
+		utils.SendErrorResponse(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := issueTokens(user, session, refreshToken)
+	if err != nil {
+		utils.SendErrorResponse(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Token refreshed successfully", tokens, http.StatusOK)
+}
+
+// Logout revokes the session a refresh token belongs to
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := parseRefreshTokenRequest(r)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		utils.SendErrorResponse(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	session, err := models.GetSessionByRefreshTokenHash(h.DB, utils.HashToken(req.RefreshToken))
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Logging out an unknown or already revoked session is not an error
+	if session != nil {
+		if _, err := models.RevokeSession(h.DB, session.ID, session.UserID); err != nil {
+			utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	utils.SendSuccessResponse(w, "Logged out successfully", nil, http.StatusOK)
+}
+
+// ListSessions returns the authenticated user's active sessions (one per device)
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := models.GetActiveSessionsByUserID(h.DB, userID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	currentID := r.Header.Get("X-Session-ID")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.String() == currentID
+	}
+
+	utils.SendSuccessResponse(w, "Sessions retrieved successfully", sessions, http.StatusOK)
+}
+
+// RevokeSession signs out one of the authenticated user's devices
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionIDStr := r.URL.Query().Get("id")
+	if sessionIDStr == "" {
+		utils.SendErrorResponse(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		utils.SendErrorResponse(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := models.RevokeSession(h.DB, sessionID, userID)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		utils.SendErrorResponse(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Session revoked successfully", nil, http.StatusOK)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// loanStatement posts installments that have fallen due and builds the statement of a
+// disbursed request, writing the error response itself when that fails
+func loanStatement(w http.ResponseWriter, db *sql.DB, request *models.FinancingRequest) (*models.LoanStatement, bool) {
+	if request.Status != models.FinancingStatusDisbursed {
+		utils.SendErrorResponse(w, "A statement is available once the loan is disbursed", http.StatusConflict)
+		return nil, false
+	}
+
+	if _, err := models.AccrueDueInstallments(db, request.ID, time.Now().UTC()); err != nil {
+		log.Printf("Failed to post due installments for %s: %v", request.ID, err)
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	statement, err := models.GetLoanStatement(db, request.ID, request.Currency)
+	if err != nil {
+		utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return statement, true
+}
+
+// GetStatement returns the statement of the caller's disbursed loan
+func (h *FinancingHandler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.SendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.getUserIDFromRequest(r)
+	if err != nil || userID == uuid.Nil {
+		utils.SendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := h.loadOwnedFinancingRequest(w, r, userID)
+	if request == nil {
+		return
+	}
+
+	statement, ok := loanStatement(w, h.DB, request)
+	if !ok {
+		return
+	}
+
+	utils.SendSuccessResponse(w, "Loan statement retrieved successfully", statement, http.StatusOK)
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"sme_fin_backend/filescan"
+	"sme_fin_backend/models"
+	"sme_fin_backend/storage"
+	"sme_fin_backend/utils"
+)
+
+const (
+	// maxUploadSize is the largest file accepted, enforced while the file streams in
+	maxUploadSize = 10 << 20
+	// maxFormValueBytes bounds the text fields of a streamed multipart form
+	maxFormValueBytes = 1 << 20
+)
+
+// allowedUploadTypes are the file extensions accepted for documents
+var allowedUploadTypes = []string{"pdf", "jpg", "jpeg", "png"}
+
+// storedUpload is a file streamed to storage
+type storedUpload struct {
+	Key         string
+	Filename    string
+	ContentType string
+	Size        int64
+	SHA256      string           // hex digest of the content
+	Scan        *filescan.Result // nil when the file could not be scanned and stays in quarantine
+}
+
+// uploadError is a rejected upload, with the response to send
+type uploadError struct {
+	Status  int
+	Message string
+}
+
+func (e *uploadError) Error() string {
+	return e.Message
+}
+
+var errUploadTooLarge = &uploadError{
+	Status:  http.StatusBadRequest,
+	Message: fmt.Sprintf("File size exceeds %dMB limit", maxUploadSize>>20),
+}
+
+// parseUploadForm reads a multipart form part by part. Text fields are collected as usual, so
+// getFormValue works on them. The file in fileField is streamed to storage
+// while it is received, instead of being buffered, and returned; it is nil if none was sent.
+// It writes the error response and reports false if the form or the file is rejected.
+func (h *UserHandler) parseUploadForm(w http.ResponseWriter, r *http.Request, fileField string) (*storedUpload, bool) {
+	var upload *storedUpload
+	err := readUploadForm(r, func(part *multipart.Part) error {
+		if part.FormName() != fileField || upload != nil {
+			return nil // other files are skipped
+		}
+		var err error
+		upload, err = h.streamUpload(r.Context(), part, part.FileName())
+		return err
+	})
+	if err == nil {
+		return upload, true
+	}
+
+	// The form was cut short after the file was stored
+	if upload != nil {
+		h.deleteUpload(upload.Key)
+	}
+	var rejected *uploadError
+	if errors.As(err, &rejected) {
+		utils.SendErrorResponse(w, rejected.Message, rejected.Status)
+	} else {
+		utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+	}
+	return nil, false
+}
+
+// readUploadForm reads the multipart body of r, collecting text fields into r.Form, r.PostForm
+// and r.MultipartForm the way ParseMultipartForm does, and handing each file part to onFile
+func readUploadForm(r *http.Request, onFile func(part *multipart.Part) error) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	// Only parses the query string of a multipart request
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	form := &multipart.Form{Value: map[string][]string{}, File: map[string][]*multipart.FileHeader{}}
+	r.MultipartForm = form
+
+	remaining := int64(maxFormValueBytes)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		if part.FileName() != "" {
+			if err := onFile(part); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, remaining+1))
+		if err != nil {
+			return err
+		}
+		remaining -= int64(len(value))
+		if remaining < 0 {
+			return errors.New("multipart: form fields too large")
+		}
+		form.Value[name] = append(form.Value[name], string(value))
+		r.Form[name] = append(r.Form[name], string(value))
+		r.PostForm[name] = append(r.PostForm[name], string(value))
+	}
+}
+
+// streamUpload validates, scans and stores a file as it is read from src. The content goes
+// through pipes to the storage backend, the content checks and the malware scanner at once,
+// while its size and SHA-256 digest are computed, so only small buffers are held in memory.
+// A file that is rejected on the way, or turns out too large, infected or malformed at the
+// end, is deleted again.
+func (h *UserHandler) streamUpload(ctx context.Context, src io.Reader, filename string) (*storedUpload, error) {
+	if !utils.ValidateFileType(filename, allowedUploadTypes) {
+		return nil, &uploadError{http.StatusBadRequest, "Invalid file type. Only PDF, JPG, and PNG files are allowed"}
+	}
+	if h.Storage == nil {
+		return nil, &uploadError{http.StatusInternalServerError, "File storage is not configured"}
+	}
+
+	// The content type is known before anything is stored
+	head := make([]byte, filescan.SniffLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, &uploadError{http.StatusBadRequest, "Failed to read file"}
+	}
+	head = head[:n]
+	contentType, err := filescan.CheckType(head, filename)
+	if err != nil {
+		return nil, &uploadError{http.StatusBadRequest, "Invalid file: " + err.Error()}
+	}
+
+	upload := &storedUpload{Key: storage.NewObjectKey(filename), Filename: filename, ContentType: contentType}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var pipes []*io.PipeWriter
+	// consume runs fn on a pipe fed with the file. Closing the reader with fn's error makes
+	// the writes fail, which stops the upload as soon as one consumer gives up.
+	consume := func(fn func(r io.Reader) error) io.Writer {
+		pr, pw := io.Pipe()
+		pipes = append(pipes, pw)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pr.CloseWithError(fn(pr))
+		}()
+		return pw
+	}
+
+	var putErr, validateErr error
+	hash := sha256.New()
+	writers := []io.Writer{
+		hash,
+		consume(func(r io.Reader) error {
+			putErr = h.Storage.Put(ctx, upload.Key, r, -1, contentType)
+			return putErr
+		}),
+		consume(func(r io.Reader) error {
+			_, validateErr = filescan.ValidateReader(r, filename)
+			return validateErr
+		}),
+	}
+	if h.Scanner != nil {
+		writers = append(writers, consume(func(r io.Reader) error {
+			upload.Scan = h.scanUpload(ctx, r)
+			// A failed scan must not stop the upload; the file stays in quarantine
+			_, err := io.Copy(io.Discard, r)
+			return err
+		}))
+	}
+
+	source := &sourceReader{r: src}
+	body := &io.LimitedReader{R: io.MultiReader(bytes.NewReader(head), source), N: maxUploadSize + 1}
+	upload.Size, err = io.Copy(io.MultiWriter(writers...), body)
+	if err == nil && upload.Size > maxUploadSize {
+		err = errUploadTooLarge
+	}
+	for _, pw := range pipes {
+		pw.CloseWithError(err)
+	}
+	wg.Wait()
+
+	// A consumer that gave up closed its pipe with its error, which the copy returned; the
+	// others then failed on the closed pipe, as they do when reading the file fails. Errors
+	// found at the end of the file come last.
+	cause := err
+	if cause == nil {
+		if validateErr != nil {
+			cause = validateErr
+		} else if putErr != nil {
+			cause = putErr
+		}
+	}
+	switch {
+	case cause == nil:
+		if upload.Scan != nil && upload.Scan.Infected {
+			log.Printf("Rejected upload %q: malware detected (%s)", filename, upload.Scan.Signature)
+			err = &uploadError{http.StatusUnprocessableEntity, "The file failed the malware scan"}
+		}
+	case cause == errUploadTooLarge:
+		err = errUploadTooLarge
+	case source.err != nil:
+		err = &uploadError{http.StatusBadRequest, "Failed to read file"}
+	case cause == validateErr:
+		err = &uploadError{http.StatusBadRequest, "Invalid file: " + validateErr.Error()}
+	case cause == putErr:
+		log.Printf("Failed to upload file: %v", putErr)
+		err = &uploadError{http.StatusInternalServerError, "Failed to upload file: " + putErr.Error()}
+	default:
+		err = &uploadError{http.StatusBadRequest, "Failed to read file"}
+	}
+	if err != nil {
+		if putErr == nil {
+			h.deleteUpload(upload.Key)
+		}
+		return nil, err
+	}
+
+	upload.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return upload, nil
+}
+
+// sourceReader keeps the read error of an uploaded file, to tell it apart from the errors of
+// the consumers
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// scanUpload scans a file while it is uploaded. It returns nil when the scan fails; the daily
+// job rescans such files.
+func (h *UserHandler) scanUpload(ctx context.Context, r io.Reader) *filescan.Result {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := h.Scanner.Scan(ctx, r)
+	if err != nil {
+		log.Printf("Malware scan failed, keeping upload in quarantine: %v", err)
+		return nil
+	}
+	return result
+}
+
+// scanStatus is the scan state a saved upload starts in: clean if it was scanned clean while
+// it was uploaded, or pending until the daily job rescans it
+func (u *storedUpload) scanStatus() string {
+	if u.Scan != nil && !u.Scan.Infected {
+		return models.ScanStatusClean
+	}
+	return models.ScanStatusPending
+}
+
+// fileFields are the registration step fields of a saved upload
+func (u *storedUpload) fileFields() map[string]string {
+	return map[string]string{"filename": u.Filename, "object_key": u.Key, "file_size": strconv.FormatInt(u.Size, 10),
+		"sha256": u.SHA256, "scan_status": u.scanStatus()}
+}
+
+// deleteUpload removes a stored file that was rejected, whose database record could not be
+// saved, or that a save replaced. It runs even when the request was cancelled.
+func (h *UserHandler) deleteUpload(key string) {
+	if h.Storage == nil {
+		log.Printf("Cannot delete orphaned upload %s: file storage is not configured", key)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.Storage.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete orphaned upload %s: %v", key, err)
+	}
+}
@@ -3,12 +3,12 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
+	"sme_fin_backend/filescan"
 	"sme_fin_backend/models"
 	"sme_fin_backend/storage"
 	"sme_fin_backend/utils"
@@ -17,7 +17,9 @@ import (
 )
 
 type UserHandler struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Storage storage.Backend  // nil rejects file uploads
+	Scanner filescan.Scanner // nil keeps uploads in quarantine until the daily job scans them
 }
 
 type PersonalDetailsRequest struct {
@@ -29,11 +31,50 @@ type PersonalDetailsRequest struct {
 type BusinessDetailsRequest struct {
 	BusinessName       string `json:"business_name"`
 	TradeLicenseNumber string `json:"trade_license_number"`
+	EstablishedOn      string `json:"established_on"` // optional, YYYY-MM-DD
 }
 
 type TradeLicenseRequest struct {
-	Filename string `json:"filename"`
-	FileURL  string `json:"file_url"`
+	Filename         string `json:"filename"`
+	FileURL          string `json:"file_url"`
+	IssuedOn         string `json:"issued_on"`  // YYYY-MM-DD
+	ExpiresOn        string `json:"expires_on"` // YYYY-MM-DD; last day the license is valid
+	IssuingAuthority string `json:"issuing_authority"`
+}
+
+// readLicenseDetails reads the validity fields of a trade license from a form
+func readLicenseDetails(r *http.Request, req *TradeLicenseRequest) {
+	req.IssuedOn = getFormValue(r, "trade[issued_on]", "trade_issued_on", "issued_on")
+	req.ExpiresOn = getFormValue(r, "trade[expires_on]", "trade_expires_on", "expires_on")
+	req.IssuingAuthority = getFormValue(r, "trade[issuing_authority]", "trade_issuing_authority", "issuing_authority")
+}
+
+// parseLicenseDates validates the issue and expiry dates of a trade license. It returns the
+// error message if either is invalid, or if the license has already expired. Empty dates are
+// accepted; callers that save the license require them.
+func parseLicenseDates(issuedOn, expiresOn string) (*time.Time, *time.Time, string) {
+	var issued, expires *time.Time
+	if issuedOn != "" {
+		date, err := time.Parse("2006-01-02", issuedOn)
+		if err != nil || date.After(time.Now()) {
+			return nil, nil, "Invalid issue date. Use a past date in YYYY-MM-DD format"
+		}
+		issued = &date
+	}
+	if expiresOn != "" {
+		date, err := time.Parse("2006-01-02", expiresOn)
+		if err != nil {
+			return nil, nil, "Invalid expiry date. Use YYYY-MM-DD format"
+		}
+		if issued != nil && !date.After(*issued) {
+			return nil, nil, "The expiry date must be after the issue date"
+		}
+		if expiresOn < time.Now().UTC().Format("2006-01-02") {
+			return nil, nil, "The trade license has already expired. Please upload the renewed license"
+		}
+		expires = &date
+	}
+	return issued, expires, ""
 }
 
 // FullRegistrationRequest groups all onboarding data into a single payload.
@@ -181,13 +222,22 @@ func (h *UserHandler) FullRegistration(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req FullRegistrationRequest
+	// The trade license file is streamed to storage as it arrives and deleted again unless
+	// the registration is saved
+	var upload *storedUpload
+	saved := false
+	defer func() {
+		if upload != nil && !saved {
+			h.deleteUpload(upload.Key)
+		}
+	}()
 
 	// Parse form-data or JSON
 	contentType := r.Header.Get("Content-Type")
 	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
 		if strings.HasPrefix(contentType, "multipart/form-data") {
-			if err := r.ParseMultipartForm(32 << 20); err != nil {
-				utils.SendErrorResponse(w, "Invalid form data", http.StatusBadRequest)
+			var ok bool
+			if upload, ok = h.parseUploadForm(w, r, "trade[file]"); !ok {
 				return
 			}
 		} else {
@@ -204,51 +254,15 @@ func (h *UserHandler) FullRegistration(w http.ResponseWriter, r *http.Request) {
 
 		req.Business.BusinessName = getFormValue(r, "business[business_name]", "business_business_name", "business_name")
 		req.Business.TradeLicenseNumber = getFormValue(r, "business[trade_license_number]", "business_trade_license_number", "trade_license_number")
+		req.Business.EstablishedOn = getFormValue(r, "business[established_on]", "business_established_on", "established_on")
 
-		// Handle file upload for trade license if present
-		if strings.HasPrefix(contentType, "multipart/form-data") {
-			file, fileHeader, err := r.FormFile("trade[file]")
-			if err == nil && file != nil {
-				defer file.Close()
-				
-				// Validate file type (PDF, JPG, PNG)
-				allowedTypes := []string{"pdf", "jpg", "jpeg", "png"}
-				if !utils.ValidateFileType(fileHeader.Filename, allowedTypes) {
-					utils.SendErrorResponse(w, "Invalid file type. Only PDF, JPG, and PNG files are allowed", http.StatusBadRequest)
-					return
-				}
-				
-				// Validate file size (max 10MB)
-				maxSizeMB := 10
-				if !utils.ValidateFileSize(fileHeader.Size, maxSizeMB) {
-					utils.SendErrorResponse(w, fmt.Sprintf("File size exceeds %dMB limit", maxSizeMB), http.StatusBadRequest)
-					return
-				}
-				
-				req.Trade.Filename = fileHeader.Filename
-
-				// Upload to Supabase storage
-				bucketName := os.Getenv("SUPABASE_BUCKET_NAME")
-				if bucketName == "" {
-					bucketName = "vercel_bucket" // Default bucket name
-				}
-
-				fileURL, uploadErr := storage.UploadFileToSupabase(file, fileHeader.Filename, bucketName)
-				if uploadErr != nil {
-					log.Printf("Failed to upload file to Supabase: %v", uploadErr)
-					utils.SendErrorResponse(w, fmt.Sprintf("Failed to upload file: %v", uploadErr), http.StatusInternalServerError)
-					return
-				}
-				req.Trade.FileURL = fileURL
-			} else {
-				// Fallback to form values
-				req.Trade.Filename = getFormValue(r, "trade[filename]", "trade_filename", "filename")
-				req.Trade.FileURL = getFormValue(r, "trade[file_url]", "trade_file_url", "file_url")
-			}
+		if upload != nil {
+			req.Trade.Filename = upload.Filename
 		} else {
 			req.Trade.Filename = getFormValue(r, "trade[filename]", "trade_filename", "filename")
 			req.Trade.FileURL = getFormValue(r, "trade[file_url]", "trade_file_url", "file_url")
 		}
+		readLicenseDetails(r, &req.Trade)
 	} else {
 		// JSON fallback
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -288,50 +302,82 @@ func (h *UserHandler) FullRegistration(w http.ResponseWriter, r *http.Request) {
 		utils.SendErrorResponse(w, "Trade license number is required", http.StatusBadRequest)
 		return
 	}
+	var establishedOn *time.Time
+	if req.Business.EstablishedOn != "" {
+		date, err := time.Parse("2006-01-02", req.Business.EstablishedOn)
+		if err != nil || date.After(time.Now()) {
+			utils.SendErrorResponse(w, "Invalid establishment date. Use a past date in YYYY-MM-DD format", http.StatusBadRequest)
+			return
+		}
+		establishedOn = &date
+	}
 
 	// Validate trade license
 	if req.Trade.Filename == "" {
 		utils.SendErrorResponse(w, "Filename is required", http.StatusBadRequest)
 		return
 	}
-	if req.Trade.FileURL == "" {
+	if req.Trade.FileURL == "" && upload == nil {
 		utils.SendErrorResponse(w, "File URL is required (or upload a file)", http.StatusBadRequest)
 		return
 	}
+	if strings.TrimSpace(req.Trade.IssuedOn) == "" {
+		utils.SendErrorResponse(w, "Trade license issue date is required", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Trade.ExpiresOn) == "" {
+		utils.SendErrorResponse(w, "Trade license expiry date is required", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Trade.IssuingAuthority) == "" {
+		utils.SendErrorResponse(w, "Trade license issuing authority is required", http.StatusBadRequest)
+		return
+	}
+	issuedOn, expiresOn, message := parseLicenseDates(strings.TrimSpace(req.Trade.IssuedOn), strings.TrimSpace(req.Trade.ExpiresOn))
+	if message != "" {
+		utils.SendErrorResponse(w, message, http.StatusBadRequest)
+		return
+	}
 
-	// Persist personal details
 	personalDetails := &models.PersonalDetails{
 		UserID:      userID,
 		FullName:    req.Personal.FullName,
 		Email:       req.Personal.Email,
 		PhoneNumber: req.Personal.PhoneNumber,
 	}
-	if err := personalDetails.CreateOrUpdate(h.DB); err != nil {
-		utils.SendErrorResponse(w, "Failed to save personal details", http.StatusInternalServerError)
-		return
-	}
-
-	// Persist business details
 	businessDetails := &models.BusinessDetails{
 		UserID:             userID,
 		BusinessName:       req.Business.BusinessName,
 		TradeLicenseNumber: req.Business.TradeLicenseNumber,
+		EstablishedOn:      establishedOn,
 	}
-	if err := businessDetails.CreateOrUpdate(h.DB); err != nil {
-		utils.SendErrorResponse(w, "Failed to save business details", http.StatusInternalServerError)
-		return
-	}
-
-	// Persist trade license
 	tradeLicense := &models.TradeLicense{
-		UserID:   userID,
-		Filename: req.Trade.Filename,
-		FileURL:  req.Trade.FileURL,
-	}
-	if err := tradeLicense.CreateOrUpdate(h.DB); err != nil {
-		utils.SendErrorResponse(w, "Failed to save trade license", http.StatusInternalServerError)
+		UserID:           userID,
+		Filename:         req.Trade.Filename,
+		FileURL:          req.Trade.FileURL,
+		IssuedOn:         issuedOn,
+		ExpiresOn:        expiresOn,
+		IssuingAuthority: strings.TrimSpace(req.Trade.IssuingAuthority),
+	}
+	if upload != nil {
+		tradeLicense.ObjectKey = upload.Key
+		tradeLicense.FileSize = &upload.Size
+		tradeLicense.SHA256 = upload.SHA256
+		tradeLicense.ScanStatus = upload.scanStatus()
+	}
+
+	// Persist all three or nothing
+	orphaned, err := models.SaveRegistration(h.DB, personalDetails, businessDetails, tradeLicense)
+	if err != nil {
+		log.Printf("Failed to save registration for %s: %v", userID, err)
+		utils.SendErrorResponse(w, "Failed to save registration", http.StatusInternalServerError)
 		return
 	}
+	saved = true
+	// Files uploaded to the drafts that this registration replaced
+	for _, key := range orphaned {
+		h.deleteUpload(key)
+	}
 
 	// Fetch status and summary
 	accountStatus, err := models.GetAccountStatus(h.DB, userID)
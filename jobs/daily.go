@@ -0,0 +1,162 @@
+// Package jobs runs the scheduled back-office work: expiring offers, keeping disbursed
+// loans, their overdue installments and the collections queue up to date, rescanning
+// quarantined uploads, removing abandoned resumable uploads and registration drafts, and
+// reminding businesses of expiring trade licenses.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/models"
+	"sme_fin_backend/notify"
+)
+
+// dailyLockKey is the Postgres advisory lock held while the daily job runs
+const dailyLockKey = 5_170_016
+
+// ErrAlreadyRunning is returned when another instance holds the daily job lock
+var ErrAlreadyRunning = errors.New("daily job is already running")
+
+// Report summarises one run of the daily job
+type Report struct {
+	Date                 string `json:"date"` // YYYY-MM-DD
+	OffersExpired        int64  `json:"offers_expired"`
+	LoansChecked         int    `json:"loans_checked"`
+	InstallmentsPosted   int    `json:"installments_posted"`
+	InstallmentsOverdue  int    `json:"installments_overdue"`
+	LateFeesCharged      int    `json:"late_fees_charged"`
+	CasesOpened          int    `json:"cases_opened"`
+	CasesResolved        int    `json:"cases_resolved"`
+	PromisesBroken       int    `json:"promises_broken"`
+	DocumentsScanned     int    `json:"documents_scanned"`
+	DocumentsInfected    int    `json:"documents_infected"`
+	UploadsExpired       int    `json:"uploads_expired"`
+	DraftsExpired        int    `json:"drafts_expired"`
+	LicensesExpiring     int    `json:"licenses_expiring"` // newly flagged
+	LicensesExpired      int    `json:"licenses_expired"`  // newly flagged
+	LicenseRemindersSent int    `json:"license_reminders_sent"`
+	Failures             int    `json:"failures"` // loans, documents, uploads or reminders that could not be processed; see the logs
+}
+
+// RunDaily runs the daily job as of a day. Each loan is updated in its own transaction, so a
+// failing loan does not hold up the others, and running twice on the same day is harmless.
+// Without a notifier no license reminders are sent.
+func RunDaily(db *sql.DB, asOf time.Time, policy loan.LateFeePolicy, files Files, notifier notify.Notifier) (*Report, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, dailyLockKey).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrAlreadyRunning
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, dailyLockKey)
+
+	asOf = asOf.UTC()
+	report := &Report{Date: asOf.Format("2006-01-02")}
+
+	if report.OffersExpired, err = models.ExpireLoanOffers(db); err != nil {
+		return nil, fmt.Errorf("expiring offers: %w", err)
+	}
+
+	loanIDs, err := models.GetLoansToMonitor(db, asOf)
+	if err != nil {
+		return nil, fmt.Errorf("listing loans: %w", err)
+	}
+
+	for _, id := range loanIDs {
+		report.LoansChecked++
+		result, err := models.UpdateDelinquency(db, id, asOf, policy)
+		if err != nil {
+			log.Printf("Daily job: failed to update loan %s: %v", id, err)
+			report.Failures++
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		report.InstallmentsPosted += result.InstallmentsPosted
+		report.InstallmentsOverdue += result.InstallmentsOverdue
+		report.LateFeesCharged += result.LateFeesCharged
+		if result.CaseOpened {
+			report.CasesOpened++
+		}
+		if result.CaseResolved {
+			report.CasesResolved++
+		}
+		if result.PromiseBroken {
+			report.PromisesBroken++
+		}
+	}
+
+	if err := scanPendingDocuments(db, files, report); err != nil {
+		return nil, fmt.Errorf("scanning documents: %w", err)
+	}
+	if err := expireResumableUploads(db, asOf, files, report); err != nil {
+		return nil, fmt.Errorf("expiring uploads: %w", err)
+	}
+	if err := expireRegistrationDrafts(db, asOf, files, report); err != nil {
+		return nil, fmt.Errorf("expiring registration drafts: %w", err)
+	}
+	if err := flagExpiringLicenses(db, asOf, notifier, report); err != nil {
+		return nil, fmt.Errorf("flagging expiring licenses: %w", err)
+	}
+
+	return report, nil
+}
+
+// Hour returns the UTC hour at which the local scheduler runs the daily job (DAILY_JOB_HOUR,
+// default 2). It returns -1 when DAILY_JOB_HOUR is "off".
+func Hour() (int, error) {
+	value := os.Getenv("DAILY_JOB_HOUR")
+	if value == "" {
+		return 2, nil
+	}
+	if value == "off" {
+		return -1, nil
+	}
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("DAILY_JOB_HOUR: must be an hour between 0 and 23, or off")
+	}
+	return hour, nil
+}
+
+// Schedule runs the daily job every day at the given UTC hour. It never returns; start it in
+// its own goroutine. Deployments without a long-running process use the cron endpoint instead.
+func Schedule(db *sql.DB, hour int, files Files, notifier notify.Notifier) {
+	for {
+		now := time.Now().UTC()
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		time.Sleep(time.Until(next))
+
+		policy, err := loan.LateFeePolicyFromEnv()
+		if err != nil {
+			log.Printf("Daily job: invalid late fee policy: %v", err)
+			continue
+		}
+		report, err := RunDaily(db, time.Now(), policy, files, notifier)
+		if err != nil {
+			log.Printf("Daily job failed: %v", err)
+			continue
+		}
+		log.Printf("Daily job finished: %+v", *report)
+	}
+}
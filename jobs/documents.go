@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"sme_fin_backend/filescan"
+	"sme_fin_backend/models"
+	"sme_fin_backend/storage"
+
+	"github.com/google/uuid"
+)
+
+// scanBatchSize bounds how many quarantined files one run rescans
+const scanBatchSize = 100
+
+// Files is the file storage and malware scanner the daily job uses to rescan uploads left in
+// quarantine, because the scanner was unavailable when they were uploaded, and to remove
+// abandoned resumable uploads and registration drafts. Without a Scanner the rescan is skipped.
+type Files struct {
+	Storage storage.Backend
+	Scanner filescan.Scanner
+}
+
+// scanPendingDocuments rescans quarantined documents, trade licenses included. Clean files are
+// released; infected ones are marked and deleted from storage.
+func scanPendingDocuments(db *sql.DB, files Files, report *Report) error {
+	if files.Scanner == nil || files.Storage == nil {
+		return nil
+	}
+	documents, err := models.GetBusinessDocumentsPendingScan(db, scanBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, d := range documents {
+		rescan(files, report, d.DocumentType, d.ID, d.ObjectKey, func(infected bool, signature string) error {
+			return models.RecordBusinessDocumentScan(db, d.ID, infected, signature)
+		})
+	}
+	return nil
+}
+
+// rescan scans one quarantined file and stores the result with record
+func rescan(files Files, report *Report, kind string, id uuid.UUID, key string, record func(infected bool, signature string) error) {
+	result, err := scanObject(files, key)
+	if err != nil {
+		log.Printf("Daily job: failed to scan %s %s: %v", kind, id, err)
+		report.Failures++
+		return
+	}
+	if err := record(result.Infected, result.Signature); err != nil {
+		log.Printf("Daily job: failed to record scan of %s %s: %v", kind, id, err)
+		report.Failures++
+		return
+	}
+	report.DocumentsScanned++
+	if result.Infected {
+		report.DocumentsInfected++
+		log.Printf("Daily job: %s %s is infected (%s)", kind, id, result.Signature)
+		if err := files.Storage.Delete(context.Background(), key); err != nil {
+			log.Printf("Daily job: failed to delete infected file %s: %v", key, err)
+		}
+	}
+}
+
+func scanObject(files Files, key string) (*filescan.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	body, _, err := files.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return files.Scanner.Scan(ctx, body)
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/utils"
+)
+
+// draftExpiry is how long a registration draft may sit untouched before the daily job removes
+// it (REGISTRATION_DRAFT_EXPIRY_DAYS, default 30)
+func draftExpiry() time.Duration {
+	return time.Duration(utils.GetEnvInt("REGISTRATION_DRAFT_EXPIRY_DAYS", 30)) * 24 * time.Hour
+}
+
+// expireRegistrationDrafts removes registration drafts abandoned past their expiry and deletes
+// the files uploaded to them
+func expireRegistrationDrafts(db *sql.DB, asOf time.Time, files Files, report *Report) error {
+	count, keys, err := models.ExpireRegistrationDrafts(db, asOf.Add(-draftExpiry()), expireBatchSize)
+	if err != nil {
+		return err
+	}
+
+	report.DraftsExpired = count
+	if files.Storage == nil {
+		return nil
+	}
+	for _, key := range keys {
+		if err := files.Storage.Delete(context.Background(), key); err != nil {
+			log.Printf("Daily job: failed to delete file %s of an expired draft: %v", key, err)
+		}
+	}
+	return nil
+}
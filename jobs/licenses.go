@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"sme_fin_backend/models"
+	"sme_fin_backend/notify"
+)
+
+// flagExpiringLicenses flags the trade licenses that expire within
+// models.LicenseExpiryWarningDays or have expired, and reminds their owners on each of
+// models.LicenseReminderDays. A run that missed a reminder day sends only the latest one due.
+// Without a notifier the licenses are flagged and the reminders wait for a later run.
+func flagExpiringLicenses(db *sql.DB, asOf time.Time, notifier notify.Notifier, report *Report) error {
+	today := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	licenses, err := models.GetTradeLicensesExpiringBy(db, today.AddDate(0, 0, models.LicenseExpiryWarningDays))
+	if err != nil {
+		return err
+	}
+
+	for _, l := range licenses {
+		expiresOn := time.Date(l.ExpiresOn.Year(), l.ExpiresOn.Month(), l.ExpiresOn.Day(), 0, 0, 0, 0, time.UTC)
+		daysLeft := int(expiresOn.Sub(today).Hours() / 24)
+
+		status := models.LicenseExpiryExpiring
+		if daysLeft < 0 {
+			status = models.LicenseExpiryExpired
+		}
+		// The reminder due is the last reminder day reached
+		due := -1
+		for _, days := range models.LicenseReminderDays {
+			if daysLeft <= days {
+				due = days
+			}
+		}
+
+		var sent *int
+		if due >= 0 && (l.ReminderDays == nil || *l.ReminderDays > due) && notifier != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := notifier.Send(ctx, licenseReminder(l, daysLeft))
+			cancel()
+			if err != nil {
+				log.Printf("Daily job: failed to send expiry reminder for trade license %s: %v", l.ID, err)
+				report.Failures++
+			} else {
+				sent = &due
+				report.LicenseRemindersSent++
+			}
+		}
+
+		if status == l.ExpiryStatus && sent == nil {
+			continue
+		}
+		if err := models.FlagTradeLicenseExpiry(db, l.ID, l.ExpiresOn, status, sent); err != nil {
+			log.Printf("Daily job: failed to flag trade license %s: %v", l.ID, err)
+			report.Failures++
+			continue
+		}
+		if status != l.ExpiryStatus {
+			if status == models.LicenseExpiryExpired {
+				report.LicensesExpired++
+			} else {
+				report.LicensesExpiring++
+			}
+		}
+	}
+	return nil
+}
+
+// licenseReminder is the renewal reminder for a license expiring in daysLeft days
+func licenseReminder(l models.LicenseExpiry, daysLeft int) notify.Message {
+	license := "Your trade license"
+	if l.IssuingAuthority != "" {
+		license = fmt.Sprintf("Your trade license issued by %s", l.IssuingAuthority)
+	}
+	date := l.ExpiresOn.Format("2 January 2006")
+
+	var subject, body string
+	switch {
+	case daysLeft < 0:
+		subject = "Your trade license has expired"
+		body = fmt.Sprintf("%s expired on %s. New financing requests are on hold until you upload the renewed license in the SMEfin app.",
+			license, date)
+	case daysLeft == 0:
+		subject = "Your trade license expires today"
+		body = fmt.Sprintf("%s expires today, %s. Upload the renewed license in the SMEfin app to keep requesting financing.",
+			license, date)
+	case daysLeft == 1:
+		subject = "Your trade license expires tomorrow"
+		body = fmt.Sprintf("%s expires tomorrow, %s. Upload the renewed license in the SMEfin app to keep requesting financing.",
+			license, date)
+	default:
+		subject = fmt.Sprintf("Your trade license expires in %d days", daysLeft)
+		body = fmt.Sprintf("%s expires on %s. Upload the renewed license in the SMEfin app before then to keep requesting financing.",
+			license, date)
+	}
+	return notify.Message{To: l.Email, Subject: subject, Body: body}
+}
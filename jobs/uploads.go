@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"sme_fin_backend/models"
+)
+
+// expireBatchSize bounds how many abandoned uploads one run removes
+const expireBatchSize = 500
+
+// expireResumableUploads marks resumable uploads that sat idle past their expiry as expired
+// and deletes the chunks they left in storage
+func expireResumableUploads(db *sql.DB, asOf time.Time, files Files, report *Report) error {
+	uploads, err := models.GetExpiredResumableUploads(db, asOf, expireBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, upload := range uploads {
+		keys, err := models.ExpireResumableUpload(db, upload.ID, asOf)
+		if err != nil {
+			log.Printf("Daily job: failed to expire upload %s: %v", upload.ID, err)
+			report.Failures++
+			continue
+		}
+		report.UploadsExpired++
+		if files.Storage == nil {
+			continue
+		}
+		for _, key := range keys {
+			if err := files.Storage.Delete(context.Background(), key); err != nil {
+				log.Printf("Daily job: failed to delete chunk %s of upload %s: %v", key, upload.ID, err)
+			}
+		}
+	}
+	return nil
+}
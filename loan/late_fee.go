@@ -0,0 +1,68 @@
+package loan
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"sme_fin_backend/money"
+)
+
+// LateFeePolicy decides when an unpaid installment becomes overdue and what it is charged.
+// The fee is charged once per installment, when it becomes overdue.
+type LateFeePolicy struct {
+	GraceDays  int                    `json:"grace_days"`  // days after the due date before an installment is overdue
+	Flat       map[string]money.Money `json:"flat"`        // fixed part per loan currency; none when missing
+	PercentBps int                    `json:"percent_bps"` // share of the unpaid installment amount
+}
+
+// LateFeePolicyFromEnv reads LATE_FEE_GRACE_DAYS (default 5), LATE_FEE_FLAT (in the default
+// currency, default 0), LATE_FEE_FLAT_<CURRENCY> (e.g. LATE_FEE_FLAT_USD, default 0) and
+// LATE_FEE_PERCENT (percent of the unpaid installment, default 2)
+func LateFeePolicyFromEnv() (LateFeePolicy, error) {
+	policy := LateFeePolicy{GraceDays: 5, Flat: map[string]money.Money{}, PercentBps: 2_00}
+
+	if value := os.Getenv("LATE_FEE_GRACE_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return LateFeePolicy{}, fmt.Errorf("LATE_FEE_GRACE_DAYS: must be a non-negative number of days")
+		}
+		policy.GraceDays = days
+	}
+	// The flat fee is an amount of money, so it is set per currency
+	flat := map[string]string{money.DefaultCurrency(): os.Getenv("LATE_FEE_FLAT")}
+	for _, code := range money.CurrencyCodes() {
+		if value := os.Getenv("LATE_FEE_FLAT_" + code); value != "" {
+			flat[code] = value
+		}
+	}
+	for code, value := range flat {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		amount, err := money.Parse(value, code)
+		if err != nil || amount.Minor < 0 {
+			return LateFeePolicy{}, fmt.Errorf("LATE_FEE_FLAT (%s): must be a non-negative amount", code)
+		}
+		policy.Flat[code] = amount
+	}
+	if value := os.Getenv("LATE_FEE_PERCENT"); value != "" {
+		bps, err := ParseRate(value)
+		if err != nil {
+			return LateFeePolicy{}, fmt.Errorf("LATE_FEE_PERCENT: %w", err)
+		}
+		policy.PercentBps = bps
+	}
+
+	return policy, nil
+}
+
+// Fee returns the late fee for an installment with the given unpaid amount. Currencies without
+// a flat fee are charged the percentage only.
+func (p LateFeePolicy) Fee(unpaid money.Money) (money.Money, error) {
+	flat := p.Flat[unpaid.Currency]
+	percent := roundDiv(unpaid.Minor*int64(p.PercentBps), 10000)
+	return money.New(flat.Minor+percent, unpaid.Currency), nil
+}
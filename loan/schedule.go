@@ -0,0 +1,265 @@
+package loan
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sme_fin_backend/money"
+)
+
+// Method is how interest is charged over the life of a loan
+type Method string
+
+const (
+	// MethodFlat charges interest on the original principal for every month
+	MethodFlat Method = "flat"
+	// MethodReducingBalance charges interest on the outstanding balance (equal monthly payments)
+	MethodReducingBalance Method = "reducing_balance"
+)
+
+// ParseMethod accepts "flat", "reducing_balance" or "reducing"
+func ParseMethod(s string) (Method, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "flat":
+		return MethodFlat, true
+	case "reducing_balance", "reducing":
+		return MethodReducingBalance, true
+	}
+	return "", false
+}
+
+// Pricing is the price of a loan. Rates are in basis points (1250 = 12.50%).
+type Pricing struct {
+	AnnualRateBps    int    `json:"annual_rate_bps"`
+	Method           Method `json:"method"`
+	ProcessingFeeBps int    `json:"processing_fee_bps"` // charged on the principal with the first installment
+}
+
+// Terms are the inputs of a repayment schedule
+type Terms struct {
+	Pricing
+	Principal money.Money
+	Months    int
+	StartDate time.Time // installments fall due monthly after this date
+}
+
+// Installment is one monthly payment. Balance is the principal still owed after it.
+type Installment struct {
+	Number    int         `json:"number"`
+	DueDate   string      `json:"due_date"` // YYYY-MM-DD
+	Principal money.Money `json:"principal"`
+	Interest  money.Money `json:"interest"`
+	Fees      money.Money `json:"fees"`
+	Payment   money.Money `json:"payment"`
+	Balance   money.Money `json:"balance"`
+}
+
+// Schedule is a month-by-month repayment plan
+type Schedule struct {
+	Principal     money.Money   `json:"principal"`
+	Currency      string        `json:"currency"`
+	Months        int           `json:"months"`
+	AnnualRateBps int           `json:"annual_rate_bps"`
+	Method        Method        `json:"method"`
+	TotalInterest money.Money   `json:"total_interest"`
+	TotalFees     money.Money   `json:"total_fees"`
+	TotalPayable  money.Money   `json:"total_payable"`
+	Installments  []Installment `json:"installments"`
+}
+
+// MaxMonths is the longest tenor the engine accepts
+const MaxMonths = 120
+
+// ParseRate converts a percentage such as "12.5" into basis points (1250)
+func ParseRate(s string) (int, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" || (hasPoint && frac == "") || len(frac) > 2 {
+		return 0, errors.New("rate must be a percentage with at most 2 decimal places")
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	bps, err := strconv.Atoi(whole + frac)
+	if err != nil || bps < 0 || bps > 100_00 {
+		return 0, errors.New("rate must be between 0 and 100 percent")
+	}
+	return bps, nil
+}
+
+// DefaultPricing reads FINANCING_ANNUAL_RATE (percent, default 12), FINANCING_RATE_METHOD
+// (default reducing_balance) and FINANCING_PROCESSING_FEE (percent, default 1)
+func DefaultPricing() (Pricing, error) {
+	pricing := Pricing{AnnualRateBps: 12_00, Method: MethodReducingBalance, ProcessingFeeBps: 1_00}
+
+	if value := os.Getenv("FINANCING_ANNUAL_RATE"); value != "" {
+		bps, err := ParseRate(value)
+		if err != nil {
+			return Pricing{}, fmt.Errorf("FINANCING_ANNUAL_RATE: %w", err)
+		}
+		pricing.AnnualRateBps = bps
+	}
+	if value := os.Getenv("FINANCING_RATE_METHOD"); value != "" {
+		method, ok := ParseMethod(value)
+		if !ok {
+			return Pricing{}, fmt.Errorf("FINANCING_RATE_METHOD: unknown method %q", value)
+		}
+		pricing.Method = method
+	}
+	if value := os.Getenv("FINANCING_PROCESSING_FEE"); value != "" {
+		bps, err := ParseRate(value)
+		if err != nil {
+			return Pricing{}, fmt.Errorf("FINANCING_PROCESSING_FEE: %w", err)
+		}
+		pricing.ProcessingFeeBps = bps
+	}
+
+	return pricing, nil
+}
+
+// BuildSchedule computes the repayment schedule. All arithmetic is done in integer minor
+// units; rounding differences are absorbed by the last installment so the principal is
+// repaid exactly.
+func BuildSchedule(t Terms) (*Schedule, error) {
+	if t.Principal.Minor <= 0 {
+		return nil, errors.New("principal must be positive")
+	}
+	if t.Months <= 0 || t.Months > MaxMonths {
+		return nil, fmt.Errorf("tenor must be between 1 and %d months", MaxMonths)
+	}
+	if t.AnnualRateBps < 0 || t.ProcessingFeeBps < 0 {
+		return nil, errors.New("rates cannot be negative")
+	}
+
+	var principals, interests []int64
+	switch t.Method {
+	case MethodFlat:
+		principals, interests = flatSplit(t.Principal.Minor, t.AnnualRateBps, t.Months)
+	case MethodReducingBalance:
+		principals, interests = reducingBalanceSplit(t.Principal.Minor, t.AnnualRateBps, t.Months)
+	default:
+		return nil, fmt.Errorf("unknown method %q", t.Method)
+	}
+
+	currency := t.Principal.Currency
+	m := func(minor int64) money.Money { return money.New(minor, currency) }
+	processingFee := roundDiv(t.Principal.Minor*int64(t.ProcessingFeeBps), 10000)
+
+	schedule := &Schedule{
+		Principal:     t.Principal,
+		Currency:      currency,
+		Months:        t.Months,
+		AnnualRateBps: t.AnnualRateBps,
+		Method:        t.Method,
+		Installments:  make([]Installment, 0, t.Months),
+	}
+
+	balance := t.Principal.Minor
+	var totalInterest int64
+	for i := 0; i < t.Months; i++ {
+		var fees int64
+		if i == 0 {
+			fees = processingFee
+		}
+		balance -= principals[i]
+		totalInterest += interests[i]
+		schedule.Installments = append(schedule.Installments, Installment{
+			Number:    i + 1,
+			DueDate:   AddMonths(t.StartDate, i+1).Format("2006-01-02"),
+			Principal: m(principals[i]),
+			Interest:  m(interests[i]),
+			Fees:      m(fees),
+			Payment:   m(principals[i] + interests[i] + fees),
+			Balance:   m(balance),
+		})
+	}
+
+	schedule.TotalInterest = m(totalInterest)
+	schedule.TotalFees = m(processingFee)
+	schedule.TotalPayable = m(t.Principal.Minor + totalInterest + processingFee)
+	return schedule, nil
+}
+
+// flatSplit spreads principal and flat interest evenly; the remainders go to the last month
+func flatSplit(principal int64, rateBps, months int) ([]int64, []int64) {
+	totalInterest := roundDiv(principal*int64(rateBps)*int64(months), 12*10000)
+	principals := evenSplit(principal, months)
+	interests := evenSplit(totalInterest, months)
+	return principals, interests
+}
+
+func evenSplit(total int64, parts int) []int64 {
+	out := make([]int64, parts)
+	each := total / int64(parts)
+	for i := range out {
+		out[i] = each
+	}
+	out[parts-1] += total - each*int64(parts)
+	return out
+}
+
+// reducingBalanceSplit computes the equal monthly payment (annuity) and splits each payment
+// into interest on the outstanding balance and principal
+func reducingBalanceSplit(principal int64, rateBps, months int) ([]int64, []int64) {
+	principals := make([]int64, months)
+	interests := make([]int64, months)
+
+	payment := annuityPayment(principal, rateBps, months)
+	balance := principal
+	for i := 0; i < months; i++ {
+		interest := roundDiv(balance*int64(rateBps), 12*10000)
+		part := payment - interest
+		if i == months-1 || part > balance {
+			part = balance
+		}
+		principals[i] = part
+		interests[i] = interest
+		balance -= part
+	}
+	return principals, interests
+}
+
+// annuityPayment returns P*r / (1 - (1+r)^-n) rounded to the minor unit
+func annuityPayment(principal int64, rateBps, months int) int64 {
+	if rateBps == 0 {
+		return roundDiv(principal, int64(months))
+	}
+	const prec = 128
+	p := new(big.Float).SetPrec(prec).SetInt64(principal)
+	r := new(big.Float).SetPrec(prec).Quo(
+		new(big.Float).SetPrec(prec).SetInt64(int64(rateBps)),
+		new(big.Float).SetPrec(prec).SetInt64(12*10000),
+	)
+	onePlusR := new(big.Float).SetPrec(prec).Add(big.NewFloat(1).SetPrec(prec), r)
+	growth := big.NewFloat(1).SetPrec(prec)
+	for i := 0; i < months; i++ {
+		growth.Mul(growth, onePlusR)
+	}
+	// P*r*g / (g-1) is the same as P*r / (1 - g^-1)
+	numerator := new(big.Float).SetPrec(prec).Mul(p, r)
+	numerator.Mul(numerator, growth)
+	denominator := new(big.Float).SetPrec(prec).Sub(growth, big.NewFloat(1).SetPrec(prec))
+	result := new(big.Float).SetPrec(prec).Quo(numerator, denominator)
+	result.Add(result, big.NewFloat(0.5))
+	minor, _ := result.Int64()
+	return minor
+}
+
+// roundDiv divides rounding half away from zero, for non-negative operands
+func roundDiv(numerator, denominator int64) int64 {
+	return (numerator*2 + denominator) / (denominator * 2)
+}
+
+// AddMonths adds calendar months, clamping to the end of shorter months (Jan 31 + 1 month = Feb 28/29)
+func AddMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, t.Location())
+}
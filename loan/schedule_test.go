@@ -0,0 +1,237 @@
+package loan
+
+import (
+	"testing"
+	"time"
+
+	"sme_fin_backend/money"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBuildSchedule(t *testing.T) {
+	type installment struct {
+		principal, interest, fees, payment int64
+	}
+	tests := []struct {
+		name          string
+		terms         Terms
+		regular       installment // every installment but the first and last
+		first, last   installment
+		totalInterest int64
+	}{
+		{
+			// 1,000.00 at 1% a month: the annuity is 888.488 fils, rounded to 8885, so the
+			// last payment is one fil short
+			name:          "reducing balance",
+			terms:         Terms{Pricing: Pricing{AnnualRateBps: 12_00, Method: MethodReducingBalance, ProcessingFeeBps: 1_00}, Principal: money.New(1000_00, "AED"), Months: 12},
+			first:         installment{principal: 7885, interest: 1000, fees: 1000, payment: 9885},
+			last:          installment{principal: 8796, interest: 88, payment: 8884},
+			totalInterest: 6619,
+		},
+		{
+			// 58.3333 of flat interest rounds to 58.33; 1,000.00 / 7 and 58.33 / 7 leave
+			// 5 and 2 fils for the last month
+			name:          "flat",
+			terms:         Terms{Pricing: Pricing{AnnualRateBps: 10_00, Method: MethodFlat, ProcessingFeeBps: 1_00}, Principal: money.New(1000_00, "AED"), Months: 7},
+			first:         installment{principal: 14285, interest: 833, fees: 1000, payment: 16118},
+			regular:       installment{principal: 14285, interest: 833, payment: 15118},
+			last:          installment{principal: 14290, interest: 835, payment: 15125},
+			totalInterest: 5833,
+		},
+		{
+			// 1,000.00 / 6 rounds up to 166.67, so the last month pays less
+			name:    "interest free rounding up",
+			terms:   Terms{Pricing: Pricing{Method: MethodReducingBalance}, Principal: money.New(1000_00, "USD"), Months: 6},
+			first:   installment{principal: 16667, payment: 16667},
+			regular: installment{principal: 16667, payment: 16667},
+			last:    installment{principal: 16665, payment: 16665},
+		},
+		{
+			// 1,000.00 / 3 rounds down to 333.33, so the last month pays more
+			name:    "interest free rounding down",
+			terms:   Terms{Pricing: Pricing{Method: MethodReducingBalance}, Principal: money.New(1000_00, "USD"), Months: 3},
+			first:   installment{principal: 33333, payment: 33333},
+			regular: installment{principal: 33333, payment: 33333},
+			last:    installment{principal: 33334, payment: 33334},
+		},
+		{
+			name:          "single month",
+			terms:         Terms{Pricing: Pricing{AnnualRateBps: 12_00, Method: MethodFlat, ProcessingFeeBps: 50}, Principal: money.New(2000_00, "AED"), Months: 1},
+			first:         installment{principal: 2000_00, interest: 2000, fees: 1000, payment: 2000_00 + 2000 + 1000},
+			last:          installment{principal: 2000_00, interest: 2000, fees: 1000, payment: 2000_00 + 2000 + 1000},
+			totalInterest: 2000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.terms.StartDate = date(2024, time.January, 15)
+			s, err := BuildSchedule(tt.terms)
+			if err != nil {
+				t.Fatalf("BuildSchedule: %v", err)
+			}
+			if len(s.Installments) != tt.terms.Months {
+				t.Fatalf("got %d installments, want %d", len(s.Installments), tt.terms.Months)
+			}
+
+			check := func(i Installment, want installment) {
+				t.Helper()
+				got := installment{i.Principal.Minor, i.Interest.Minor, i.Fees.Minor, i.Payment.Minor}
+				if got != want {
+					t.Errorf("installment %d = %+v, want %+v", i.Number, got, want)
+				}
+			}
+			n := len(s.Installments)
+			check(s.Installments[0], tt.first)
+			check(s.Installments[n-1], tt.last)
+			if tt.regular != (installment{}) {
+				for _, i := range s.Installments[1 : n-1] {
+					check(i, tt.regular)
+				}
+			}
+
+			var principal, interest, fees int64
+			balance := tt.terms.Principal.Minor
+			for _, i := range s.Installments {
+				principal += i.Principal.Minor
+				interest += i.Interest.Minor
+				fees += i.Fees.Minor
+				balance -= i.Principal.Minor
+				if i.Balance.Minor != balance {
+					t.Errorf("installment %d balance = %d, want %d", i.Number, i.Balance.Minor, balance)
+				}
+				if i.Number > 1 && i.Fees.Minor != 0 {
+					t.Errorf("installment %d charges fees %d, want them only on the first", i.Number, i.Fees.Minor)
+				}
+			}
+			if principal != tt.terms.Principal.Minor || balance != 0 {
+				t.Errorf("principal repaid = %d, final balance = %d, want %d and 0", principal, balance, tt.terms.Principal.Minor)
+			}
+			if interest != tt.totalInterest || s.TotalInterest.Minor != tt.totalInterest {
+				t.Errorf("interest = %d, TotalInterest = %d, want %d", interest, s.TotalInterest.Minor, tt.totalInterest)
+			}
+			if s.TotalFees.Minor != fees || s.TotalPayable.Minor != principal+interest+fees {
+				t.Errorf("TotalFees = %d, TotalPayable = %d, want %d and %d", s.TotalFees.Minor, s.TotalPayable.Minor, fees, principal+interest+fees)
+			}
+		})
+	}
+}
+
+func TestBuildScheduleRemainderAcrossTerms(t *testing.T) {
+	for _, method := range []Method{MethodFlat, MethodReducingBalance} {
+		for _, months := range []int{1, 2, 3, 7, 11, 12, 36, 59, MaxMonths} {
+			s, err := BuildSchedule(Terms{
+				Pricing:   Pricing{AnnualRateBps: 13_37, Method: method, ProcessingFeeBps: 1_25},
+				Principal: money.New(123_456_78, "AED"),
+				Months:    months,
+				StartDate: date(2024, time.January, 31),
+			})
+			if err != nil {
+				t.Fatalf("%s over %d months: %v", method, months, err)
+			}
+			var principal int64
+			for _, i := range s.Installments {
+				if i.Principal.Minor < 0 || i.Interest.Minor < 0 {
+					t.Errorf("%s over %d months: installment %d is negative: %+v", method, months, i.Number, i)
+				}
+				principal += i.Principal.Minor
+			}
+			last := s.Installments[len(s.Installments)-1]
+			if principal != 123_456_78 || last.Balance.Minor != 0 {
+				t.Errorf("%s over %d months: principal repaid = %d, final balance = %d", method, months, principal, last.Balance.Minor)
+			}
+		}
+	}
+}
+
+func TestBuildScheduleDueDates(t *testing.T) {
+	s, err := BuildSchedule(Terms{
+		Pricing:   Pricing{AnnualRateBps: 12_00, Method: MethodFlat},
+		Principal: money.New(1000_00, "AED"),
+		Months:    4,
+		StartDate: date(2024, time.January, 31),
+	})
+	if err != nil {
+		t.Fatalf("BuildSchedule: %v", err)
+	}
+	want := []string{"2024-02-29", "2024-03-31", "2024-04-30", "2024-05-31"}
+	for i, d := range want {
+		if s.Installments[i].DueDate != d {
+			t.Errorf("installment %d due %s, want %s", i+1, s.Installments[i].DueDate, d)
+		}
+	}
+}
+
+func TestBuildScheduleInvalid(t *testing.T) {
+	valid := Terms{Pricing: Pricing{AnnualRateBps: 12_00, Method: MethodFlat}, Principal: money.New(1000_00, "AED"), Months: 12}
+	tests := []struct {
+		name   string
+		modify func(*Terms)
+	}{
+		{name: "zero principal", modify: func(t *Terms) { t.Principal.Minor = 0 }},
+		{name: "negative principal", modify: func(t *Terms) { t.Principal.Minor = -1 }},
+		{name: "zero months", modify: func(t *Terms) { t.Months = 0 }},
+		{name: "too many months", modify: func(t *Terms) { t.Months = MaxMonths + 1 }},
+		{name: "negative rate", modify: func(t *Terms) { t.AnnualRateBps = -1 }},
+		{name: "negative fee", modify: func(t *Terms) { t.ProcessingFeeBps = -1 }},
+		{name: "unknown method", modify: func(t *Terms) { t.Method = "balloon" }},
+	}
+	for _, tt := range tests {
+		terms := valid
+		tt.modify(&terms)
+		if _, err := BuildSchedule(terms); err == nil {
+			t.Errorf("%s: BuildSchedule succeeded", tt.name)
+		}
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{from: date(2024, time.January, 15), months: 1, want: date(2024, time.February, 15)},
+		{from: date(2024, time.January, 31), months: 1, want: date(2024, time.February, 29)},
+		{from: date(2023, time.January, 31), months: 1, want: date(2023, time.February, 28)},
+		{from: date(2024, time.March, 31), months: 1, want: date(2024, time.April, 30)},
+		{from: date(2024, time.January, 31), months: 2, want: date(2024, time.March, 31)},
+		{from: date(2024, time.November, 30), months: 3, want: date(2025, time.February, 28)},
+		{from: date(2024, time.December, 31), months: 12, want: date(2025, time.December, 31)},
+	}
+	for _, tt := range tests {
+		if got := AddMonths(tt.from, tt.months); !got.Equal(tt.want) {
+			t.Errorf("AddMonths(%s, %d) = %s, want %s", tt.from.Format("2006-01-02"), tt.months, got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "12", want: 12_00},
+		{in: "12.5", want: 12_50},
+		{in: "12.50%", want: 12_50},
+		{in: " 0.01 ", want: 1},
+		{in: "0", want: 0},
+		{in: "100", want: 100_00},
+		{in: "100.01", wantErr: true},
+		{in: "12.345", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: ".5", wantErr: true},
+		{in: "5.", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -8,18 +8,35 @@ import (
 	"sync"
 
 	"sme_fin_backend/database"
+	"sme_fin_backend/filescan"
 	"sme_fin_backend/handlers"
+	"sme_fin_backend/jobs"
 	"sme_fin_backend/middleware"
+	"sme_fin_backend/models"
+	"sme_fin_backend/notify"
+	"sme_fin_backend/scoring"
+	"sme_fin_backend/storage"
+	"sme_fin_backend/utils"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
 
 var (
-	router     *mux.Router
-	db         *sql.DB
-	dbOnce     sync.Once
-	routerOnce sync.Once
+	router       *mux.Router
+	db           *sql.DB
+	notifier     notify.Notifier
+	notifierErr  error
+	dbOnce       sync.Once
+	notifierOnce sync.Once
+	scorer       scoring.Scorer
+	scorerErr    error
+	scorerOnce   sync.Once
+	fileStorage  storage.Backend
+	storageOnce  sync.Once
+	scanner      filescan.Scanner
+	scannerOnce  sync.Once
+	routerOnce   sync.Once
 )
 
 func init() {
@@ -40,6 +57,48 @@ func getDB() *sql.DB {
 	return db
 }
 
+func getNotifier() notify.Notifier {
+	notifierOnce.Do(func() {
+		notifier, notifierErr = notify.NewFromEnv()
+		if notifierErr != nil {
+			log.Printf("Failed to configure notifier: %v", notifierErr)
+		}
+	})
+	return notifier
+}
+
+func getScorer() scoring.Scorer {
+	scorerOnce.Do(func() {
+		scorer, scorerErr = scoring.NewFromEnv()
+		if scorerErr != nil {
+			log.Printf("Failed to load scoring rules: %v", scorerErr)
+		}
+	})
+	return scorer
+}
+
+func getStorage() storage.Backend {
+	storageOnce.Do(func() {
+		var err error
+		fileStorage, err = storage.NewFromEnv()
+		if err != nil {
+			log.Printf("Failed to configure file storage: %v", err)
+		}
+	})
+	return fileStorage
+}
+
+func getScanner() filescan.Scanner {
+	scannerOnce.Do(func() {
+		var err error
+		scanner, err = filescan.NewFromEnv()
+		if err != nil {
+			log.Printf("Failed to configure malware scanner, uploads stay in quarantine: %v", err)
+		}
+	})
+	return scanner
+}
+
 func getRouter() *mux.Router {
 	routerOnce.Do(func() {
 		router = mux.NewRouter()
@@ -51,20 +110,48 @@ func getRouter() *mux.Router {
 			w.Write([]byte(`{"status":"ok","message":"Server is running"}`))
 		}).Methods("GET")
 
+		// Public token verification keys
+		router.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
+
 		// Public routes
 		api := router.PathPrefix("/api").Subrouter()
 		api.HandleFunc("/auth/send-otp", func(w http.ResponseWriter, r *http.Request) {
-			(&handlers.AuthHandler{DB: getDB()}).SendOTP(w, r)
+			(&handlers.AuthHandler{DB: getDB(), Notifier: getNotifier()}).SendOTP(w, r)
 		}).Methods("POST")
 		api.HandleFunc("/auth/verify-otp", func(w http.ResponseWriter, r *http.Request) {
 			(&handlers.AuthHandler{DB: getDB()}).VerifyOTP(w, r)
 		}).Methods("POST")
+		api.HandleFunc("/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AuthHandler{DB: getDB()}).Refresh(w, r)
+		}).Methods("POST")
+		api.HandleFunc("/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AuthHandler{DB: getDB()}).Logout(w, r)
+		}).Methods("POST")
+		api.HandleFunc("/financing/quote", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB()}).Quote(w, r)
+		}).Methods("GET")
+		api.HandleFunc("/financing/products", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB()}).ListProducts(w, r)
+		}).Methods("GET")
+		// tus discovery and browser preflight for resumable uploads
+		api.HandleFunc("/user/uploads", handlers.UploadOptions).Methods("OPTIONS")
+		api.HandleFunc("/user/uploads/{id}", handlers.UploadOptions).Methods("OPTIONS")
+		api.HandleFunc("/jobs/daily", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.JobsHandler{DB: getDB(), Storage: getStorage(), Scanner: getScanner(), Notifier: getNotifier()}).Daily(w, r)
+		}).Methods("GET", "POST")
 
 		// Protected routes
 		protected := api.PathPrefix("").Subrouter()
-		protected.Use(middleware.JWTAuthMiddleware)
+		authMiddleware := middleware.JWTAuthMiddleware(func() (*sql.DB, error) { return getDB(), nil })
+		protected.Use(authMiddleware)
+		protected.HandleFunc("/auth/sessions", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AuthHandler{DB: getDB()}).ListSessions(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/auth/sessions", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AuthHandler{DB: getDB()}).RevokeSession(w, r)
+		}).Methods("DELETE")
 		protected.HandleFunc("/user/full-registration", func(w http.ResponseWriter, r *http.Request) {
-			(&handlers.UserHandler{DB: getDB()}).FullRegistration(w, r)
+			(&handlers.UserHandler{DB: getDB(), Storage: getStorage(), Scanner: getScanner()}).FullRegistration(w, r)
 		}).Methods("POST")
 		protected.HandleFunc("/user/status", func(w http.ResponseWriter, r *http.Request) {
 			(&handlers.UserHandler{DB: getDB()}).Status(w, r)
@@ -72,9 +159,51 @@ func getRouter() *mux.Router {
 		protected.HandleFunc("/user/data", func(w http.ResponseWriter, r *http.Request) {
 			(&handlers.UserHandler{DB: getDB()}).GetUserData(w, r)
 		}).Methods("GET")
+		protected.HandleFunc("/user/personal", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB()}).UpdatePersonal(w, r)
+		}).Methods("PUT")
+		protected.HandleFunc("/user/business", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB()}).UpdateBusiness(w, r)
+		}).Methods("PUT")
+		protected.HandleFunc("/user/trade-license", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB(), Storage: getStorage(), Scanner: getScanner()}).UpdateTradeLicense(w, r)
+		}).Methods("PUT")
+		protected.HandleFunc("/user/documents/{id}/download", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB(), Storage: getStorage()}).DownloadDocument(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/documents", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB()}).ListDocuments(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/documents", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB(), Storage: getStorage(), Scanner: getScanner()}).UploadDocument(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/user/documents/versions", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB()}).GetDocumentVersions(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/uploads", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB(), Storage: getStorage()}).CreateUpload(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB()}).UploadOffset(w, r)
+		}).Methods("HEAD")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB()}).GetUpload(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB(), Storage: getStorage(), Scanner: getScanner()}).PatchUpload(w, r)
+		}).Methods("PATCH")
+		protected.HandleFunc("/user/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.UserHandler{DB: getDB(), Storage: getStorage()}).DeleteUpload(w, r)
+		}).Methods("DELETE")
 		protected.HandleFunc("/financing/request", func(w http.ResponseWriter, r *http.Request) {
-			(&handlers.FinancingHandler{DB: getDB()}).RequestFinancing(w, r)
+			(&handlers.FinancingHandler{DB: getDB(), Scorer: getScorer()}).RequestFinancing(w, r)
 		}).Methods("POST")
+		protected.HandleFunc("/financing/request", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB(), Scorer: getScorer()}).UpdateFinancingRequest(w, r)
+		}).Methods("PATCH")
+		protected.HandleFunc("/financing/request", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB()}).WithdrawFinancingRequest(w, r)
+		}).Methods("DELETE")
 		protected.HandleFunc("/financing/requests", func(w http.ResponseWriter, r *http.Request) {
 			(&handlers.FinancingHandler{DB: getDB()}).GetFinancingRequests(w, r)
 		}).Methods("GET")
@@ -84,15 +213,95 @@ func getRouter() *mux.Router {
 		protected.HandleFunc("/financing/latest", func(w http.ResponseWriter, r *http.Request) {
 			(&handlers.FinancingHandler{DB: getDB()}).GetLatestFinancingRequest(w, r)
 		}).Methods("GET")
+		protected.HandleFunc("/financing/offer/accept", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB(), Storage: getStorage()}).AcceptOffer(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/financing/offer/decline", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB()}).DeclineOffer(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/financing/agreement", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB(), Storage: getStorage()}).GetAgreement(w, r)
+		}).Methods("GET")
+		protected.HandleFunc("/financing/agreement/sign", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB()}).SignAgreement(w, r)
+		}).Methods("POST")
+		protected.HandleFunc("/financing/statement", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.FinancingHandler{DB: getDB()}).GetStatement(w, r)
+		}).Methods("GET")
+
+		// Back-office routes (underwriters and administrators)
+		backOffice := api.PathPrefix("/admin").Subrouter()
+		backOffice.Use(authMiddleware)
+		backOffice.Use(middleware.RequireRoles(models.RoleUnderwriter, models.RoleAdmin))
+		backOffice.HandleFunc("/financing/requests", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).ListFinancingRequests(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/financing/request-detail", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).GetFinancingRequest(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/financing/review", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).ReviewFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/approve", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).ApproveFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/reject", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).RejectFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/disburse", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).DisburseFinancingRequest(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/offer", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).IssueOffer(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/repayment", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).RecordRepayment(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/fee", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).ChargeFee(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/financing/ledger", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).GetLoanLedger(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/collections", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).ListCollectionCases(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/collections/case", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).GetCollectionCase(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/collections/note", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).AddCollectionNote(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/collections/assign", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).AssignCollectionCase(w, r)
+		}).Methods("POST")
+		backOffice.HandleFunc("/documents", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).ListDocumentsForReview(w, r)
+		}).Methods("GET")
+		backOffice.HandleFunc("/documents/review", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).ReviewDocument(w, r)
+		}).Methods("POST")
+
+		// Administrator-only routes
+		adminOnly := backOffice.PathPrefix("").Subrouter()
+		adminOnly.Use(middleware.RequireRoles(models.RoleAdmin))
+		adminOnly.HandleFunc("/users/role", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).SetUserRole(w, r)
+		}).Methods("POST")
+		adminOnly.HandleFunc("/financing/write-off", func(w http.ResponseWriter, r *http.Request) {
+			(&handlers.AdminHandler{DB: getDB()}).WriteOffLoan(w, r)
+		}).Methods("POST")
 
 		// CORS middleware
 		corsHandler := func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.Header().Set("Access-Control-Allow-Origin", "*")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+				w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires")
 
-				if r.Method == "OPTIONS" {
+				// Preflight requests are answered here; other OPTIONS requests reach their route
+				if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
 					w.WriteHeader(http.StatusOK)
 					return
 				}
@@ -114,6 +323,18 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 
 // main function for local development
 func main() {
+	// Refuse to start with an insecure or broken token signing setup
+	if err := utils.CheckJWTConfig(); err != nil {
+		log.Fatalf("Invalid JWT configuration: %v", err)
+	}
+	// The serverless entry point answers every request needing these with a 500 instead
+	if getNotifier(); notifierErr != nil {
+		log.Fatalf("Invalid notifier configuration: %v", notifierErr)
+	}
+	if getScorer(); scorerErr != nil {
+		log.Fatalf("Invalid scoring configuration: %v", scorerErr)
+	}
+
 	// Connect to database for local development
 	db := getDB()
 	if db == nil {
@@ -121,6 +342,15 @@ func main() {
 	}
 	defer db.Close()
 
+	// Run the daily job in-process; Vercel deployments call /api/jobs/daily from Vercel Cron instead
+	hour, err := jobs.Hour()
+	if err != nil {
+		log.Fatalf("Invalid daily job configuration: %v", err)
+	}
+	if hour >= 0 {
+		go jobs.Schedule(db, hour, jobs.Files{Storage: getStorage(), Scanner: getScanner()}, getNotifier())
+	}
+
 	// Initialize router
 	r := getRouter()
 
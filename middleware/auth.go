@@ -1,39 +1,66 @@
 package middleware
 
 import (
+	"database/sql"
+	"log"
 	"net/http"
 	"strings"
 
+	"sme_fin_backend/models"
 	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
 )
 
-func JWTAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			utils.SendErrorResponse(w, "Authorization header is required", http.StatusUnauthorized)
-			return
-		}
-		
-		// Extract token from "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			utils.SendErrorResponse(w, "Invalid authorization header format", http.StatusUnauthorized)
-			return
-		}
-		
-		token := parts[1]
-		claims, err := utils.ValidateJWT(token)
-		if err != nil {
-			utils.SendErrorResponse(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
-		
-		// Store claims in request context
-		r.Header.Set("X-User-ID", claims.UserID.String())
-		r.Header.Set("X-User-Email", claims.Email)
-		
-		next.ServeHTTP(w, r)
-	})
-}
+// JWTAuthMiddleware validates the bearer token and checks that its session has not
+// been revoked. getDB is called per request so serverless cold starts stay lazy.
+func JWTAuthMiddleware(getDB func() (*sql.DB, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				utils.SendErrorResponse(w, "Authorization header is required", http.StatusUnauthorized)
+				return
+			}
+
+			// Extract token from "Bearer <token>"
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				utils.SendErrorResponse(w, "Invalid authorization header format", http.StatusUnauthorized)
+				return
+			}
+
+			token := parts[1]
+			claims, err := utils.ValidateJWT(token)
+			if err != nil || claims.SessionID == uuid.Nil {
+				utils.SendErrorResponse(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
 
+			// Reject tokens whose session was revoked (logout, device removal, token reuse)
+			db, err := getDB()
+			if err != nil || db == nil {
+				utils.SendErrorResponse(w, "Database connection is not available", http.StatusInternalServerError)
+				return
+			}
+			active, err := models.IsSessionActive(db, claims.SessionID)
+			if err != nil {
+				log.Printf("Failed to check session %s: %v", claims.SessionID, err)
+				utils.SendErrorResponse(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				utils.SendErrorResponse(w, "Session has been revoked", http.StatusUnauthorized)
+				return
+			}
+
+			// Store claims in request context
+			r.Header.Set("X-User-ID", claims.UserID.String())
+			r.Header.Set("X-User-Email", claims.Email)
+			r.Header.Set("X-User-Role", claims.Role)
+			r.Header.Set("X-Session-ID", claims.SessionID.String())
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
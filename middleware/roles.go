@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"sme_fin_backend/utils"
+)
+
+// RequireRoles only lets requests through whose token carries one of the given roles.
+// It must be mounted after JWTAuthMiddleware, which sets X-User-Role from the token.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed[r.Header.Get("X-User-Role")] {
+				utils.SendErrorResponse(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrAgreementAlreadySigned is returned when signing an agreement twice
+var ErrAgreementAlreadySigned = errors.New("agreement is already signed")
+
+// LoanAgreement is the contract generated for an approved financing request.
+// The signature fields record the borrower's click-to-sign acceptance of the document
+// whose SHA-256 is stored alongside.
+type LoanAgreement struct {
+	ID                 uuid.UUID  `json:"id"`
+	FinancingRequestID uuid.UUID  `json:"financing_request_id"`
+	OfferID            *uuid.UUID `json:"offer_id,omitempty"`
+	AgreementNumber    string     `json:"agreement_number"`
+	Template           string     `json:"template"`
+	Filename           string     `json:"filename"`
+	ObjectKey          string     `json:"-"`                  // key of the PDF in private storage
+	FileURL            string     `json:"file_url,omitempty"` // only set on agreements stored before storage was private
+	DownloadURL        string     `json:"download_url"`
+	SizeBytes          int64      `json:"size_bytes"`
+	SHA256             string     `json:"sha256"`
+	SignedAt           *time.Time `json:"signed_at,omitempty"`
+	SignedBy           *uuid.UUID `json:"signed_by,omitempty"`
+	SignerIP           string     `json:"signer_ip,omitempty"`
+	SignerUserAgent    string     `json:"signer_user_agent,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// IsSigned reports whether the borrower has accepted the agreement
+func (a *LoanAgreement) IsSigned() bool {
+	return a.SignedAt != nil
+}
+
+const loanAgreementColumns = `id, financing_request_id, offer_id, agreement_number, template, filename,
+	          COALESCE(object_key, ''), COALESCE(file_url, ''), size_bytes, sha256,
+	          signed_at, signed_by, COALESCE(signer_ip, ''), COALESCE(signer_user_agent, ''), created_at`
+
+func scanLoanAgreement(row interface{ Scan(...interface{}) error }) (*LoanAgreement, error) {
+	a := &LoanAgreement{}
+	var offerID, signedBy uuid.NullUUID
+	var signedAt sql.NullTime
+	err := row.Scan(&a.ID, &a.FinancingRequestID, &offerID, &a.AgreementNumber, &a.Template, &a.Filename, &a.ObjectKey,
+		&a.FileURL, &a.SizeBytes, &a.SHA256, &signedAt, &signedBy, &a.SignerIP, &a.SignerUserAgent, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if offerID.Valid {
+		a.OfferID = &offerID.UUID
+	}
+	if signedAt.Valid {
+		a.SignedAt = &signedAt.Time
+	}
+	if signedBy.Valid {
+		a.SignedBy = &signedBy.UUID
+	}
+	a.DownloadURL = DocumentDownloadPath(a.ID)
+	return a, nil
+}
+
+// Create stores a newly generated agreement. If another agreement was stored for the request
+// in the meantime, that one is kept and loaded into a instead.
+func (a *LoanAgreement) Create(db *sql.DB) error {
+	a.ID = uuid.New()
+	a.CreatedAt = time.Now()
+	a.DownloadURL = DocumentDownloadPath(a.ID)
+
+	query := `INSERT INTO loan_agreements (id, financing_request_id, offer_id, agreement_number, template, filename, object_key, file_url,
+	              size_bytes, sha256, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11)
+	          ON CONFLICT (financing_request_id) DO NOTHING`
+	result, err := db.Exec(query, a.ID, a.FinancingRequestID, a.OfferID, a.AgreementNumber, a.Template, a.Filename, a.ObjectKey, a.FileURL,
+		a.SizeBytes, a.SHA256, a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows > 0 {
+		return err
+	}
+
+	existing, err := GetLoanAgreementByRequestID(db, a.FinancingRequestID)
+	if err != nil {
+		return err
+	}
+	*a = *existing
+	return nil
+}
+
+// Sign records the borrower's acceptance. It fails with ErrAgreementAlreadySigned if the
+// agreement was signed before.
+func (a *LoanAgreement) Sign(db *sql.DB, signerID uuid.UUID, ip, userAgent string) error {
+	now := time.Now()
+	query := `UPDATE loan_agreements SET signed_at = $1, signed_by = $2, signer_ip = $3, signer_user_agent = $4
+	          WHERE id = $5 AND signed_at IS NULL`
+	result, err := db.Exec(query, now, signerID, ip, userAgent, a.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAgreementAlreadySigned
+	}
+
+	a.SignedAt = &now
+	a.SignedBy = &signerID
+	a.SignerIP = ip
+	a.SignerUserAgent = userAgent
+	return nil
+}
+
+func GetLoanAgreementByID(db *sql.DB, id uuid.UUID) (*LoanAgreement, error) {
+	query := `SELECT ` + loanAgreementColumns + ` FROM loan_agreements WHERE id = $1`
+	a, err := scanLoanAgreement(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
+
+func GetLoanAgreementByRequestID(db *sql.DB, requestID uuid.UUID) (*LoanAgreement, error) {
+	query := `SELECT ` + loanAgreementColumns + ` FROM loan_agreements WHERE financing_request_id = $1`
+	a, err := scanLoanAgreement(db.QueryRow(query, requestID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
@@ -0,0 +1,480 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/money"
+
+	"github.com/google/uuid"
+)
+
+// Collection case statuses
+const (
+	CollectionStatusOpen         = "open"
+	CollectionStatusPromiseToPay = "promise_to_pay"
+	CollectionStatusResolved     = "resolved"
+)
+
+// ErrCollectionCaseResolved is returned when working a case that is already resolved
+var ErrCollectionCaseResolved = errors.New("collection case is resolved")
+
+// CollectionCase tracks a delinquent loan while back-office users work it. The daily job opens
+// it when an installment becomes overdue and resolves it once nothing is overdue any more.
+type CollectionCase struct {
+	ID                  uuid.UUID    `json:"id"`
+	FinancingRequestID  uuid.UUID    `json:"financing_request_id"`
+	Status              string       `json:"status"`
+	Currency            string       `json:"currency"`
+	Overdue             money.Money  `json:"overdue"` // unpaid amount of the overdue installments
+	OverdueInstallments int          `json:"overdue_installments"`
+	DaysPastDue         int          `json:"days_past_due"` // since the oldest overdue due date
+	AssignedTo          *uuid.UUID   `json:"assigned_to,omitempty"`
+	PromisedAmount      *money.Money `json:"promised_amount,omitempty"`
+	PromisedDate        string       `json:"promised_date,omitempty"` // YYYY-MM-DD
+	OpenedAt            time.Time    `json:"opened_at"`
+	ResolvedAt          *time.Time   `json:"resolved_at,omitempty"`
+	UpdatedAt           time.Time    `json:"updated_at"`
+}
+
+// CollectionNote is an entry in a case's log. Notes may record a promise to pay.
+type CollectionNote struct {
+	ID             uuid.UUID    `json:"id"`
+	CaseID         uuid.UUID    `json:"case_id"`
+	AuthorID       *uuid.UUID   `json:"author_id,omitempty"` // nil for notes written by the daily job
+	Note           string       `json:"note"`
+	PromisedAmount *money.Money `json:"promised_amount,omitempty"`
+	PromisedDate   string       `json:"promised_date,omitempty"` // YYYY-MM-DD
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+func (n *CollectionNote) Create(db DBTX) error {
+	n.ID = uuid.New()
+	n.CreatedAt = time.Now()
+
+	var promisedMinor *int64
+	if n.PromisedAmount != nil {
+		promisedMinor = &n.PromisedAmount.Minor
+	}
+	query := `INSERT INTO collection_notes (id, case_id, author_id, note, promised_amount_minor, promised_date, created_at)
+	          VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::date, $7)`
+	_, err := db.Exec(query, n.ID, n.CaseID, n.AuthorID, n.Note, promisedMinor, n.PromisedDate, n.CreatedAt)
+	return err
+}
+
+// collectionCaseColumns matches the scan order of scanCollectionCase
+const collectionCaseColumns = `id, financing_request_id, status, currency, overdue_minor, overdue_installments, days_past_due,
+	assigned_to, promised_amount_minor, COALESCE(to_char(promised_date, 'YYYY-MM-DD'), ''), opened_at, resolved_at, updated_at`
+
+func scanCollectionCase(row interface{ Scan(...interface{}) error }) (*CollectionCase, error) {
+	c := &CollectionCase{}
+	var overdue int64
+	var assignedTo uuid.NullUUID
+	var promised sql.NullInt64
+	var resolvedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.FinancingRequestID, &c.Status, &c.Currency, &overdue, &c.OverdueInstallments, &c.DaysPastDue,
+		&assignedTo, &promised, &c.PromisedDate, &c.OpenedAt, &resolvedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.Overdue = money.New(overdue, c.Currency)
+	if assignedTo.Valid {
+		c.AssignedTo = &assignedTo.UUID
+	}
+	if promised.Valid {
+		amount := money.New(promised.Int64, c.Currency)
+		c.PromisedAmount = &amount
+	}
+	if resolvedAt.Valid {
+		c.ResolvedAt = &resolvedAt.Time
+	}
+	return c, nil
+}
+
+func GetCollectionCaseByID(db *sql.DB, id uuid.UUID) (*CollectionCase, error) {
+	query := `SELECT ` + collectionCaseColumns + ` FROM collection_cases WHERE id = $1`
+	c, err := scanCollectionCase(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
+
+// CollectionCaseFilter narrows the collections queue. Zero values mean "no filter".
+type CollectionCaseFilter struct {
+	Status     string // empty lists the cases still being worked
+	AssignedTo *uuid.UUID
+	Unassigned bool
+	Limit      int
+	Offset     int
+}
+
+// ListCollectionCases returns the collections queue, most days past due first
+func ListCollectionCases(db *sql.DB, filter CollectionCaseFilter) ([]CollectionCase, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	} else {
+		addCondition("status <> $%d", CollectionStatusResolved)
+	}
+	if filter.AssignedTo != nil {
+		addCondition("assigned_to = $%d", *filter.AssignedTo)
+	}
+	if filter.Unassigned {
+		conditions = append(conditions, "assigned_to IS NULL")
+	}
+
+	query := `SELECT ` + collectionCaseColumns + ` FROM collection_cases WHERE ` + strings.Join(conditions, " AND ")
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(` ORDER BY days_past_due DESC, opened_at LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cases := []CollectionCase{}
+	for rows.Next() {
+		c, err := scanCollectionCase(rows)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, *c)
+	}
+
+	return cases, rows.Err()
+}
+
+// GetCollectionCasesByRequestID returns every case of a loan, newest first
+func GetCollectionCasesByRequestID(db *sql.DB, requestID uuid.UUID) ([]CollectionCase, error) {
+	query := `SELECT ` + collectionCaseColumns + ` FROM collection_cases WHERE financing_request_id = $1 ORDER BY opened_at DESC`
+	rows, err := db.Query(query, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cases := []CollectionCase{}
+	for rows.Next() {
+		c, err := scanCollectionCase(rows)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, *c)
+	}
+
+	return cases, rows.Err()
+}
+
+func GetCollectionNotes(db *sql.DB, caseID uuid.UUID) ([]CollectionNote, error) {
+	query := `SELECT n.id, n.case_id, n.author_id, n.note, n.promised_amount_minor,
+	                 COALESCE(to_char(n.promised_date, 'YYYY-MM-DD'), ''), n.created_at, c.currency
+	          FROM collection_notes n JOIN collection_cases c ON c.id = n.case_id
+	          WHERE n.case_id = $1 ORDER BY n.created_at, n.id`
+
+	rows, err := db.Query(query, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []CollectionNote{}
+	for rows.Next() {
+		var n CollectionNote
+		var authorID uuid.NullUUID
+		var promised sql.NullInt64
+		var currency string
+		if err := rows.Scan(&n.ID, &n.CaseID, &authorID, &n.Note, &promised, &n.PromisedDate, &n.CreatedAt, &currency); err != nil {
+			return nil, err
+		}
+		if authorID.Valid {
+			n.AuthorID = &authorID.UUID
+		}
+		if promised.Valid {
+			amount := money.New(promised.Int64, currency)
+			n.PromisedAmount = &amount
+		}
+		notes = append(notes, n)
+	}
+
+	return notes, rows.Err()
+}
+
+// lockCollectionCase loads a case for update. It returns nil if it does not exist and
+// ErrCollectionCaseResolved if it is resolved.
+func lockCollectionCase(tx *sql.Tx, id uuid.UUID) (*CollectionCase, error) {
+	query := `SELECT ` + collectionCaseColumns + ` FROM collection_cases WHERE id = $1 FOR UPDATE`
+	c, err := scanCollectionCase(tx.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == CollectionStatusResolved {
+		return nil, ErrCollectionCaseResolved
+	}
+	return c, nil
+}
+
+// AddCollectionNote logs a note on a case that is still being worked. A note with a promised
+// date moves the case to promise_to_pay until that date.
+func AddCollectionNote(db *sql.DB, caseID uuid.UUID, note *CollectionNote) (*CollectionCase, error) {
+	var c *CollectionCase
+	err := withTx(db, func(tx *sql.Tx) error {
+		var err error
+		c, err = lockCollectionCase(tx, caseID)
+		if err != nil || c == nil {
+			return err
+		}
+
+		note.CaseID = c.ID
+		if err := note.Create(tx); err != nil {
+			return err
+		}
+
+		c.UpdatedAt = time.Now()
+		if note.PromisedDate != "" {
+			c.Status = CollectionStatusPromiseToPay
+			c.PromisedDate = note.PromisedDate
+			c.PromisedAmount = note.PromisedAmount
+		}
+
+		var promisedMinor *int64
+		if c.PromisedAmount != nil {
+			promisedMinor = &c.PromisedAmount.Minor
+		}
+		query := `UPDATE collection_cases SET status = $1, promised_amount_minor = $2, promised_date = NULLIF($3, '')::date, updated_at = $4
+		          WHERE id = $5`
+		_, err = tx.Exec(query, c.Status, promisedMinor, c.PromisedDate, c.UpdatedAt, c.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AssignCollectionCase hands a case to a back-office user, or unassigns it when assignee is nil
+func AssignCollectionCase(db *sql.DB, caseID uuid.UUID, assignee *uuid.UUID) (*CollectionCase, error) {
+	var c *CollectionCase
+	err := withTx(db, func(tx *sql.Tx) error {
+		var err error
+		c, err = lockCollectionCase(tx, caseID)
+		if err != nil || c == nil {
+			return err
+		}
+
+		c.AssignedTo = assignee
+		c.UpdatedAt = time.Now()
+		_, err = tx.Exec(`UPDATE collection_cases SET assigned_to = $1, updated_at = $2 WHERE id = $3`, assignee, c.UpdatedAt, c.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DelinquencyResult is what UpdateDelinquency changed on one loan
+type DelinquencyResult struct {
+	InstallmentsPosted  int
+	InstallmentsOverdue int // newly overdue
+	LateFeesCharged     int
+	CaseOpened          bool
+	CaseResolved        bool
+	PromiseBroken       bool
+}
+
+// GetLoansToMonitor returns the disbursed requests that have unpaid installments due by asOf
+// or a collection case still being worked
+func GetLoansToMonitor(db *sql.DB, asOf time.Time) ([]uuid.UUID, error) {
+	query := `SELECT fr.id FROM financing_requests fr
+	          WHERE fr.status = $1 AND (
+	              EXISTS (SELECT 1 FROM repayment_installments i WHERE i.financing_request_id = fr.id
+	                      AND i.due_date <= $2 AND i.status NOT IN ($3, $4))
+	              OR EXISTS (SELECT 1 FROM collection_cases c WHERE c.financing_request_id = fr.id AND c.status <> $5))
+	          ORDER BY fr.id`
+	rows, err := db.Query(query, FinancingStatusDisbursed, asOf.Format("2006-01-02"), InstallmentStatusPaid,
+		InstallmentStatusWrittenOff, CollectionStatusResolved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateDelinquency brings one disbursed loan up to date as of a day: it posts the installments
+// that fell due, marks unpaid installments overdue once the grace period has passed, charges
+// each of them the late fee and opens, refreshes or resolves the loan's collection case.
+// Running it again for the same day changes nothing.
+func UpdateDelinquency(db *sql.DB, requestID uuid.UUID, asOf time.Time, policy loan.LateFeePolicy) (*DelinquencyResult, error) {
+	result := &DelinquencyResult{}
+	err := withTx(db, func(tx *sql.Tx) error {
+		fr, err := lockDisbursedRequest(tx, requestID)
+		if err != nil || fr == nil {
+			return err
+		}
+
+		if result.InstallmentsPosted, err = accrueDueInstallments(tx, fr.ID, fr.Currency, asOf); err != nil {
+			return err
+		}
+		if err := markOverdueInstallments(tx, fr, asOf, policy, result); err != nil {
+			return err
+		}
+		return updateCollectionCase(tx, fr, asOf, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// markOverdueInstallments marks the unpaid installments whose grace period ended before asOf
+// as overdue and charges each the late fee
+func markOverdueInstallments(tx *sql.Tx, fr *FinancingRequest, asOf time.Time, policy loan.LateFeePolicy, result *DelinquencyResult) error {
+	cutoff := asOf.AddDate(0, 0, -policy.GraceDays).Format("2006-01-02")
+	query := `UPDATE repayment_installments SET status = $1, overdue_at = $2
+	          WHERE financing_request_id = $3 AND status IN ($4, $5) AND paid_minor < payment_minor AND due_date < $6
+	          RETURNING id, installment_number, payment_minor - paid_minor`
+	rows, err := tx.Query(query, InstallmentStatusOverdue, time.Now(), fr.ID, InstallmentStatusScheduled,
+		InstallmentStatusPartiallyPaid, cutoff)
+	if err != nil {
+		return err
+	}
+
+	type overdueInstallment struct {
+		ID     uuid.UUID
+		Number int
+		Unpaid int64
+	}
+	var overdue []overdueInstallment
+	for rows.Next() {
+		var o overdueInstallment
+		if err := rows.Scan(&o.ID, &o.Number, &o.Unpaid); err != nil {
+			rows.Close()
+			return err
+		}
+		overdue = append(overdue, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	result.InstallmentsOverdue = len(overdue)
+
+	for _, o := range overdue {
+		fee, err := policy.Fee(money.New(o.Unpaid, fr.Currency))
+		if err != nil {
+			return err
+		}
+		if fee.Minor <= 0 {
+			continue
+		}
+		installmentID := o.ID
+		entry := &JournalEntry{
+			FinancingRequestID: fr.ID,
+			Type:               EntryTypeLateFee,
+			Currency:           fr.Currency,
+			Description:        fmt.Sprintf("Late fee on installment %d", o.Number),
+			InstallmentID:      &installmentID,
+			EffectiveDate:      asOf.Format("2006-01-02"),
+			Postings:           []LedgerPosting{debit(LedgerAccountFeeReceivable, fee), credit(LedgerAccountFeeIncome, fee)},
+		}
+		if err := entry.post(tx); err != nil {
+			return err
+		}
+		result.LateFeesCharged++
+	}
+	return nil
+}
+
+// updateCollectionCase opens a case when the loan has overdue installments, keeps its figures
+// current, reopens it when a promise to pay is broken and resolves it once nothing is overdue
+func updateCollectionCase(tx *sql.Tx, fr *FinancingRequest, asOf time.Time, result *DelinquencyResult) error {
+	var count int
+	var unpaid int64
+	var oldestDue sql.NullTime
+	query := `SELECT COUNT(*), COALESCE(SUM(payment_minor - paid_minor), 0), MIN(due_date)
+	          FROM repayment_installments WHERE financing_request_id = $1 AND status = $2`
+	if err := tx.QueryRow(query, fr.ID, InstallmentStatusOverdue).Scan(&count, &unpaid, &oldestDue); err != nil {
+		return err
+	}
+
+	caseQuery := `SELECT ` + collectionCaseColumns + ` FROM collection_cases WHERE financing_request_id = $1 AND status <> $2 FOR UPDATE`
+	c, err := scanCollectionCase(tx.QueryRow(caseQuery, fr.ID, CollectionStatusResolved))
+	if err == sql.ErrNoRows {
+		c = nil
+	} else if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if count == 0 {
+		if c == nil {
+			return nil
+		}
+		if _, err := tx.Exec(`UPDATE collection_cases SET status = $1, overdue_minor = 0, overdue_installments = 0, days_past_due = 0,
+		                      promised_amount_minor = NULL, promised_date = NULL, resolved_at = $2, updated_at = $2 WHERE id = $3`,
+			CollectionStatusResolved, now, c.ID); err != nil {
+			return err
+		}
+		result.CaseResolved = true
+		note := &CollectionNote{CaseID: c.ID, Note: "Resolved: no installments are overdue"}
+		return note.Create(tx)
+	}
+
+	asOfDate := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	daysPastDue := int(asOfDate.Sub(oldestDue.Time.UTC()).Hours() / 24)
+
+	if c == nil {
+		c = &CollectionCase{ID: uuid.New()}
+		insertQuery := `INSERT INTO collection_cases (id, financing_request_id, status, currency, overdue_minor, overdue_installments,
+		                days_past_due, opened_at, updated_at)
+		                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)`
+		if _, err := tx.Exec(insertQuery, c.ID, fr.ID, CollectionStatusOpen, fr.Currency, unpaid, count, daysPastDue, now); err != nil {
+			return err
+		}
+		result.CaseOpened = true
+		note := &CollectionNote{CaseID: c.ID, Note: fmt.Sprintf("Opened: %d installment(s) overdue", count)}
+		return note.Create(tx)
+	}
+
+	status := c.Status
+	if c.Status == CollectionStatusPromiseToPay && c.PromisedDate < asOf.Format("2006-01-02") {
+		status = CollectionStatusOpen
+		result.PromiseBroken = true
+		note := &CollectionNote{CaseID: c.ID, Note: fmt.Sprintf("Promise to pay by %s was not kept", c.PromisedDate)}
+		if err := note.Create(tx); err != nil {
+			return err
+		}
+	}
+
+	updateQuery := `UPDATE collection_cases SET status = $1, overdue_minor = $2, overdue_installments = $3, days_past_due = $4,
+	                promised_amount_minor = CASE WHEN $1 = 'promise_to_pay' THEN promised_amount_minor END,
+	                promised_date = CASE WHEN $1 = 'promise_to_pay' THEN promised_date END,
+	                updated_at = $5
+	                WHERE id = $6`
+	_, err = tx.Exec(updateQuery, status, unpaid, count, daysPastDue, now, c.ID)
+	return err
+}
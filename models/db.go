@@ -0,0 +1,24 @@
+package models
+
+import "database/sql"
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, so model methods can run
+// standalone or as part of a larger transaction
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// withTx runs fn in a transaction, committing on success and rolling back on error
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
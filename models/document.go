@@ -0,0 +1,52 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// DocumentKindLoanAgreement is the kind of generated loan agreements. Other stored documents
+// are of their document type.
+const DocumentKindLoanAgreement = "loan_agreement"
+
+// Malware scan states of uploaded files. Files are quarantined (pending) until found clean.
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+)
+
+// Document is a stored file together with the user it belongs to
+type Document struct {
+	ID         uuid.UUID
+	OwnerID    uuid.UUID
+	Kind       string // DocumentKindLoanAgreement, or the type of a versioned document
+	Filename   string
+	ObjectKey  string // empty for documents registered by URL
+	FileURL    string
+	ScanStatus string // empty for documents that are not scanned, such as generated agreements
+}
+
+// DocumentDownloadPath is the API path a document is downloaded from
+func DocumentDownloadPath(id uuid.UUID) string {
+	return "/api/user/documents/" + id.String() + "/download"
+}
+
+// GetDocumentByID looks a document up among the versioned documents, trade licenses included,
+// and loan agreements
+func GetDocumentByID(db *sql.DB, id uuid.UUID) (*Document, error) {
+	query := `SELECT id, user_id, document_type, filename, COALESCE(object_key, ''), COALESCE(file_url, ''), COALESCE(scan_status, '')
+	          FROM documents WHERE id = $1
+	          UNION ALL
+	          SELECT a.id, r.user_id, $2::text, a.filename, COALESCE(a.object_key, ''), COALESCE(a.file_url, ''), ''
+	          FROM loan_agreements a JOIN financing_requests r ON r.id = a.financing_request_id
+	          WHERE a.id = $1`
+	d := &Document{}
+	err := db.QueryRow(query, id, DocumentKindLoanAgreement).
+		Scan(&d.ID, &d.OwnerID, &d.Kind, &d.Filename, &d.ObjectKey, &d.FileURL, &d.ScanStatus)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
@@ -0,0 +1,368 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Document types. Trade licenses are saved through the registration step of that name; the
+// other types are uploaded to the document vault. Both are stored as versioned documents.
+const (
+	DocumentTypeTradeLicense            = "trade_license"
+	DocumentTypeEmiratesID              = "emirates_id"
+	DocumentTypePassport                = "passport"
+	DocumentTypeMemorandumOfAssociation = "memorandum_of_association"
+	DocumentTypeVATCertificate          = "vat_certificate"
+	DocumentTypeBankStatement           = "bank_statement"
+)
+
+// VaultDocumentTypes are the document types uploaded to the vault
+var VaultDocumentTypes = []string{
+	DocumentTypeEmiratesID,
+	DocumentTypePassport,
+	DocumentTypeMemorandumOfAssociation,
+	DocumentTypeVATCertificate,
+	DocumentTypeBankStatement,
+}
+
+// DocumentRequirementIdentity is a checklist requirement met by an Emirates ID or a passport.
+// Every other requirement is a single document type.
+const DocumentRequirementIdentity = "identity"
+
+// AccountRequiredDocuments is the checklist an account has to meet to be complete. Products
+// add their own requirements on top (FinancingProduct.RequiredDocuments).
+var AccountRequiredDocuments = []string{DocumentTypeTradeLicense, DocumentRequirementIdentity}
+
+// documentRequirementTypes lists the document types that meet each requirement
+var documentRequirementTypes = map[string][]string{
+	DocumentRequirementIdentity: {DocumentTypeEmiratesID, DocumentTypePassport},
+}
+
+// Review states of documents
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// Checklist item states, from worst to best. Approved items meet their requirement, and so do
+// submitted ones unless DocumentsRequireApproval; rejected and expired ones have to be
+// uploaded again.
+const (
+	ChecklistMissing    = "missing"
+	ChecklistRejected   = "rejected"
+	ChecklistExpired    = "expired"
+	ChecklistUnverified = "unverified" // on file but not scanned clean: in quarantine, or registered by URL
+	ChecklistSubmitted  = "submitted"  // scanned clean, awaiting review
+	ChecklistApproved   = "approved"
+)
+
+var checklistRank = map[string]int{
+	ChecklistMissing:    0,
+	ChecklistRejected:   1,
+	ChecklistExpired:    2,
+	ChecklistUnverified: 3,
+	ChecklistSubmitted:  4,
+	ChecklistApproved:   5,
+}
+
+// DocumentsRequireApproval reports whether only approved documents meet a requirement
+// (DOCUMENTS_REQUIRE_APPROVAL, default false). By default a document scanned clean meets it
+// while it awaits review, so applicants are not held up by the review queue; underwriters see
+// the review state in the checklist.
+func DocumentsRequireApproval() bool {
+	required, _ := strconv.ParseBool(os.Getenv("DOCUMENTS_REQUIRE_APPROVAL"))
+	return required
+}
+
+// ValidVaultDocumentType reports whether documents of the type are uploaded to the vault
+func ValidVaultDocumentType(documentType string) bool {
+	for _, t := range VaultDocumentTypes {
+		if t == documentType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidDocumentType reports whether documents of the type are stored, from the vault or the
+// trade license step
+func ValidDocumentType(documentType string) bool {
+	return documentType == DocumentTypeTradeLicense || ValidVaultDocumentType(documentType)
+}
+
+// BusinessDocument is one version of a stored document
+type BusinessDocument struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	DocumentType string     `json:"document_type"`
+	Version      int        `json:"version"` // 1 for the first upload of the type
+	Filename     string     `json:"filename"`
+	ObjectKey    string     `json:"-"`
+	FileURL      string     `json:"file_url,omitempty"` // set for trade licenses registered by URL instead of uploaded
+	DownloadURL  string     `json:"download_url"`
+	FileSize     int64      `json:"file_size,omitempty"`
+	SHA256       string     `json:"sha256,omitempty"`
+	ScanStatus   string     `json:"scan_status,omitempty"` // ScanStatus*; empty for files registered by URL
+	ScannedAt    *time.Time `json:"scanned_at,omitempty"`
+	ExpiresOn    *time.Time `json:"expires_on,omitempty"` // last day the document is valid
+	ReviewStatus string     `json:"review_status"`        // ReviewStatus*
+	ReviewNote   string     `json:"review_note,omitempty"`
+	ReviewedBy   *uuid.UUID `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ChecklistItem is the state of one required document
+type ChecklistItem struct {
+	Requirement  string     `json:"requirement"`
+	Status       string     `json:"status"`                  // Checklist*
+	DocumentType string     `json:"document_type,omitempty"` // the document on file for the requirement
+	DocumentID   *uuid.UUID `json:"document_id,omitempty"`
+	ExpiresOn    *time.Time `json:"expires_on,omitempty"`
+}
+
+// Met reports whether the requirement is met
+func (i ChecklistItem) Met() bool {
+	return i.Status == ChecklistApproved || (i.Status == ChecklistSubmitted && !DocumentsRequireApproval())
+}
+
+// DocumentChecklist is the state of a list of required documents
+type DocumentChecklist struct {
+	Items    []ChecklistItem `json:"items"`
+	Complete bool            `json:"complete"`
+	Missing  []string        `json:"missing"` // requirements not met
+}
+
+const businessDocumentColumns = `id, user_id, document_type, version, filename, COALESCE(object_key, ''), COALESCE(file_url, ''),
+	          COALESCE(file_size, 0), COALESCE(sha256, ''), COALESCE(scan_status, ''), scanned_at, expires_on, review_status,
+	          COALESCE(review_note, ''), reviewed_by, reviewed_at, created_at, updated_at`
+
+func scanBusinessDocument(row interface{ Scan(...interface{}) error }) (*BusinessDocument, error) {
+	d := &BusinessDocument{}
+	var scannedAt, expiresOn, reviewedAt sql.NullTime
+	var reviewedBy uuid.NullUUID
+	err := row.Scan(&d.ID, &d.UserID, &d.DocumentType, &d.Version, &d.Filename, &d.ObjectKey, &d.FileURL, &d.FileSize, &d.SHA256,
+		&d.ScanStatus, &scannedAt, &expiresOn, &d.ReviewStatus, &d.ReviewNote, &reviewedBy, &reviewedAt,
+		&d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if scannedAt.Valid {
+		d.ScannedAt = &scannedAt.Time
+	}
+	if expiresOn.Valid {
+		d.ExpiresOn = &expiresOn.Time
+	}
+	if reviewedBy.Valid {
+		d.ReviewedBy = &reviewedBy.UUID
+	}
+	if reviewedAt.Valid {
+		d.ReviewedAt = &reviewedAt.Time
+	}
+	d.DownloadURL = DocumentDownloadPath(d.ID)
+	return d, nil
+}
+
+func queryBusinessDocuments(db *sql.DB, query string, args ...interface{}) ([]BusinessDocument, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []BusinessDocument{}
+	for rows.Next() {
+		d, err := scanBusinessDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, *d)
+	}
+	return documents, rows.Err()
+}
+
+// CreateBusinessDocument stores an uploaded document as the next version of its type, awaiting
+// review. ScanStatus is ScanStatusClean if the file was scanned on upload, or pending.
+func CreateBusinessDocument(db *sql.DB, d *BusinessDocument) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		return createBusinessDocument(tx, d)
+	})
+}
+
+// createBusinessDocument expects to run in a transaction. A document registered by URL (FileURL)
+// has no ScanStatus; FileSize and SHA256 may be recorded later.
+func createBusinessDocument(tx DBTX, d *BusinessDocument) error {
+	// Serializes the uploads of a user, so versions are numbered without gaps or clashes
+	var id uuid.UUID
+	if err := tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, d.UserID).Scan(&id); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var scannedAt *time.Time
+	if d.ScanStatus == ScanStatusClean {
+		scannedAt = &now
+	}
+	query := `INSERT INTO documents (id, user_id, document_type, version, filename, object_key, file_url, file_size, sha256,
+	              scan_status, scanned_at, expires_on, review_status, created_at, updated_at)
+	          SELECT $1, $2, $3, COALESCE(MAX(version), 0) + 1, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, 0),
+	              NULLIF($8, ''), NULLIF($9, ''), $10, $11, 'pending', $12, $12
+	          FROM documents WHERE user_id = $2 AND document_type = $3
+	          RETURNING ` + businessDocumentColumns
+	created, err := scanBusinessDocument(tx.QueryRow(query, uuid.New(), d.UserID, d.DocumentType, d.Filename, d.ObjectKey,
+		d.FileURL, d.FileSize, d.SHA256, d.ScanStatus, scannedAt, d.ExpiresOn, now))
+	if err != nil {
+		return err
+	}
+	*d = *created
+	return nil
+}
+
+// GetBusinessDocument returns a document version, or nil if it does not exist
+func GetBusinessDocument(db *sql.DB, id uuid.UUID) (*BusinessDocument, error) {
+	d, err := scanBusinessDocument(db.QueryRow(`SELECT `+businessDocumentColumns+` FROM documents WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// GetCurrentBusinessDocuments returns the latest version of each document type of a user. The
+// latest trade license is the one its registration step points at.
+func GetCurrentBusinessDocuments(db *sql.DB, userID uuid.UUID) ([]BusinessDocument, error) {
+	query := `SELECT DISTINCT ON (document_type) ` + businessDocumentColumns + `
+	          FROM documents WHERE user_id = $1 ORDER BY document_type, version DESC`
+	return queryBusinessDocuments(db, query, userID)
+}
+
+// GetBusinessDocumentVersions returns every version of a document type of a user, newest first
+func GetBusinessDocumentVersions(db *sql.DB, userID uuid.UUID, documentType string) ([]BusinessDocument, error) {
+	query := `SELECT ` + businessDocumentColumns + ` FROM documents
+	          WHERE user_id = $1 AND document_type = $2 ORDER BY version DESC`
+	return queryBusinessDocuments(db, query, userID, documentType)
+}
+
+// GetBusinessDocumentsForReview returns the documents awaiting review, oldest first. Uploaded
+// files are left out until they are scanned clean.
+func GetBusinessDocumentsForReview(db *sql.DB, limit, offset int) ([]BusinessDocument, error) {
+	query := `SELECT ` + businessDocumentColumns + ` FROM documents
+	          WHERE review_status = 'pending' AND (scan_status = 'clean' OR object_key IS NULL)
+	          ORDER BY created_at LIMIT $1 OFFSET $2`
+	return queryBusinessDocuments(db, query, limit, offset)
+}
+
+// ReviewBusinessDocument records a review decision on a document. A non-nil expiresOn sets or
+// corrects its expiry date, and that of the trade license step when the document is its
+// current version. It returns nil if the document does not exist.
+func ReviewBusinessDocument(db *sql.DB, id uuid.UUID, status, note string, expiresOn *time.Time, reviewerID uuid.UUID) (*BusinessDocument, error) {
+	var d *BusinessDocument
+	err := withTx(db, func(tx *sql.Tx) error {
+		now := time.Now()
+		query := `UPDATE documents SET review_status = $1, review_note = NULLIF($2, ''), expires_on = COALESCE($3, expires_on),
+		              reviewed_by = $4, reviewed_at = $5, updated_at = $5
+		          WHERE id = $6
+		          RETURNING ` + businessDocumentColumns
+		var err error
+		d, err = scanBusinessDocument(tx.QueryRow(query, status, note, expiresOn, reviewerID, now, id))
+		if err != nil || expiresOn == nil || d.DocumentType != DocumentTypeTradeLicense {
+			return err
+		}
+		// A new expiry date restarts the license's expiry flag and reminders
+		_, err = tx.Exec(`UPDATE trade_licenses SET expires_on = $1, expiry_status = NULL, expiry_reminder_days = NULL, updated_at = $2
+		                  WHERE document_id = $3 AND expires_on IS DISTINCT FROM $1`, expiresOn, now, id)
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// GetBusinessDocumentsPendingScan returns up to limit documents still in quarantine, oldest first
+func GetBusinessDocumentsPendingScan(db *sql.DB, limit int) ([]BusinessDocument, error) {
+	query := `SELECT ` + businessDocumentColumns + ` FROM documents
+	          WHERE scan_status = 'pending' ORDER BY created_at LIMIT $1`
+	return queryBusinessDocuments(db, query, limit)
+}
+
+// RecordBusinessDocumentScan stores the malware scan result of a document
+func RecordBusinessDocumentScan(db *sql.DB, id uuid.UUID, infected bool, signature string) error {
+	status := ScanStatusClean
+	if infected {
+		status = ScanStatusInfected
+	}
+	now := time.Now()
+	query := `UPDATE documents SET scan_status = $1, scan_signature = NULLIF($2, ''), scanned_at = $3, updated_at = $3
+	          WHERE id = $4`
+	_, err := db.Exec(query, status, signature, now, id)
+	return err
+}
+
+// GetDocumentChecklist checks the documents of a user against a list of requirements (document
+// types, or DocumentRequirementIdentity) as of a date
+func GetDocumentChecklist(db *sql.DB, userID uuid.UUID, requirements []string, asOf time.Time) (*DocumentChecklist, error) {
+	onFile := map[string]ChecklistItem{}
+	documents, err := GetCurrentBusinessDocuments(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range documents {
+		d := &documents[i]
+		onFile[d.DocumentType] = ChecklistItem{
+			DocumentType: d.DocumentType,
+			DocumentID:   &d.ID,
+			ExpiresOn:    d.ExpiresOn,
+			Status:       d.checklistStatus(asOf),
+		}
+	}
+
+	return newDocumentChecklist(requirements, onFile), nil
+}
+
+// checklistStatus is the checklist state of a document as of a date. A file registered by URL
+// is never scanned, so it only counts once approved.
+func (d *BusinessDocument) checklistStatus(asOf time.Time) string {
+	switch {
+	case d.ScanStatus == ScanStatusInfected || d.ReviewStatus == ReviewStatusRejected:
+		return ChecklistRejected
+	case d.ExpiresOn != nil && d.ExpiresOn.Format("2006-01-02") < asOf.Format("2006-01-02"):
+		return ChecklistExpired
+	case d.ReviewStatus == ReviewStatusApproved:
+		return ChecklistApproved
+	case d.ScanStatus != ScanStatusClean:
+		return ChecklistUnverified
+	}
+	return ChecklistSubmitted
+}
+
+// newDocumentChecklist builds a checklist from the documents on file, by type. A requirement
+// met by several types takes the best of them.
+func newDocumentChecklist(requirements []string, onFile map[string]ChecklistItem) *DocumentChecklist {
+	checklist := &DocumentChecklist{Items: []ChecklistItem{}, Missing: []string{}}
+	for _, requirement := range requirements {
+		types, ok := documentRequirementTypes[requirement]
+		if !ok {
+			types = []string{requirement}
+		}
+
+		best := ChecklistItem{Status: ChecklistMissing}
+		for _, t := range types {
+			if item, ok := onFile[t]; ok && checklistRank[item.Status] > checklistRank[best.Status] {
+				best = item
+			}
+		}
+		best.Requirement = requirement
+		checklist.Items = append(checklist.Items, best)
+		if !best.Met() {
+			checklist.Missing = append(checklist.Missing, requirement)
+		}
+	}
+	checklist.Complete = len(checklist.Missing) == 0
+	return checklist
+}
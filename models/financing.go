@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FinancingRequestFilter narrows the back-office listing of financing requests.
+// Zero values mean "no filter".
+type FinancingRequestFilter struct {
+	Status    string
+	ProductID *uuid.UUID
+	RiskBand  string // band of the latest score
+	Currency  string
+	MinAmount *int64     // minor units
+	MaxAmount *int64     // minor units
+	From      *time.Time // created at or after
+	To        *time.Time // created before
+	Limit     int
+	Offset    int
+}
+
+// ListFinancingRequests returns financing requests across all users, newest first
+func ListFinancingRequests(db *sql.DB, filter FinancingRequestFilter) ([]FinancingRequest, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.ProductID != nil {
+		addCondition("product_id = $%d", *filter.ProductID)
+	}
+	if filter.RiskBand != "" {
+		addCondition(`(SELECT s.band FROM financing_request_scores s WHERE s.financing_request_id = financing_requests.id
+		               ORDER BY s.created_at DESC LIMIT 1) = $%d`, filter.RiskBand)
+	}
+	if filter.Currency != "" {
+		addCondition("currency = $%d", filter.Currency)
+	}
+	if filter.MinAmount != nil {
+		addCondition("amount_minor >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		addCondition("amount_minor <= $%d", *filter.MaxAmount)
+	}
+	if filter.From != nil {
+		addCondition("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("created_at < $%d", *filter.To)
+	}
+
+	query := `SELECT ` + financingRequestColumns + ` FROM financing_requests`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []FinancingRequest{}
+	for rows.Next() {
+		fr, err := scanFinancingRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *fr)
+	}
+
+	return requests, rows.Err()
+}
+
+// UpdatePending saves the editable fields of a request that is still pending.
+// It returns false if the request is no longer pending.
+func (fr *FinancingRequest) UpdatePending(db *sql.DB) (bool, error) {
+	now := time.Now()
+	query := `UPDATE financing_requests SET product_id = $1, amount_minor = $2, currency = $3, purpose = $4, repayment_period = $5, updated_at = $6
+	          WHERE id = $7 AND status = $8`
+	result, err := db.Exec(query, fr.ProductID, fr.Amount.Minor, fr.Amount.Currency, fr.Purpose, fr.RepaymentPeriod, now, fr.ID, FinancingStatusPending)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+
+	fr.Currency = fr.Amount.Currency
+	fr.UpdatedAt = now
+	return true, nil
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Financing request statuses
+const (
+	FinancingStatusPending     = "pending"
+	FinancingStatusUnderReview = "under_review"
+	FinancingStatusApproved    = "approved"
+	FinancingStatusRejected    = "rejected"
+	FinancingStatusDisbursed   = "disbursed"
+	FinancingStatusWithdrawn   = "withdrawn"
+)
+
+// financingTransitions lists the statuses each status may move to.
+// Rejected, disbursed and withdrawn are terminal.
+var financingTransitions = map[string][]string{
+	FinancingStatusPending:     {FinancingStatusUnderReview, FinancingStatusRejected, FinancingStatusWithdrawn},
+	FinancingStatusUnderReview: {FinancingStatusApproved, FinancingStatusRejected, FinancingStatusWithdrawn},
+	FinancingStatusApproved:    {FinancingStatusDisbursed, FinancingStatusWithdrawn},
+}
+
+// InvalidTransitionError is returned when a status change is not allowed by the state machine
+type InvalidTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("financing request cannot move from %q to %q", e.From, e.To)
+}
+
+// CanTransition reports whether a financing request may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range financingTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// FinancingRequestEvent is one entry in a financing request's status history
+type FinancingRequestEvent struct {
+	ID                 uuid.UUID  `json:"id"`
+	FinancingRequestID uuid.UUID  `json:"financing_request_id"`
+	FromStatus         string     `json:"from_status,omitempty"` // empty for the creation event
+	ToStatus           string     `json:"to_status"`
+	ActorID            *uuid.UUID `json:"actor_id,omitempty"` // nil for system actions
+	Reason             string     `json:"reason,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+func (e *FinancingRequestEvent) Create(db DBTX) error {
+	e.ID = uuid.New()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO financing_request_events (id, financing_request_id, from_status, to_status, actor_id, reason, created_at)
+	          VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7)`
+	_, err := db.Exec(query, e.ID, e.FinancingRequestID, e.FromStatus, e.ToStatus, e.ActorID, e.Reason, e.CreatedAt)
+	return err
+}
+
+func GetFinancingRequestEvents(db *sql.DB, requestID uuid.UUID) ([]FinancingRequestEvent, error) {
+	query := `SELECT id, financing_request_id, COALESCE(from_status, ''), to_status, actor_id, COALESCE(reason, ''), created_at
+	          FROM financing_request_events WHERE financing_request_id = $1 ORDER BY created_at, id`
+
+	rows, err := db.Query(query, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []FinancingRequestEvent{}
+	for rows.Next() {
+		var e FinancingRequestEvent
+		var actorID uuid.NullUUID
+		if err := rows.Scan(&e.ID, &e.FinancingRequestID, &e.FromStatus, &e.ToStatus, &actorID, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			e.ActorID = &actorID.UUID
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// TransitionFinancingRequest moves a request to a new status and records the change in its
+// history. It returns nil if the request does not exist and *InvalidTransitionError if the
+// state machine does not allow the move. actorID is nil for automated transitions.
+func TransitionFinancingRequest(db *sql.DB, id uuid.UUID, to string, actorID *uuid.UUID, reason string) (*FinancingRequest, error) {
+	return TransitionFinancingRequestFrom(db, id, "", to, actorID, reason)
+}
+
+// TransitionFinancingRequestFrom is TransitionFinancingRequest restricted to requests that are
+// currently in the from status; any other current status yields *InvalidTransitionError.
+// An empty from accepts every status the state machine allows.
+func TransitionFinancingRequestFrom(db *sql.DB, id uuid.UUID, from, to string, actorID *uuid.UUID, reason string) (*FinancingRequest, error) {
+	var fr *FinancingRequest
+	err := withTx(db, func(tx *sql.Tx) error {
+		var err error
+		fr, err = transitionFinancingRequest(tx, id, from, to, actorID, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fr, nil
+}
+
+// TransitionFinancingRequestTx is TransitionFinancingRequest inside an existing transaction.
+// The request row stays locked until the transaction ends.
+func TransitionFinancingRequestTx(tx *sql.Tx, id uuid.UUID, to string, actorID *uuid.UUID, reason string) (*FinancingRequest, error) {
+	return transitionFinancingRequest(tx, id, "", to, actorID, reason)
+}
+
+func transitionFinancingRequest(tx *sql.Tx, id uuid.UUID, from, to string, actorID *uuid.UUID, reason string) (*FinancingRequest, error) {
+	query := `SELECT ` + financingRequestColumns + ` FROM financing_requests WHERE id = $1 FOR UPDATE`
+	fr, err := scanFinancingRequest(tx.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if (from != "" && fr.Status != from) || !CanTransition(fr.Status, to) {
+		return nil, &InvalidTransitionError{From: fr.Status, To: to}
+	}
+
+	now := time.Now()
+	updateQuery := `UPDATE financing_requests SET status = $1, decision_reason = $2, decided_by = $3, decided_at = $4, updated_at = $4
+	                WHERE id = $5`
+	if _, err := tx.Exec(updateQuery, to, reason, actorID, now, fr.ID); err != nil {
+		return nil, err
+	}
+
+	event := &FinancingRequestEvent{
+		FinancingRequestID: fr.ID,
+		FromStatus:         fr.Status,
+		ToStatus:           to,
+		ActorID:            actorID,
+		Reason:             reason,
+		CreatedAt:          now,
+	}
+	if err := event.Create(tx); err != nil {
+		return nil, err
+	}
+
+	// Open offers lapse when the request is rejected or withdrawn
+	if to == FinancingStatusRejected || to == FinancingStatusWithdrawn {
+		offersQuery := `UPDATE loan_offers SET status = $1, updated_at = $2 WHERE financing_request_id = $3 AND status = $4`
+		if _, err := tx.Exec(offersQuery, OfferStatusSuperseded, now, fr.ID, OfferStatusPending); err != nil {
+			return nil, err
+		}
+	}
+
+	fr.Status = to
+	fr.DecisionReason = reason
+	fr.DecidedBy = actorID
+	fr.DecidedAt = &now
+	fr.UpdatedAt = now
+	return fr, nil
+}
@@ -0,0 +1,714 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sme_fin_backend/money"
+
+	"github.com/google/uuid"
+)
+
+// Ledger account codes. Receivables are kept per financing request, the others are shared
+// per currency.
+const (
+	LedgerAccountCash               = "cash"
+	LedgerAccountInterestIncome     = "interest_income"
+	LedgerAccountFeeIncome          = "fee_income"
+	LedgerAccountCreditLosses       = "credit_losses"
+	LedgerAccountLoanPrincipal      = "loan_principal"
+	LedgerAccountInterestReceivable = "interest_receivable"
+	LedgerAccountFeeReceivable      = "fee_receivable"
+)
+
+// ledgerAccountTypes gives the type of each account code and whether it is kept per request
+var ledgerAccountTypes = map[string]struct {
+	Type       string
+	PerRequest bool
+}{
+	LedgerAccountCash:               {"asset", false},
+	LedgerAccountInterestIncome:     {"income", false},
+	LedgerAccountFeeIncome:          {"income", false},
+	LedgerAccountCreditLosses:       {"expense", false},
+	LedgerAccountLoanPrincipal:      {"asset", true},
+	LedgerAccountInterestReceivable: {"asset", true},
+	LedgerAccountFeeReceivable:      {"asset", true},
+}
+
+// Journal entry types
+const (
+	EntryTypeDisbursement   = "disbursement"
+	EntryTypeInstallmentDue = "installment_due"
+	EntryTypeRepayment      = "repayment"
+	EntryTypeFee            = "fee"
+	EntryTypeLateFee        = "late_fee"
+	EntryTypeWriteOff       = "write_off"
+)
+
+var (
+	// ErrLoanNotDisbursed is returned when posting to a request that has not been disbursed
+	ErrLoanNotDisbursed = errors.New("financing request has not been disbursed")
+	// ErrRepaymentExceedsBalance is returned when a repayment is larger than everything owed
+	ErrRepaymentExceedsBalance = errors.New("repayment exceeds the outstanding balance")
+	// ErrNothingOutstanding is returned when writing off a loan with nothing left to pay
+	ErrNothingOutstanding = errors.New("nothing is outstanding on this loan")
+	// ErrCurrencyMismatch is returned when an amount is not in the loan's currency
+	ErrCurrencyMismatch = errors.New("amount is not in the loan currency")
+	// ErrNoRepaymentSchedule is returned when disbursing a request without a fixed schedule
+	ErrNoRepaymentSchedule = errors.New("financing request has no repayment schedule")
+)
+
+// JournalEntry is one balanced set of postings in the ledger
+type JournalEntry struct {
+	ID                 uuid.UUID       `json:"id"`
+	FinancingRequestID uuid.UUID       `json:"financing_request_id"`
+	Type               string          `json:"type"`
+	Currency           string          `json:"currency"`
+	Description        string          `json:"description,omitempty"`
+	Reference          string          `json:"reference,omitempty"`
+	InstallmentID      *uuid.UUID      `json:"installment_id,omitempty"`
+	EffectiveDate      string          `json:"effective_date"`       // YYYY-MM-DD
+	CreatedBy          *uuid.UUID      `json:"created_by,omitempty"` // nil for system entries
+	CreatedAt          time.Time       `json:"created_at"`
+	Postings           []LedgerPosting `json:"postings"`
+}
+
+// LedgerPosting moves an amount into or out of an account. Debits are positive, credits negative.
+type LedgerPosting struct {
+	Account string      `json:"account"`
+	Amount  money.Money `json:"amount"`
+}
+
+func debit(account string, amount money.Money) LedgerPosting {
+	return LedgerPosting{Account: account, Amount: amount}
+}
+
+func credit(account string, amount money.Money) LedgerPosting {
+	return LedgerPosting{Account: account, Amount: money.New(-amount.Minor, amount.Currency)}
+}
+
+// post stores the entry and its non-zero postings. The database rejects entries that do not
+// balance when the transaction commits.
+func (e *JournalEntry) post(tx *sql.Tx) error {
+	e.ID = uuid.New()
+	e.CreatedAt = time.Now()
+
+	postings := e.Postings[:0]
+	for _, p := range e.Postings {
+		if p.Amount.Minor != 0 {
+			postings = append(postings, p)
+		}
+	}
+	e.Postings = postings
+
+	query := `INSERT INTO journal_entries (id, financing_request_id, entry_type, currency, description, reference, installment_id,
+	          effective_date, created_by, created_at)
+	          VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $10)`
+	_, err := tx.Exec(query, e.ID, e.FinancingRequestID, e.Type, e.Currency, e.Description, e.Reference, e.InstallmentID,
+		e.EffectiveDate, e.CreatedBy, e.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range e.Postings {
+		accountID, err := ledgerAccountID(tx, p.Account, e.FinancingRequestID, e.Currency)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO ledger_postings (id, journal_entry_id, account_id, amount_minor) VALUES ($1, $2, $3, $4)`,
+			uuid.New(), e.ID, accountID, p.Amount.Minor)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ledgerAccountID returns the account for a code, opening it on first use
+func ledgerAccountID(tx *sql.Tx, code string, requestID uuid.UUID, currency string) (uuid.UUID, error) {
+	accountType := ledgerAccountTypes[code]
+	var owner *uuid.UUID
+	if accountType.PerRequest {
+		owner = &requestID
+	}
+
+	insertQuery := `INSERT INTO ledger_accounts (id, code, type, financing_request_id, currency, created_at)
+	                VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`
+	if _, err := tx.Exec(insertQuery, uuid.New(), code, accountType.Type, owner, currency, time.Now()); err != nil {
+		return uuid.Nil, err
+	}
+
+	var id uuid.UUID
+	var err error
+	if owner != nil {
+		err = tx.QueryRow(`SELECT id FROM ledger_accounts WHERE code = $1 AND financing_request_id = $2`, code, requestID).Scan(&id)
+	} else {
+		err = tx.QueryRow(`SELECT id FROM ledger_accounts WHERE code = $1 AND currency = $2 AND financing_request_id IS NULL`, code, currency).Scan(&id)
+	}
+	return id, err
+}
+
+// loanBalances is what a borrower owes on each receivable account, in minor units
+type loanBalances struct {
+	Principal int64
+	Interest  int64
+	Fees      int64
+}
+
+func (b loanBalances) total() int64 {
+	return b.Principal + b.Interest + b.Fees
+}
+
+// settle splits a payment of amount over the balances: fees first, then interest, then
+// principal. Whatever exceeds the balances is left out.
+func (b loanBalances) settle(amount int64) loanBalances {
+	var paid loanBalances
+	paid.Fees = takeUpTo(&amount, b.Fees)
+	paid.Interest = takeUpTo(&amount, b.Interest)
+	paid.Principal = takeUpTo(&amount, b.Principal)
+	return paid
+}
+
+// takeUpTo takes owed from *remaining, or as much of it as *remaining holds
+func takeUpTo(remaining *int64, owed int64) int64 {
+	part := owed
+	if part > *remaining {
+		part = *remaining
+	}
+	*remaining -= part
+	return part
+}
+
+func getLoanBalances(db DBTX, requestID uuid.UUID) (loanBalances, error) {
+	var b loanBalances
+	query := `SELECT COALESCE(SUM(p.amount_minor) FILTER (WHERE a.code = $2), 0),
+	                 COALESCE(SUM(p.amount_minor) FILTER (WHERE a.code = $3), 0),
+	                 COALESCE(SUM(p.amount_minor) FILTER (WHERE a.code = $4), 0)
+	          FROM ledger_postings p JOIN ledger_accounts a ON a.id = p.account_id
+	          WHERE a.financing_request_id = $1`
+	err := db.QueryRow(query, requestID, LedgerAccountLoanPrincipal, LedgerAccountInterestReceivable, LedgerAccountFeeReceivable).
+		Scan(&b.Principal, &b.Interest, &b.Fees)
+	return b, err
+}
+
+// lockDisbursedRequest locks a request for posting. It returns nil if the request does not exist
+// and ErrLoanNotDisbursed if it has not been disbursed.
+func lockDisbursedRequest(tx *sql.Tx, id uuid.UUID) (*FinancingRequest, error) {
+	query := `SELECT ` + financingRequestColumns + ` FROM financing_requests WHERE id = $1 FOR UPDATE`
+	fr, err := scanFinancingRequest(tx.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fr.Status != FinancingStatusDisbursed {
+		return nil, ErrLoanNotDisbursed
+	}
+	return fr, nil
+}
+
+// DisburseFinancingRequest moves an approved request to disbursed and posts the principal paid
+// out to the borrower. Installments already due by then are posted as well.
+func DisburseFinancingRequest(db *sql.DB, id uuid.UUID, actorID *uuid.UUID, reason string) (*FinancingRequest, error) {
+	var fr *FinancingRequest
+	err := withTx(db, func(tx *sql.Tx) error {
+		var err error
+		fr, err = transitionFinancingRequest(tx, id, "", FinancingStatusDisbursed, actorID, reason)
+		if err != nil || fr == nil {
+			return err
+		}
+
+		// The schedule principal is the amount agreed, which an accepted offer may have changed
+		var principal int64
+		var currency string
+		err = tx.QueryRow(`SELECT principal_minor, currency FROM repayment_schedules WHERE financing_request_id = $1`, fr.ID).
+			Scan(&principal, &currency)
+		if err == sql.ErrNoRows {
+			return ErrNoRepaymentSchedule
+		}
+		if err != nil {
+			return err
+		}
+
+		amount := money.New(principal, currency)
+		entry := &JournalEntry{
+			FinancingRequestID: fr.ID,
+			Type:               EntryTypeDisbursement,
+			Currency:           currency,
+			Description:        "Loan disbursed",
+			EffectiveDate:      fr.UpdatedAt.UTC().Format("2006-01-02"),
+			CreatedBy:          actorID,
+			Postings:           []LedgerPosting{debit(LedgerAccountLoanPrincipal, amount), credit(LedgerAccountCash, amount)},
+		}
+		if err := entry.post(tx); err != nil {
+			return err
+		}
+
+		_, err = accrueDueInstallments(tx, fr.ID, currency, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fr, nil
+}
+
+// AccrueDueInstallments posts the interest and fees of every installment of a disbursed request
+// that fell due on or before asOf and was not posted yet. Installments prepaid in full before
+// they fell due accrue nothing. It returns the number of entries posted.
+func AccrueDueInstallments(db *sql.DB, requestID uuid.UUID, asOf time.Time) (int, error) {
+	var posted int
+	err := withTx(db, func(tx *sql.Tx) error {
+		fr, err := lockDisbursedRequest(tx, requestID)
+		if err != nil || fr == nil {
+			return err
+		}
+		posted, err = accrueDueInstallments(tx, fr.ID, fr.Currency, asOf)
+		return err
+	})
+	return posted, err
+}
+
+// accrueDueInstallments expects the request row to be locked by the caller
+func accrueDueInstallments(tx *sql.Tx, requestID uuid.UUID, currency string, asOf time.Time) (int, error) {
+	query := `SELECT i.id, i.installment_number, to_char(i.due_date, 'YYYY-MM-DD'), i.interest_minor, i.fee_minor
+	          FROM repayment_installments i
+	          WHERE i.financing_request_id = $1 AND i.due_date <= $2 AND i.status NOT IN ($3, $4)
+	            AND NOT EXISTS (SELECT 1 FROM journal_entries je WHERE je.installment_id = i.id AND je.entry_type = $5)
+	          ORDER BY i.installment_number`
+	rows, err := tx.Query(query, requestID, asOf.Format("2006-01-02"), InstallmentStatusWrittenOff, InstallmentStatusPaid,
+		EntryTypeInstallmentDue)
+	if err != nil {
+		return 0, err
+	}
+
+	type dueInstallment struct {
+		ID       uuid.UUID
+		Number   int
+		DueDate  string
+		Interest int64
+		Fees     int64
+	}
+	var due []dueInstallment
+	for rows.Next() {
+		var d dueInstallment
+		if err := rows.Scan(&d.ID, &d.Number, &d.DueDate, &d.Interest, &d.Fees); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	for _, d := range due {
+		// Principal is already receivable from disbursement; only interest and fees accrue.
+		// Interest-free installments without fees have nothing to post.
+		if d.Interest == 0 && d.Fees == 0 {
+			continue
+		}
+		installmentID := d.ID
+		interest := money.New(d.Interest, currency)
+		fees := money.New(d.Fees, currency)
+		entry := &JournalEntry{
+			FinancingRequestID: requestID,
+			Type:               EntryTypeInstallmentDue,
+			Currency:           currency,
+			Description:        fmt.Sprintf("Installment %d due", d.Number),
+			InstallmentID:      &installmentID,
+			EffectiveDate:      d.DueDate,
+			Postings: []LedgerPosting{
+				debit(LedgerAccountInterestReceivable, interest), credit(LedgerAccountInterestIncome, interest),
+				debit(LedgerAccountFeeReceivable, fees), credit(LedgerAccountFeeIncome, fees),
+			},
+		}
+		if err := entry.post(tx); err != nil {
+			return posted, err
+		}
+		posted++
+	}
+	return posted, nil
+}
+
+// RecordRepayment posts a payment received from the borrower. It settles fees first, then
+// interest, then principal, and applies each part to the installments in order. Paying more
+// than the outstanding principal and everything due yields ErrRepaymentExceedsBalance.
+func RecordRepayment(db *sql.DB, requestID uuid.UUID, amount money.Money, receivedOn time.Time, reference string, actorID *uuid.UUID) (*JournalEntry, error) {
+	var entry *JournalEntry
+	err := withTx(db, func(tx *sql.Tx) error {
+		fr, err := lockDisbursedRequest(tx, requestID)
+		if err != nil || fr == nil {
+			return err
+		}
+		if amount.Currency != fr.Currency {
+			return ErrCurrencyMismatch
+		}
+		asOf := time.Now().UTC()
+		if _, err := accrueDueInstallments(tx, fr.ID, fr.Currency, asOf); err != nil {
+			return err
+		}
+
+		balances, err := getLoanBalances(tx, fr.ID)
+		if err != nil {
+			return err
+		}
+		if amount.Minor > balances.total() {
+			return ErrRepaymentExceedsBalance
+		}
+
+		paid := balances.settle(amount.Minor)
+		fees := money.New(paid.Fees, fr.Currency)
+		interest := money.New(paid.Interest, fr.Currency)
+		principal := money.New(paid.Principal, fr.Currency)
+
+		entry = &JournalEntry{
+			FinancingRequestID: fr.ID,
+			Type:               EntryTypeRepayment,
+			Currency:           fr.Currency,
+			Description:        "Repayment received",
+			Reference:          reference,
+			EffectiveDate:      receivedOn.Format("2006-01-02"),
+			CreatedBy:          actorID,
+			Postings: []LedgerPosting{
+				debit(LedgerAccountCash, amount),
+				credit(LedgerAccountFeeReceivable, fees),
+				credit(LedgerAccountInterestReceivable, interest),
+				credit(LedgerAccountLoanPrincipal, principal),
+			},
+		}
+		if err := entry.post(tx); err != nil {
+			return err
+		}
+
+		return allocateToInstallments(tx, fr.ID, paid, asOf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// openInstallment is the unpaid part of an installment. Due is whether it fell due by the
+// repayment date.
+type openInstallment struct {
+	ID        uuid.UUID
+	Due       bool
+	Fees      int64
+	Interest  int64
+	Principal int64
+}
+
+// installmentAllocation is the part of a repayment applied to one installment
+type installmentAllocation struct {
+	ID      uuid.UUID
+	Paid    loanBalances
+	Settled bool // the installment is paid in full
+}
+
+func (a installmentAllocation) total() int64 {
+	return a.Paid.total()
+}
+
+// planAllocations applies the parts of a repayment to the open installments, oldest first,
+// as the journal entry settled them. Fees and interest only go to installments that fell
+// due, since only those were accrued; whatever fees are left paid late or other fees.
+// Principal may also pay off later installments: one whose principal is prepaid in full is
+// settled, and its interest and fees are never accrued. Installments that get nothing are
+// left out.
+func planAllocations(open []openInstallment, paid loanBalances) []installmentAllocation {
+	var allocations []installmentAllocation
+	for _, o := range open {
+		if paid.total() <= 0 {
+			break
+		}
+		var a installmentAllocation
+		if o.Due {
+			a.Paid.Fees = takeUpTo(&paid.Fees, o.Fees)
+			a.Paid.Interest = takeUpTo(&paid.Interest, o.Interest)
+		}
+		a.Paid.Principal = takeUpTo(&paid.Principal, o.Principal)
+		if a.total() == 0 {
+			continue
+		}
+
+		a.ID = o.ID
+		a.Settled = a.Paid.Principal == o.Principal
+		if o.Due {
+			a.Settled = a.Settled && a.Paid.Fees == o.Fees && a.Paid.Interest == o.Interest
+		}
+		allocations = append(allocations, a)
+	}
+	return allocations
+}
+
+// allocateToInstallments records the allocation of a repayment's parts, as planned by
+// planAllocations, on the open installments
+func allocateToInstallments(tx *sql.Tx, requestID uuid.UUID, paid loanBalances, asOf time.Time) error {
+	query := `SELECT id, due_date <= $2, fee_minor - fee_paid_minor, interest_minor - interest_paid_minor,
+	                 principal_minor - principal_paid_minor
+	          FROM repayment_installments
+	          WHERE financing_request_id = $1 AND status NOT IN ($3, $4)
+	          ORDER BY installment_number`
+	rows, err := tx.Query(query, requestID, asOf.Format("2006-01-02"), InstallmentStatusPaid, InstallmentStatusWrittenOff)
+	if err != nil {
+		return err
+	}
+
+	var open []openInstallment
+	for rows.Next() {
+		var o openInstallment
+		if err := rows.Scan(&o.ID, &o.Due, &o.Fees, &o.Interest, &o.Principal); err != nil {
+			rows.Close()
+			return err
+		}
+		open = append(open, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, a := range planAllocations(open, paid) {
+		var err error
+		if a.Settled {
+			_, err = tx.Exec(`UPDATE repayment_installments SET fee_paid_minor = fee_paid_minor + $1, interest_paid_minor = interest_paid_minor + $2,
+			                  principal_paid_minor = principal_paid_minor + $3, paid_minor = paid_minor + $4, status = $5, paid_at = $6
+			                  WHERE id = $7`,
+				a.Paid.Fees, a.Paid.Interest, a.Paid.Principal, a.total(), InstallmentStatusPaid, now, a.ID)
+		} else {
+			// A partly paid installment stays overdue until it is paid in full
+			_, err = tx.Exec(`UPDATE repayment_installments SET fee_paid_minor = fee_paid_minor + $1, interest_paid_minor = interest_paid_minor + $2,
+			                  principal_paid_minor = principal_paid_minor + $3, paid_minor = paid_minor + $4,
+			                  status = CASE WHEN status = $5 THEN status ELSE $6 END WHERE id = $7`,
+				a.Paid.Fees, a.Paid.Interest, a.Paid.Principal, a.total(), InstallmentStatusOverdue, InstallmentStatusPartiallyPaid, a.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChargeFee posts a fee charged to the borrower of a disbursed request
+func ChargeFee(db *sql.DB, requestID uuid.UUID, amount money.Money, description string, actorID *uuid.UUID) (*JournalEntry, error) {
+	var entry *JournalEntry
+	err := withTx(db, func(tx *sql.Tx) error {
+		fr, err := lockDisbursedRequest(tx, requestID)
+		if err != nil || fr == nil {
+			return err
+		}
+		if amount.Currency != fr.Currency {
+			return ErrCurrencyMismatch
+		}
+
+		entry = &JournalEntry{
+			FinancingRequestID: fr.ID,
+			Type:               EntryTypeFee,
+			Currency:           fr.Currency,
+			Description:        description,
+			EffectiveDate:      time.Now().UTC().Format("2006-01-02"),
+			CreatedBy:          actorID,
+			Postings:           []LedgerPosting{debit(LedgerAccountFeeReceivable, amount), credit(LedgerAccountFeeIncome, amount)},
+		}
+		return entry.post(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// WriteOffLoan writes off everything still owed on a disbursed request as a credit loss and
+// closes its unpaid installments
+func WriteOffLoan(db *sql.DB, requestID uuid.UUID, reason string, actorID *uuid.UUID) (*JournalEntry, error) {
+	var entry *JournalEntry
+	err := withTx(db, func(tx *sql.Tx) error {
+		fr, err := lockDisbursedRequest(tx, requestID)
+		if err != nil || fr == nil {
+			return err
+		}
+		if _, err := accrueDueInstallments(tx, fr.ID, fr.Currency, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		balances, err := getLoanBalances(tx, fr.ID)
+		if err != nil {
+			return err
+		}
+		if balances.total() <= 0 {
+			return ErrNothingOutstanding
+		}
+
+		entry = &JournalEntry{
+			FinancingRequestID: fr.ID,
+			Type:               EntryTypeWriteOff,
+			Currency:           fr.Currency,
+			Description:        reason,
+			EffectiveDate:      time.Now().UTC().Format("2006-01-02"),
+			CreatedBy:          actorID,
+			Postings: []LedgerPosting{
+				debit(LedgerAccountCreditLosses, money.New(balances.total(), fr.Currency)),
+				credit(LedgerAccountFeeReceivable, money.New(balances.Fees, fr.Currency)),
+				credit(LedgerAccountInterestReceivable, money.New(balances.Interest, fr.Currency)),
+				credit(LedgerAccountLoanPrincipal, money.New(balances.Principal, fr.Currency)),
+			},
+		}
+		if err := entry.post(tx); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE repayment_installments SET status = $1 WHERE financing_request_id = $2 AND status <> $3`,
+			InstallmentStatusWrittenOff, fr.ID, InstallmentStatusPaid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetJournalEntries returns the ledger entries of a financing request with their postings, oldest first
+func GetJournalEntries(db *sql.DB, requestID uuid.UUID) ([]JournalEntry, error) {
+	query := `SELECT je.id, je.financing_request_id, je.entry_type, je.currency, COALESCE(je.description, ''), COALESCE(je.reference, ''),
+	                 je.installment_id, to_char(je.effective_date, 'YYYY-MM-DD'), je.created_by, je.created_at, a.code, p.amount_minor
+	          FROM journal_entries je
+	          JOIN ledger_postings p ON p.journal_entry_id = je.id
+	          JOIN ledger_accounts a ON a.id = p.account_id
+	          WHERE je.financing_request_id = $1
+	          ORDER BY je.effective_date, je.created_at, je.id, p.amount_minor DESC`
+
+	rows, err := db.Query(query, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []JournalEntry{}
+	for rows.Next() {
+		var e JournalEntry
+		var installmentID, createdBy uuid.NullUUID
+		var account string
+		var amount int64
+		if err := rows.Scan(&e.ID, &e.FinancingRequestID, &e.Type, &e.Currency, &e.Description, &e.Reference, &installmentID,
+			&e.EffectiveDate, &createdBy, &e.CreatedAt, &account, &amount); err != nil {
+			return nil, err
+		}
+
+		if n := len(entries); n == 0 || entries[n-1].ID != e.ID {
+			if installmentID.Valid {
+				e.InstallmentID = &installmentID.UUID
+			}
+			if createdBy.Valid {
+				e.CreatedBy = &createdBy.UUID
+			}
+			e.Postings = []LedgerPosting{}
+			entries = append(entries, e)
+		}
+		last := &entries[len(entries)-1]
+		last.Postings = append(last.Postings, LedgerPosting{Account: account, Amount: money.New(amount, e.Currency)})
+	}
+
+	return entries, rows.Err()
+}
+
+// LoanStatement is the borrower's view of a disbursed loan: what was charged, what was paid
+// and what is still owed
+type LoanStatement struct {
+	FinancingRequestID   uuid.UUID       `json:"financing_request_id"`
+	Currency             string          `json:"currency"`
+	Disbursed            money.Money     `json:"disbursed"`
+	TotalRepaid          money.Money     `json:"total_repaid"`
+	WrittenOff           money.Money     `json:"written_off"`
+	PrincipalOutstanding money.Money     `json:"principal_outstanding"`
+	InterestDue          money.Money     `json:"interest_due"`
+	FeesDue              money.Money     `json:"fees_due"`
+	TotalOutstanding     money.Money     `json:"total_outstanding"`
+	Lines                []StatementLine `json:"lines"`
+}
+
+// StatementLine is one ledger entry as it changed what the borrower owes
+type StatementLine struct {
+	Date        string      `json:"date"` // YYYY-MM-DD
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Reference   string      `json:"reference,omitempty"`
+	Charge      money.Money `json:"charge"`  // added to the balance
+	Payment     money.Money `json:"payment"` // taken off the balance
+	Balance     money.Money `json:"balance"`
+}
+
+// GetLoanStatement builds the statement of a financing request from its ledger. The
+// receivable accounts are what the borrower owes, so each entry's postings to them are
+// the change in the borrower's balance.
+func GetLoanStatement(db *sql.DB, requestID uuid.UUID, currency string) (*LoanStatement, error) {
+	entries, err := GetJournalEntries(db, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	zero := money.New(0, currency)
+	s := &LoanStatement{
+		FinancingRequestID:   requestID,
+		Currency:             currency,
+		Disbursed:            zero,
+		TotalRepaid:          zero,
+		WrittenOff:           zero,
+		PrincipalOutstanding: zero,
+		InterestDue:          zero,
+		FeesDue:              zero,
+		TotalOutstanding:     zero,
+		Lines:                []StatementLine{},
+	}
+
+	for _, e := range entries {
+		var change int64
+		for _, p := range e.Postings {
+			switch p.Account {
+			case LedgerAccountLoanPrincipal:
+				s.PrincipalOutstanding = s.PrincipalOutstanding.Add(p.Amount)
+			case LedgerAccountInterestReceivable:
+				s.InterestDue = s.InterestDue.Add(p.Amount)
+			case LedgerAccountFeeReceivable:
+				s.FeesDue = s.FeesDue.Add(p.Amount)
+			default:
+				continue
+			}
+			change += p.Amount.Minor
+		}
+
+		switch e.Type {
+		case EntryTypeDisbursement:
+			s.Disbursed = s.Disbursed.Add(money.New(change, currency))
+		case EntryTypeRepayment:
+			s.TotalRepaid = s.TotalRepaid.Sub(money.New(change, currency))
+		case EntryTypeWriteOff:
+			s.WrittenOff = s.WrittenOff.Sub(money.New(change, currency))
+		}
+
+		s.TotalOutstanding = s.TotalOutstanding.Add(money.New(change, currency))
+		line := StatementLine{
+			Date:        e.EffectiveDate,
+			Type:        e.Type,
+			Description: e.Description,
+			Reference:   e.Reference,
+			Charge:      zero,
+			Payment:     zero,
+			Balance:     s.TotalOutstanding,
+		}
+		if change >= 0 {
+			line.Charge = money.New(change, currency)
+		} else {
+			line.Payment = money.New(-change, currency)
+		}
+		s.Lines = append(s.Lines, line)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLoanBalancesSettle(t *testing.T) {
+	owed := loanBalances{Principal: 10000, Interest: 500, Fees: 200}
+	tests := []struct {
+		name   string
+		amount int64
+		want   loanBalances
+	}{
+		{name: "part of the fees", amount: 150, want: loanBalances{Fees: 150}},
+		{name: "fees exactly", amount: 200, want: loanBalances{Fees: 200}},
+		{name: "fees and part of the interest", amount: 450, want: loanBalances{Interest: 250, Fees: 200}},
+		{name: "fees, interest and part of the principal", amount: 1700, want: loanBalances{Principal: 1000, Interest: 500, Fees: 200}},
+		{name: "everything", amount: 10700, want: owed},
+		{name: "more than owed", amount: 20000, want: owed},
+		{name: "nothing", amount: 0, want: loanBalances{}},
+	}
+	for _, tt := range tests {
+		if got := owed.settle(tt.amount); got != tt.want {
+			t.Errorf("%s: settle(%d) = %+v, want %+v", tt.name, tt.amount, got, tt.want)
+		}
+	}
+
+	// Nothing due yet goes straight to principal
+	if got := (loanBalances{Principal: 10000}).settle(2500); got != (loanBalances{Principal: 2500}) {
+		t.Errorf("settle with only principal owed = %+v, want 2500 of principal", got)
+	}
+}
+
+func TestPlanAllocations(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	// Two installments fell due; the third has not, so its interest is not accrued yet
+	open := []openInstallment{
+		{ID: ids[0], Due: true, Principal: 1000, Interest: 100, Fees: 50},
+		{ID: ids[1], Due: true, Principal: 1000, Interest: 90},
+		{ID: ids[2], Due: false, Principal: 1000, Interest: 80},
+	}
+
+	tests := []struct {
+		name string
+		paid loanBalances
+		want []installmentAllocation
+	}{
+		{
+			name: "fees only",
+			paid: loanBalances{Fees: 30},
+			want: []installmentAllocation{
+				{ID: ids[0], Paid: loanBalances{Fees: 30}},
+			},
+		},
+		{
+			name: "first installment exactly",
+			paid: loanBalances{Principal: 1000, Interest: 100, Fees: 50},
+			want: []installmentAllocation{
+				{ID: ids[0], Paid: loanBalances{Principal: 1000, Interest: 100, Fees: 50}, Settled: true},
+			},
+		},
+		{
+			// Interest of both due installments is settled before principal of the first
+			name: "interest across installments before principal",
+			paid: loanBalances{Principal: 300, Interest: 190, Fees: 50},
+			want: []installmentAllocation{
+				{ID: ids[0], Paid: loanBalances{Principal: 300, Interest: 100, Fees: 50}},
+				{ID: ids[1], Paid: loanBalances{Interest: 90}},
+			},
+		},
+		{
+			name: "both due installments",
+			paid: loanBalances{Principal: 2000, Interest: 190, Fees: 50},
+			want: []installmentAllocation{
+				{ID: ids[0], Paid: loanBalances{Principal: 1000, Interest: 100, Fees: 50}, Settled: true},
+				{ID: ids[1], Paid: loanBalances{Principal: 1000, Interest: 90}, Settled: true},
+			},
+		},
+		{
+			// Prepaying the principal of an installment that is not due settles it without
+			// its interest, which is never accrued
+			name: "prepaid future installment",
+			paid: loanBalances{Principal: 3000, Interest: 190, Fees: 50},
+			want: []installmentAllocation{
+				{ID: ids[0], Paid: loanBalances{Principal: 1000, Interest: 100, Fees: 50}, Settled: true},
+				{ID: ids[1], Paid: loanBalances{Principal: 1000, Interest: 90}, Settled: true},
+				{ID: ids[2], Paid: loanBalances{Principal: 1000}, Settled: true},
+			},
+		},
+		{
+			name: "partly prepaid future installment",
+			paid: loanBalances{Principal: 2400, Interest: 190, Fees: 50},
+			want: []installmentAllocation{
+				{ID: ids[0], Paid: loanBalances{Principal: 1000, Interest: 100, Fees: 50}, Settled: true},
+				{ID: ids[1], Paid: loanBalances{Principal: 1000, Interest: 90}, Settled: true},
+				{ID: ids[2], Paid: loanBalances{Principal: 400}},
+			},
+		},
+		{
+			// Principal left unpaid on the first installment keeps it open while interest
+			// goes to the second
+			name: "principal short on the first installment",
+			paid: loanBalances{Principal: 999, Interest: 190, Fees: 50},
+			want: []installmentAllocation{
+				{ID: ids[0], Paid: loanBalances{Principal: 999, Interest: 100, Fees: 50}},
+				{ID: ids[1], Paid: loanBalances{Interest: 90}},
+			},
+		},
+		{
+			name: "nothing",
+			paid: loanBalances{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planAllocations(open, tt.paid)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("planAllocations =\n%+v\nwant\n%+v", got, tt.want)
+			}
+			var allocated loanBalances
+			for _, a := range got {
+				allocated.Principal += a.Paid.Principal
+				allocated.Interest += a.Paid.Interest
+				allocated.Fees += a.Paid.Fees
+			}
+			if allocated != tt.paid {
+				t.Errorf("allocated %+v, want all of %+v", allocated, tt.paid)
+			}
+		})
+	}
+}
+
+func TestPlanAllocationsSkipsSettledParts(t *testing.T) {
+	// The first installment's principal is already paid; only its interest is open
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	open := []openInstallment{
+		{ID: ids[0], Due: true, Interest: 100},
+		{ID: ids[1], Due: true, Principal: 1000, Interest: 90},
+	}
+	got := planAllocations(open, loanBalances{Principal: 500, Interest: 190})
+	want := []installmentAllocation{
+		{ID: ids[0], Paid: loanBalances{Interest: 100}, Settled: true},
+		{ID: ids[1], Paid: loanBalances{Principal: 500, Interest: 90}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("planAllocations =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Trade license expiry flags, set by the daily job
+const (
+	LicenseExpiryExpiring = "expiring" // expires within LicenseExpiryWarningDays
+	LicenseExpiryExpired  = "expired"
+)
+
+// LicenseExpiryWarningDays is how far ahead of its expiry date a license is flagged
+const LicenseExpiryWarningDays = 30
+
+// LicenseReminderDays are the days before the expiry date on which the owner of a license is
+// reminded, furthest first. 0 is the day it expires.
+var LicenseReminderDays = []int{30, 7, 0}
+
+// LicenseExpiry is a trade license close to or past its expiry date, with where to remind
+// its owner
+type LicenseExpiry struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	Email            string
+	IssuingAuthority string
+	ExpiresOn        time.Time
+	ExpiryStatus     string // empty until flagged
+	ReminderDays     *int   // the last reminder sent for ExpiresOn, nil if none
+}
+
+// GetTradeLicensesExpiringBy returns the licenses that expire on or before a day, except the
+// ones already flagged expired whose last reminder was sent
+func GetTradeLicensesExpiringBy(db *sql.DB, cutoff time.Time) ([]LicenseExpiry, error) {
+	query := `SELECT tl.id, tl.user_id, u.email, COALESCE(tl.issuing_authority, ''), tl.expires_on,
+	                 COALESCE(tl.expiry_status, ''), tl.expiry_reminder_days
+	          FROM trade_licenses tl JOIN users u ON u.id = tl.user_id
+	          WHERE tl.expires_on <= $1::date
+	              AND NOT (tl.expiry_status IS NOT DISTINCT FROM 'expired' AND tl.expiry_reminder_days IS NOT DISTINCT FROM 0)
+	          ORDER BY tl.expires_on`
+	rows, err := db.Query(query, cutoff.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	licenses := []LicenseExpiry{}
+	for rows.Next() {
+		var l LicenseExpiry
+		var reminderDays sql.NullInt64
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Email, &l.IssuingAuthority, &l.ExpiresOn, &l.ExpiryStatus, &reminderDays); err != nil {
+			return nil, err
+		}
+		if reminderDays.Valid {
+			days := int(reminderDays.Int64)
+			l.ReminderDays = &days
+		}
+		licenses = append(licenses, l)
+	}
+	return licenses, rows.Err()
+}
+
+// FlagTradeLicenseExpiry stores the expiry flag of a license and, unless reminderDays is nil,
+// the reminder just sent. Nothing changes if the license was renewed meanwhile.
+func FlagTradeLicenseExpiry(db *sql.DB, id uuid.UUID, expiresOn time.Time, status string, reminderDays *int) error {
+	query := `UPDATE trade_licenses SET expiry_status = $1, expiry_reminder_days = COALESCE($2, expiry_reminder_days)
+	          WHERE id = $3 AND expires_on = $4::date`
+	_, err := db.Exec(query, status, reminderDays, id, expiresOn.Format("2006-01-02"))
+	return err
+}
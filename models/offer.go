@@ -0,0 +1,255 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/money"
+
+	"github.com/google/uuid"
+)
+
+// Loan offer statuses
+const (
+	OfferStatusPending    = "pending"
+	OfferStatusAccepted   = "accepted"
+	OfferStatusDeclined   = "declined"
+	OfferStatusExpired    = "expired"
+	OfferStatusSuperseded = "superseded" // replaced by a newer offer, or the request was rejected or withdrawn
+)
+
+var (
+	// ErrRequestNotUnderReview is returned when an offer is issued on a request that is not under review
+	ErrRequestNotUnderReview = errors.New("offers can only be issued on requests under review")
+	// ErrOfferNotPending is returned when responding to an offer that was already answered or replaced
+	ErrOfferNotPending = errors.New("offer is no longer open")
+	// ErrOfferExpired is returned when responding to an offer after its expiry
+	ErrOfferExpired = errors.New("offer has expired")
+)
+
+// LoanOffer is the terms an underwriter offers on a financing request.
+// The SME accepts or declines it before ExpiresAt.
+type LoanOffer struct {
+	ID                 uuid.UUID    `json:"id"`
+	FinancingRequestID uuid.UUID    `json:"financing_request_id"`
+	Amount             money.Money  `json:"amount"`
+	Currency           string       `json:"currency"`
+	RepaymentPeriod    int          `json:"repayment_period"` // in months
+	Pricing            loan.Pricing `json:"pricing"`
+	Note               string       `json:"note,omitempty"`
+	Status             string       `json:"status"`
+	ExpiresAt          time.Time    `json:"expires_at"`
+	IssuedBy           uuid.UUID    `json:"issued_by"`
+	RespondedAt        *time.Time   `json:"responded_at,omitempty"`
+	ResponseReason     string       `json:"response_reason,omitempty"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at"`
+}
+
+// Terms returns the loan terms of the offer, with installments due monthly from startDate
+func (o *LoanOffer) Terms(startDate time.Time) loan.Terms {
+	return loan.Terms{
+		Pricing:   o.Pricing,
+		Principal: o.Amount,
+		Months:    o.RepaymentPeriod,
+		StartDate: startDate,
+	}
+}
+
+const loanOfferColumns = `id, financing_request_id, amount_minor, currency, repayment_period, annual_rate_bps, rate_method,
+	          processing_fee_bps, COALESCE(note, ''), status, expires_at, issued_by, responded_at, COALESCE(response_reason, ''),
+	          created_at, updated_at`
+
+func scanLoanOffer(row interface{ Scan(...interface{}) error }) (*LoanOffer, error) {
+	o := &LoanOffer{}
+	var method string
+	var respondedAt sql.NullTime
+	err := row.Scan(&o.ID, &o.FinancingRequestID, &o.Amount.Minor, &o.Currency, &o.RepaymentPeriod, &o.Pricing.AnnualRateBps,
+		&method, &o.Pricing.ProcessingFeeBps, &o.Note, &o.Status, &o.ExpiresAt, &o.IssuedBy, &respondedAt, &o.ResponseReason,
+		&o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	o.Amount.Currency = o.Currency
+	o.Pricing.Method = loan.Method(method)
+	if respondedAt.Valid {
+		o.RespondedAt = &respondedAt.Time
+	}
+	// Pending offers past their expiry are reported as expired even before they are marked
+	if o.Status == OfferStatusPending && time.Now().After(o.ExpiresAt) {
+		o.Status = OfferStatusExpired
+	}
+	return o, nil
+}
+
+// Issue saves a new offer on a request under review. Any open offer on the request is superseded.
+func (o *LoanOffer) Issue(db *sql.DB) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		var status string
+		err := tx.QueryRow(`SELECT status FROM financing_requests WHERE id = $1 FOR UPDATE`, o.FinancingRequestID).Scan(&status)
+		if err != nil {
+			return err
+		}
+		if status != FinancingStatusUnderReview {
+			return ErrRequestNotUnderReview
+		}
+
+		now := time.Now()
+		supersedeQuery := `UPDATE loan_offers SET status = $1, updated_at = $2 WHERE financing_request_id = $3 AND status = $4`
+		if _, err := tx.Exec(supersedeQuery, OfferStatusSuperseded, now, o.FinancingRequestID, OfferStatusPending); err != nil {
+			return err
+		}
+
+		o.ID = uuid.New()
+		o.Currency = o.Amount.Currency
+		o.Status = OfferStatusPending
+		o.CreatedAt = now
+		o.UpdatedAt = now
+		query := `INSERT INTO loan_offers (id, financing_request_id, amount_minor, currency, repayment_period, annual_rate_bps, rate_method,
+		          processing_fee_bps, note, status, expires_at, issued_by, created_at, updated_at)
+		          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13, $14)`
+		_, err = tx.Exec(query, o.ID, o.FinancingRequestID, o.Amount.Minor, o.Currency, o.RepaymentPeriod, o.Pricing.AnnualRateBps,
+			string(o.Pricing.Method), o.Pricing.ProcessingFeeBps, o.Note, o.Status, o.ExpiresAt, o.IssuedBy, o.CreatedAt, o.UpdatedAt)
+		return err
+	})
+}
+
+func GetLoanOfferByID(db *sql.DB, id uuid.UUID) (*LoanOffer, error) {
+	query := `SELECT ` + loanOfferColumns + ` FROM loan_offers WHERE id = $1`
+	o, err := scanLoanOffer(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return o, err
+}
+
+// GetLoanOffersByRequestID returns the offers of a request, newest first
+func GetLoanOffersByRequestID(db *sql.DB, requestID uuid.UUID) ([]LoanOffer, error) {
+	query := `SELECT ` + loanOfferColumns + ` FROM loan_offers WHERE financing_request_id = $1 ORDER BY created_at DESC`
+
+	rows, err := db.Query(query, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := []LoanOffer{}
+	for rows.Next() {
+		o, err := scanLoanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, *o)
+	}
+
+	return offers, rows.Err()
+}
+
+// GetAcceptedLoanOffer returns the offer the SME accepted on a request, or nil if the request
+// was approved without one
+func GetAcceptedLoanOffer(db *sql.DB, requestID uuid.UUID) (*LoanOffer, error) {
+	query := `SELECT ` + loanOfferColumns + ` FROM loan_offers WHERE financing_request_id = $1 AND status = $2`
+	o, err := scanLoanOffer(db.QueryRow(query, requestID, OfferStatusAccepted))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return o, err
+}
+
+// lockOpenOffer loads an offer for update and checks that it can still be answered.
+// An offer found past its expiry is marked expired before ErrOfferExpired is returned.
+func lockOpenOffer(tx *sql.Tx, id uuid.UUID) (*LoanOffer, error) {
+	query := `SELECT ` + loanOfferColumns + ` FROM loan_offers WHERE id = $1 FOR UPDATE`
+	o, err := scanLoanOffer(tx.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+	switch o.Status {
+	case OfferStatusPending:
+		return o, nil
+	case OfferStatusExpired:
+		return nil, ErrOfferExpired
+	}
+	return nil, ErrOfferNotPending
+}
+
+// ExpireLoanOffers marks pending offers past their expiry as expired and returns how many were marked
+func ExpireLoanOffers(db DBTX) (int64, error) {
+	now := time.Now()
+	result, err := db.Exec(`UPDATE loan_offers SET status = $1, updated_at = $2 WHERE status = $3 AND expires_at < $2`,
+		OfferStatusExpired, now, OfferStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// AcceptLoanOffer accepts an open offer, approves its request and fixes the repayment schedule
+// from the offer's terms, all in one transaction. It returns sql.ErrNoRows if the offer does not exist.
+func AcceptLoanOffer(db *sql.DB, id uuid.UUID, actorID uuid.UUID) (*LoanOffer, *FinancingRequest, error) {
+	var offer *LoanOffer
+	var fr *FinancingRequest
+	err := withTx(db, func(tx *sql.Tx) error {
+		var err error
+		if offer, err = lockOpenOffer(tx, id); err != nil {
+			return err
+		}
+
+		fr, err = transitionFinancingRequest(tx, offer.FinancingRequestID, FinancingStatusUnderReview, FinancingStatusApproved, &actorID, "Loan offer accepted")
+		if err != nil {
+			return err
+		}
+		if fr == nil {
+			return sql.ErrNoRows
+		}
+
+		if err := fixRepaymentSchedule(tx, fr.ID, offer.Terms(time.Now().UTC())); err != nil {
+			return err
+		}
+
+		return offer.respond(tx, OfferStatusAccepted, "")
+	})
+	if err == nil {
+		return offer, fr, nil
+	}
+	if err == ErrOfferExpired {
+		// Persist the expiry outside the rolled-back transaction
+		_, _ = ExpireLoanOffers(db)
+	}
+	return nil, nil, err
+}
+
+// DeclineLoanOffer declines an open offer. The request stays under review so the underwriter
+// can issue another offer or reject it. It returns sql.ErrNoRows if the offer does not exist.
+func DeclineLoanOffer(db *sql.DB, id uuid.UUID, reason string) (*LoanOffer, error) {
+	var offer *LoanOffer
+	err := withTx(db, func(tx *sql.Tx) error {
+		var err error
+		if offer, err = lockOpenOffer(tx, id); err != nil {
+			return err
+		}
+		return offer.respond(tx, OfferStatusDeclined, reason)
+	})
+	if err == nil {
+		return offer, nil
+	}
+	if err == ErrOfferExpired {
+		_, _ = ExpireLoanOffers(db)
+	}
+	return nil, err
+}
+
+func (o *LoanOffer) respond(tx *sql.Tx, status, reason string) error {
+	now := time.Now()
+	query := `UPDATE loan_offers SET status = $1, responded_at = $2, response_reason = NULLIF($3, ''), updated_at = $2 WHERE id = $4`
+	if _, err := tx.Exec(query, status, now, reason, o.ID); err != nil {
+		return err
+	}
+	o.Status = status
+	o.RespondedAt = &now
+	o.ResponseReason = reason
+	o.UpdatedAt = now
+	return nil
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OTPAttempt struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	IPAddress string    `json:"ip_address"`
+	Success   bool      `json:"success"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AttemptCount is the number of failed attempts in a window and when the oldest of them happened
+type AttemptCount struct {
+	Count  int
+	Oldest time.Time
+}
+
+// OTPAttemptCheck is the outcome of ReserveOTPAttempt
+type OTPAttemptCheck struct {
+	Attempt       *OTPAttempt   // nil when a limit was reached
+	EmailFailures *AttemptCount // failures before this attempt
+	IPFailures    *AttemptCount // nil when the email limit was reached
+}
+
+// OTPSendStats summarises the OTPs issued to an email address since a point in time
+type OTPSendStats struct {
+	Count  int
+	Oldest time.Time
+	Latest time.Time
+}
+
+func (a *OTPAttempt) Create(db DBTX) error {
+	a.ID = uuid.New()
+	a.CreatedAt = time.Now()
+
+	query := `INSERT INTO otp_attempts (id, email, ip_address, success, created_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := db.Exec(query, a.ID, a.Email, a.IPAddress, a.Success, a.CreatedAt)
+	return err
+}
+
+// CountFailedOTPAttemptsByEmail counts failures for an email since the given time.
+// A successful verification resets the counter for that email.
+func CountFailedOTPAttemptsByEmail(db DBTX, email string, since time.Time) (*AttemptCount, error) {
+	query := `SELECT COUNT(*), MIN(created_at) FROM otp_attempts
+	          WHERE email = $1 AND success = false AND created_at > $2
+	          AND created_at > COALESCE(
+	              (SELECT MAX(created_at) FROM otp_attempts WHERE email = $1 AND success = true),
+	              '-infinity'::timestamptz)`
+	return scanAttemptCount(db.QueryRow(query, email, since))
+}
+
+// CountFailedOTPAttemptsByIP counts failures from an IP address since the given time
+func CountFailedOTPAttemptsByIP(db DBTX, ip string, since time.Time) (*AttemptCount, error) {
+	query := `SELECT COUNT(*), MIN(created_at) FROM otp_attempts
+	          WHERE ip_address = $1 AND success = false AND created_at > $2`
+	return scanAttemptCount(db.QueryRow(query, ip, since))
+}
+
+// lockOTP takes a transaction-scoped advisory lock on key, serialising the OTP requests that
+// share it until the transaction ends
+func lockOTP(tx *sql.Tx, key string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, key)
+	return err
+}
+
+// ReserveOTPAttempt records a verification attempt before the code is checked, as a failure
+// until MarkOTPAttemptSucceeded. The failures of the email and the IP address since the given
+// time are counted and the attempt inserted under per-email and per-IP locks, so parallel
+// guesses cannot all pass the limits. No attempt is recorded once a limit is reached.
+func ReserveOTPAttempt(db *sql.DB, email, ip string, since time.Time, maxPerEmail, maxPerIP int) (*OTPAttemptCheck, error) {
+	check := &OTPAttemptCheck{}
+	err := withTx(db, func(tx *sql.Tx) error {
+		// Always email before IP, so two requests cannot wait on each other
+		if err := lockOTP(tx, "otp_attempt_email:"+email); err != nil {
+			return err
+		}
+		var err error
+		check.EmailFailures, err = CountFailedOTPAttemptsByEmail(tx, email, since)
+		if err != nil || check.EmailFailures.Count >= maxPerEmail {
+			return err
+		}
+
+		if err := lockOTP(tx, "otp_attempt_ip:"+ip); err != nil {
+			return err
+		}
+		check.IPFailures, err = CountFailedOTPAttemptsByIP(tx, ip, since)
+		if err != nil || check.IPFailures.Count >= maxPerIP {
+			return err
+		}
+
+		attempt := &OTPAttempt{Email: email, IPAddress: ip}
+		if err := attempt.Create(tx); err != nil {
+			return err
+		}
+		check.Attempt = attempt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// MarkOTPAttemptSucceeded records that a reserved attempt verified its code, which resets the
+// failure count of its email
+func MarkOTPAttemptSucceeded(db *sql.DB, id uuid.UUID) error {
+	_, err := db.Exec(`UPDATE otp_attempts SET success = true WHERE id = $1`, id)
+	return err
+}
+
+func scanAttemptCount(row *sql.Row) (*AttemptCount, error) {
+	count := &AttemptCount{}
+	var oldest sql.NullTime
+	if err := row.Scan(&count.Count, &oldest); err != nil {
+		return nil, err
+	}
+	if oldest.Valid {
+		count.Oldest = oldest.Time
+	}
+	return count, nil
+}
+
+// InvalidateOTPs expires every outstanding OTP for an email
+func InvalidateOTPs(db *sql.DB, email string) error {
+	query := `UPDATE otp_verifications SET expires_at = $1 WHERE email = $2 AND verified = false AND expires_at > $1`
+	_, err := db.Exec(query, time.Now(), email)
+	return err
+}
+
+// GetOTPSendStats returns how many OTPs were issued to an email since the given time
+func GetOTPSendStats(db DBTX, email string, since time.Time) (*OTPSendStats, error) {
+	stats := &OTPSendStats{}
+	var oldest, latest sql.NullTime
+	query := `SELECT COUNT(*), MIN(created_at), MAX(created_at) FROM otp_verifications
+	          WHERE email = $1 AND created_at > $2`
+	if err := db.QueryRow(query, email, since).Scan(&stats.Count, &oldest, &latest); err != nil {
+		return nil, err
+	}
+	if oldest.Valid {
+		stats.Oldest = oldest.Time
+	}
+	if latest.Valid {
+		stats.Latest = latest.Time
+	}
+	return stats, nil
+}
+
+// CreateIfAllowed stores the OTP unless allow rejects the email's send stats since the given
+// time. The stats are read and the OTP inserted under a per-email lock, so parallel requests
+// cannot all slip past the resend cooldown or the daily cap. It reports whether the OTP was
+// stored.
+func (otp *OTPVerification) CreateIfAllowed(db *sql.DB, since time.Time, allow func(stats *OTPSendStats) bool) (bool, error) {
+	created := false
+	err := withTx(db, func(tx *sql.Tx) error {
+		if err := lockOTP(tx, "otp_send:"+otp.Email); err != nil {
+			return err
+		}
+		stats, err := GetOTPSendStats(tx, otp.Email, since)
+		if err != nil {
+			return err
+		}
+		if !allow(stats) {
+			return nil
+		}
+		if err := otp.Create(tx); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
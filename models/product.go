@@ -0,0 +1,179 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/money"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// FinancingProduct is a product of the financing catalog with its limits, pricing and eligibility rules
+type FinancingProduct struct {
+	ID                   uuid.UUID    `json:"id"`
+	Code                 string       `json:"code"`
+	Name                 string       `json:"name"`
+	Description          string       `json:"description"`
+	Currency             string       `json:"currency"`
+	MinAmount            money.Money  `json:"min_amount"`
+	MaxAmount            money.Money  `json:"max_amount"`
+	Tenors               []int        `json:"tenors"` // allowed repayment periods in months
+	Pricing              loan.Pricing `json:"pricing"`
+	MinBusinessAgeMonths int          `json:"min_business_age_months"`
+	RequiredDocuments    []string     `json:"required_documents"` // document checklist; see AccountRequiredDocuments
+	Active               bool         `json:"active"`
+	CreatedAt            time.Time    `json:"created_at"`
+	UpdatedAt            time.Time    `json:"updated_at"`
+}
+
+// EligibilityProfile is what product eligibility rules know about an applicant
+type EligibilityProfile struct {
+	BusinessEstablishedOn *time.Time
+	Documents             map[string]bool // document requirements met
+}
+
+const financingProductColumns = `id, code, name, description, currency, min_amount_minor, max_amount_minor, tenors,
+	          annual_rate_bps, rate_method, processing_fee_bps, min_business_age_months, required_documents, active, created_at, updated_at`
+
+func scanFinancingProduct(row interface{ Scan(...interface{}) error }) (*FinancingProduct, error) {
+	p := &FinancingProduct{}
+	var minAmount, maxAmount int64
+	var tenors []int64
+	var method string
+	err := row.Scan(&p.ID, &p.Code, &p.Name, &p.Description, &p.Currency, &minAmount, &maxAmount, pq.Array(&tenors),
+		&p.Pricing.AnnualRateBps, &method, &p.Pricing.ProcessingFeeBps, &p.MinBusinessAgeMonths,
+		pq.Array(&p.RequiredDocuments), &p.Active, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.MinAmount = money.New(minAmount, p.Currency)
+	p.MaxAmount = money.New(maxAmount, p.Currency)
+	p.Pricing.Method = loan.Method(method)
+	p.Tenors = make([]int, len(tenors))
+	for i, tenor := range tenors {
+		p.Tenors[i] = int(tenor)
+	}
+	if p.RequiredDocuments == nil {
+		p.RequiredDocuments = []string{}
+	}
+	return p, nil
+}
+
+// GetActiveFinancingProducts returns the products currently offered, by name
+func GetActiveFinancingProducts(db *sql.DB) ([]FinancingProduct, error) {
+	query := `SELECT ` + financingProductColumns + ` FROM financing_products WHERE active ORDER BY name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []FinancingProduct{}
+	for rows.Next() {
+		p, err := scanFinancingProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, *p)
+	}
+
+	return products, rows.Err()
+}
+
+// GetFinancingProductByID returns a product whether or not it is still active
+func GetFinancingProductByID(db *sql.DB, id uuid.UUID) (*FinancingProduct, error) {
+	query := `SELECT ` + financingProductColumns + ` FROM financing_products WHERE id = $1`
+	p, err := scanFinancingProduct(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// GetEligibilityProfile collects the applicant data used by product eligibility rules
+func GetEligibilityProfile(db *sql.DB, userID uuid.UUID) (*EligibilityProfile, error) {
+	profile := &EligibilityProfile{Documents: map[string]bool{}}
+
+	var establishedOn sql.NullTime
+	err := db.QueryRow(`SELECT established_on FROM business_details WHERE user_id = $1`, userID).Scan(&establishedOn)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if establishedOn.Valid {
+		profile.BusinessEstablishedOn = &establishedOn.Time
+	}
+
+	requirements := append([]string{DocumentTypeTradeLicense, DocumentRequirementIdentity}, VaultDocumentTypes...)
+	checklist, err := GetDocumentChecklist(db, userID, requirements, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range checklist.Items {
+		profile.Documents[item.Requirement] = item.Met()
+	}
+
+	return profile, nil
+}
+
+// CheckTerms checks an amount and repayment period against the product's limits.
+// It returns the reasons the terms are not acceptable, or nil.
+func (p *FinancingProduct) CheckTerms(amount money.Money, months int) []string {
+	var reasons []string
+	if amount.Currency != p.Currency {
+		reasons = append(reasons, fmt.Sprintf("%s is only offered in %s", p.Name, p.Currency))
+	} else if amount.Minor < p.MinAmount.Minor || amount.Minor > p.MaxAmount.Minor {
+		reasons = append(reasons, fmt.Sprintf("amount must be between %s and %s", p.MinAmount.Display(), p.MaxAmount.Display()))
+	}
+
+	allowed := false
+	for _, tenor := range p.Tenors {
+		if tenor == months {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		tenors := make([]string, len(p.Tenors))
+		for i, tenor := range p.Tenors {
+			tenors[i] = strconv.Itoa(tenor)
+		}
+		reasons = append(reasons, fmt.Sprintf("repayment period must be one of %s months", strings.Join(tenors, ", ")))
+	}
+
+	return reasons
+}
+
+// CheckEligibility checks the applicant rules of the product (business age and documents).
+// It returns the reasons the applicant is not eligible, or nil.
+func (p *FinancingProduct) CheckEligibility(profile *EligibilityProfile, now time.Time) []string {
+	var reasons []string
+	if p.MinBusinessAgeMonths > 0 {
+		if profile.BusinessEstablishedOn == nil {
+			reasons = append(reasons, "business establishment date is required")
+		} else if age := MonthsBetween(*profile.BusinessEstablishedOn, now); age < p.MinBusinessAgeMonths {
+			reasons = append(reasons, fmt.Sprintf("business must be at least %d months old", p.MinBusinessAgeMonths))
+		}
+	}
+	for _, documentType := range p.RequiredDocuments {
+		if !profile.Documents[documentType] {
+			reasons = append(reasons, fmt.Sprintf("%s document is required", strings.ReplaceAll(documentType, "_", " ")))
+		}
+	}
+	return reasons
+}
+
+// MonthsBetween counts the whole calendar months from one date to another
+func MonthsBetween(from, to time.Time) int {
+	months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	if to.Day() < from.Day() {
+		months--
+	}
+	return months
+}
@@ -0,0 +1,305 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Registration steps, in the order the onboarding UI walks through them
+const (
+	RegistrationStepPersonal     = "personal"
+	RegistrationStepBusiness     = "business"
+	RegistrationStepTradeLicense = "trade_license"
+)
+
+// RegistrationSteps lists the steps in order
+var RegistrationSteps = []string{RegistrationStepPersonal, RegistrationStepBusiness, RegistrationStepTradeLicense}
+
+// registrationStepFields lists the fields of each step. A step is saved to its table once all
+// of its required fields and one of its OneOf fields are known; until then its fields are kept
+// as a draft. OneOf fields replace each other and are reported missing as OneOfName. FileFields
+// describe an uploaded file and are replaced along with the OneOf fields.
+var registrationStepFields = map[string]struct {
+	Required   []string
+	Optional   []string
+	OneOf      []string
+	OneOfName  string
+	FileFields []string
+}{
+	RegistrationStepPersonal: {Required: []string{"full_name", "email", "phone_number"}},
+	RegistrationStepBusiness: {Required: []string{"business_name", "trade_license_number"}, Optional: []string{"established_on"}},
+	RegistrationStepTradeLicense: {
+		// Licenses saved before their dates were collected keep them empty until saved again
+		Required:   []string{"filename", "issued_on", "expires_on", "issuing_authority"},
+		OneOf:      []string{"object_key", "file_url"}, // uploaded file, or a URL
+		OneOfName:  "file",
+		FileFields: []string{"file_size", "sha256", "scan_status"},
+	},
+}
+
+// RegistrationStepResult is the state of a step after saving it
+type RegistrationStepResult struct {
+	Step     string            `json:"step"`
+	Complete bool              `json:"complete"`
+	Fields   map[string]string `json:"fields"`            // the stored values, or the draft
+	Missing  []string          `json:"missing,omitempty"` // required fields still empty
+	// ReplacedObjectKey is a file of the draft that the save replaced and that nothing else
+	// refers to; the caller deletes it from storage
+	ReplacedObjectKey string `json:"-"`
+}
+
+// GetRegistrationDraftSteps returns the steps that have a saved draft
+func GetRegistrationDraftSteps(db *sql.DB, userID uuid.UUID) ([]string, error) {
+	rows, err := db.Query(`SELECT step FROM registration_drafts WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []string{}
+	for rows.Next() {
+		var step string
+		if err := rows.Scan(&step); err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+// GetRegistrationDraft returns the draft fields of a step, or nil if there is no draft
+func GetRegistrationDraft(db *sql.DB, userID uuid.UUID, step string) (map[string]string, error) {
+	return getRegistrationDraft(db, userID, step, false)
+}
+
+func getRegistrationDraft(db DBTX, userID uuid.UUID, step string, forUpdate bool) (map[string]string, error) {
+	query := `SELECT fields FROM registration_drafts WHERE user_id = $1 AND step = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	var raw []byte
+	err := db.QueryRow(query, userID, step).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// storedRegistrationFields returns the saved values of a step, or nil if it was never completed
+func storedRegistrationFields(db DBTX, userID uuid.UUID, step string) (map[string]string, error) {
+	var fields map[string]string
+	var err error
+	switch step {
+	case RegistrationStepPersonal:
+		var fullName, email, phone string
+		err = db.QueryRow(`SELECT full_name, email, phone_number FROM personal_details WHERE user_id = $1 FOR UPDATE`, userID).
+			Scan(&fullName, &email, &phone)
+		fields = map[string]string{"full_name": fullName, "email": email, "phone_number": phone}
+	case RegistrationStepBusiness:
+		var name, licenseNumber, establishedOn string
+		err = db.QueryRow(`SELECT business_name, trade_license_number, COALESCE(to_char(established_on, 'YYYY-MM-DD'), '')
+		                   FROM business_details WHERE user_id = $1 FOR UPDATE`, userID).Scan(&name, &licenseNumber, &establishedOn)
+		fields = map[string]string{"business_name": name, "trade_license_number": licenseNumber, "established_on": establishedOn}
+	case RegistrationStepTradeLicense:
+		// A file that failed the malware scan or was rejected in review does not count
+		var filename, objectKey, fileURL, issuedOn, expiresOn, authority string
+		err = db.QueryRow(`SELECT tl.filename, COALESCE(tl.object_key, ''), COALESCE(tl.file_url, ''),
+		                       COALESCE(to_char(tl.issued_on, 'YYYY-MM-DD'), ''), COALESCE(to_char(tl.expires_on, 'YYYY-MM-DD'), ''),
+		                       COALESCE(tl.issuing_authority, '')
+		                   FROM trade_licenses tl JOIN documents d ON d.id = tl.document_id
+		                   WHERE tl.user_id = $1 AND d.scan_status IS DISTINCT FROM 'infected' AND d.review_status <> 'rejected'
+		                   FOR UPDATE OF tl`, userID).Scan(&filename, &objectKey, &fileURL, &issuedOn, &expiresOn, &authority)
+		fields = map[string]string{"filename": filename, "object_key": objectKey, "file_url": fileURL,
+			"issued_on": issuedOn, "expires_on": expiresOn, "issuing_authority": authority}
+	default:
+		return nil, fmt.Errorf("unknown registration step %q", step)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return fields, err
+}
+
+// SaveRegistrationStep merges the submitted fields of one step over its draft and its stored
+// values. Empty submitted fields keep the earlier value. When every required field is known
+// the step is saved to its table and the draft is dropped; otherwise the merged fields are
+// kept as the step's draft so the user can resume later. Values are expected to be validated
+// by the caller.
+func SaveRegistrationStep(db *sql.DB, userID uuid.UUID, step string, submitted map[string]string) (*RegistrationStepResult, error) {
+	spec, ok := registrationStepFields[step]
+	if !ok {
+		return nil, fmt.Errorf("unknown registration step %q", step)
+	}
+
+	result := &RegistrationStepResult{Step: step, Fields: map[string]string{}}
+	err := withTx(db, func(tx *sql.Tx) error {
+		stored, err := storedRegistrationFields(tx, userID, step)
+		if err != nil {
+			return err
+		}
+		draft, err := getRegistrationDraft(tx, userID, step, true)
+		if err != nil {
+			return err
+		}
+
+		names := append(append(append(append([]string{}, spec.Required...), spec.Optional...), spec.OneOf...), spec.FileFields...)
+		for _, layer := range []map[string]string{stored, draft, submitted} {
+			for _, name := range spec.OneOf {
+				if layer[name] != "" {
+					for _, other := range append(append([]string{}, spec.OneOf...), spec.FileFields...) {
+						delete(result.Fields, other)
+					}
+					break
+				}
+			}
+			for _, name := range names {
+				if value := layer[name]; value != "" {
+					result.Fields[name] = value
+				}
+			}
+		}
+		for _, name := range spec.Required {
+			if result.Fields[name] == "" {
+				result.Missing = append(result.Missing, name)
+			}
+		}
+		if len(spec.OneOf) > 0 {
+			found := false
+			for _, name := range spec.OneOf {
+				found = found || result.Fields[name] != ""
+			}
+			if !found {
+				result.Missing = append(result.Missing, spec.OneOfName)
+			}
+		}
+
+		if key := draft["object_key"]; key != "" && key != result.Fields["object_key"] {
+			orphaned, err := orphanedObjectKey(tx, key)
+			if err != nil {
+				return err
+			}
+			if orphaned {
+				result.ReplacedObjectKey = key
+			}
+		}
+
+		if len(result.Missing) > 0 {
+			raw, err := json.Marshal(result.Fields)
+			if err != nil {
+				return err
+			}
+			query := `INSERT INTO registration_drafts (user_id, step, fields, updated_at) VALUES ($1, $2, $3, $4)
+			          ON CONFLICT (user_id, step) DO UPDATE SET fields = EXCLUDED.fields, updated_at = EXCLUDED.updated_at`
+			_, err = tx.Exec(query, userID, step, raw, time.Now())
+			return err
+		}
+
+		result.Complete = true
+		if err := saveRegistrationFields(tx, userID, step, result.Fields); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM registration_drafts WHERE user_id = $1 AND step = $2`, userID, step)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// saveRegistrationFields writes the complete fields of a step to its table
+func saveRegistrationFields(tx *sql.Tx, userID uuid.UUID, step string, fields map[string]string) error {
+	switch step {
+	case RegistrationStepPersonal:
+		pd := &PersonalDetails{UserID: userID, FullName: fields["full_name"], Email: fields["email"], PhoneNumber: fields["phone_number"]}
+		return pd.CreateOrUpdate(tx)
+	case RegistrationStepBusiness:
+		bd := &BusinessDetails{UserID: userID, BusinessName: fields["business_name"], TradeLicenseNumber: fields["trade_license_number"]}
+		if value := fields["established_on"]; value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return fmt.Errorf("established_on: %w", err)
+			}
+			bd.EstablishedOn = &date
+		}
+		return bd.CreateOrUpdate(tx)
+	case RegistrationStepTradeLicense:
+		tl := &TradeLicense{UserID: userID, Filename: fields["filename"], ObjectKey: fields["object_key"], FileURL: fields["file_url"],
+			SHA256: fields["sha256"], ScanStatus: fields["scan_status"], IssuingAuthority: fields["issuing_authority"]}
+		if value := fields["file_size"]; value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("file_size: %w", err)
+			}
+			tl.FileSize = &size
+		}
+		for name, date := range map[string]**time.Time{"issued_on": &tl.IssuedOn, "expires_on": &tl.ExpiresOn} {
+			if value := fields[name]; value != "" {
+				parsed, err := time.Parse("2006-01-02", value)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				*date = &parsed
+			}
+		}
+		return tl.CreateOrUpdate(tx)
+	}
+	return fmt.Errorf("unknown registration step %q", step)
+}
+
+// orphanedObjectKey reports whether no document refers to a stored file. A draft may hold the
+// file of the stored step, which has to be kept.
+func orphanedObjectKey(db DBTX, key string) (bool, error) {
+	var referenced bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM documents WHERE object_key = $1)`, key).Scan(&referenced)
+	return !referenced, err
+}
+
+// deleteRegistrationDrafts deletes the drafts matching a condition and returns how many were
+// deleted and the files they held that no document refers to
+func deleteRegistrationDrafts(db DBTX, condition string, args ...interface{}) (int, []string, error) {
+	query := `WITH deleted AS (DELETE FROM registration_drafts WHERE ` + condition + ` RETURNING fields->>'object_key' AS object_key)
+	          SELECT CASE WHEN NOT EXISTS (SELECT 1 FROM documents d WHERE d.object_key = deleted.object_key)
+	              THEN deleted.object_key END
+	          FROM deleted`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	count := 0
+	keys := []string{}
+	for rows.Next() {
+		var key sql.NullString
+		if err := rows.Scan(&key); err != nil {
+			return 0, nil, err
+		}
+		count++
+		if key.Valid && key.String != "" {
+			keys = append(keys, key.String)
+		}
+	}
+	return count, keys, rows.Err()
+}
+
+// ExpireRegistrationDrafts deletes up to limit drafts last saved before a time and returns how
+// many were deleted and the files they held that no document refers to, for the caller to
+// delete from storage
+func ExpireRegistrationDrafts(db *sql.DB, before time.Time, limit int) (int, []string, error) {
+	return deleteRegistrationDrafts(db, `(user_id, step) IN (SELECT user_id, step FROM registration_drafts
+	              WHERE updated_at < $1 ORDER BY updated_at LIMIT $2)`, before, limit)
+}
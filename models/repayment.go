@@ -0,0 +1,175 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"sme_fin_backend/loan"
+	"sme_fin_backend/money"
+
+	"github.com/google/uuid"
+)
+
+// Installment statuses
+const (
+	InstallmentStatusScheduled     = "scheduled"
+	InstallmentStatusPartiallyPaid = "partially_paid"
+	InstallmentStatusPaid          = "paid"
+	InstallmentStatusOverdue       = "overdue"
+	InstallmentStatusWrittenOff    = "written_off"
+)
+
+// RepaymentSchedule is the schedule fixed for an approved financing request
+type RepaymentSchedule struct {
+	FinancingRequestID uuid.UUID              `json:"financing_request_id"`
+	Currency           string                 `json:"currency"`
+	Principal          money.Money            `json:"principal"`
+	Months             int                    `json:"months"`
+	AnnualRateBps      int                    `json:"annual_rate_bps"`
+	Method             loan.Method            `json:"method"`
+	ProcessingFeeBps   int                    `json:"processing_fee_bps"`
+	TotalInterest      money.Money            `json:"total_interest"`
+	TotalFees          money.Money            `json:"total_fees"`
+	TotalPayable       money.Money            `json:"total_payable"`
+	StartDate          string                 `json:"start_date"` // YYYY-MM-DD
+	CreatedAt          time.Time              `json:"created_at"`
+	Installments       []RepaymentInstallment `json:"installments"`
+}
+
+// RepaymentInstallment is one persisted installment of a repayment schedule
+type RepaymentInstallment struct {
+	ID                 uuid.UUID   `json:"id"`
+	FinancingRequestID uuid.UUID   `json:"financing_request_id"`
+	Number             int         `json:"number"`
+	DueDate            string      `json:"due_date"` // YYYY-MM-DD
+	Principal          money.Money `json:"principal"`
+	Interest           money.Money `json:"interest"`
+	Fees               money.Money `json:"fees"`
+	Payment            money.Money `json:"payment"`
+	Balance            money.Money `json:"balance"`
+	Paid               money.Money `json:"paid"` // repayments applied to this installment
+	PaidAt             *time.Time  `json:"paid_at,omitempty"`
+	OverdueAt          *time.Time  `json:"overdue_at,omitempty"`
+	Status             string      `json:"status"`
+}
+
+// SaveRepaymentSchedule stores the schedule of a financing request, replacing any previous one
+func SaveRepaymentSchedule(db DBTX, requestID uuid.UUID, pricing loan.Pricing, startDate time.Time, schedule *loan.Schedule) error {
+	if _, err := db.Exec(`DELETE FROM repayment_schedules WHERE financing_request_id = $1`, requestID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO repayment_schedules (financing_request_id, currency, principal_minor, months, annual_rate_bps, method,
+	          processing_fee_bps, total_interest_minor, total_fees_minor, total_payable_minor, start_date, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err := db.Exec(query, requestID, schedule.Currency, schedule.Principal.Minor, schedule.Months, pricing.AnnualRateBps,
+		string(pricing.Method), pricing.ProcessingFeeBps, schedule.TotalInterest.Minor, schedule.TotalFees.Minor,
+		schedule.TotalPayable.Minor, startDate.Format("2006-01-02"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	installmentQuery := `INSERT INTO repayment_installments (id, financing_request_id, installment_number, due_date, principal_minor,
+	                     interest_minor, fee_minor, payment_minor, balance_minor, status)
+	                     VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	for _, inst := range schedule.Installments {
+		_, err := db.Exec(installmentQuery, uuid.New(), requestID, inst.Number, inst.DueDate, inst.Principal.Minor,
+			inst.Interest.Minor, inst.Fees.Minor, inst.Payment.Minor, inst.Balance.Minor, InstallmentStatusScheduled)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetRepaymentSchedule returns the schedule of a financing request, or nil if none was fixed yet
+func GetRepaymentSchedule(db *sql.DB, requestID uuid.UUID) (*RepaymentSchedule, error) {
+	s := &RepaymentSchedule{}
+	var principal, totalInterest, totalFees, totalPayable int64
+	var method string
+	query := `SELECT financing_request_id, currency, principal_minor, months, annual_rate_bps, method, processing_fee_bps,
+	          total_interest_minor, total_fees_minor, total_payable_minor, to_char(start_date, 'YYYY-MM-DD'), created_at
+	          FROM repayment_schedules WHERE financing_request_id = $1`
+	err := db.QueryRow(query, requestID).Scan(&s.FinancingRequestID, &s.Currency, &principal, &s.Months, &s.AnnualRateBps,
+		&method, &s.ProcessingFeeBps, &totalInterest, &totalFees, &totalPayable, &s.StartDate, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Method = loan.Method(method)
+	s.Principal = money.New(principal, s.Currency)
+	s.TotalInterest = money.New(totalInterest, s.Currency)
+	s.TotalFees = money.New(totalFees, s.Currency)
+	s.TotalPayable = money.New(totalPayable, s.Currency)
+
+	installmentQuery := `SELECT id, financing_request_id, installment_number, to_char(due_date, 'YYYY-MM-DD'), principal_minor,
+	                     interest_minor, fee_minor, payment_minor, balance_minor, paid_minor, paid_at, overdue_at, status
+	                     FROM repayment_installments WHERE financing_request_id = $1 ORDER BY installment_number`
+	rows, err := db.Query(installmentQuery, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s.Installments = []RepaymentInstallment{}
+	for rows.Next() {
+		var inst RepaymentInstallment
+		var p, i, f, pay, bal, paid int64
+		var paidAt, overdueAt sql.NullTime
+		if err := rows.Scan(&inst.ID, &inst.FinancingRequestID, &inst.Number, &inst.DueDate, &p, &i, &f, &pay, &bal, &paid, &paidAt,
+			&overdueAt, &inst.Status); err != nil {
+			return nil, err
+		}
+		if paidAt.Valid {
+			inst.PaidAt = &paidAt.Time
+		}
+		if overdueAt.Valid {
+			inst.OverdueAt = &overdueAt.Time
+		}
+		inst.Principal = money.New(p, s.Currency)
+		inst.Interest = money.New(i, s.Currency)
+		inst.Fees = money.New(f, s.Currency)
+		inst.Payment = money.New(pay, s.Currency)
+		inst.Balance = money.New(bal, s.Currency)
+		inst.Paid = money.New(paid, s.Currency)
+		s.Installments = append(s.Installments, inst)
+	}
+
+	return s, rows.Err()
+}
+
+// ApproveFinancingRequest approves a request at its requested amount and period and fixes its
+// repayment schedule in the same transaction. Installments fall due monthly from the approval date.
+func ApproveFinancingRequest(db *sql.DB, id uuid.UUID, actorID *uuid.UUID, reason string, pricing loan.Pricing) (*FinancingRequest, error) {
+	var fr *FinancingRequest
+	err := withTx(db, func(tx *sql.Tx) error {
+		var err error
+		fr, err = transitionFinancingRequest(tx, id, "", FinancingStatusApproved, actorID, reason)
+		if err != nil || fr == nil {
+			return err
+		}
+
+		return fixRepaymentSchedule(tx, fr.ID, loan.Terms{
+			Pricing:   pricing,
+			Principal: fr.Amount,
+			Months:    fr.RepaymentPeriod,
+			StartDate: time.Now().UTC(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fr, nil
+}
+
+// fixRepaymentSchedule builds the schedule for the given terms and stores it for the request
+func fixRepaymentSchedule(tx *sql.Tx, requestID uuid.UUID, terms loan.Terms) error {
+	schedule, err := loan.BuildSchedule(terms)
+	if err != nil {
+		return err
+	}
+	return SaveRepaymentSchedule(tx, requestID, terms.Pricing, terms.StartDate, schedule)
+}
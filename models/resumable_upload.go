@@ -0,0 +1,249 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Resumable upload statuses
+const (
+	UploadStatusUploading  = "uploading"
+	UploadStatusAssembling = "assembling" // every byte arrived; the chunks are being assembled
+	UploadStatusCompleted  = "completed"
+	UploadStatusFailed     = "failed" // the assembled file was rejected; see Error
+	UploadStatusExpired    = "expired"
+)
+
+// ErrUploadOffsetMismatch is returned when a chunk does not start at the current offset of
+// its upload, because the client is out of step or another request got there first
+var ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+
+// ResumableUpload is a file sent in chunks over several requests. Offset is the number of
+// bytes received so far; the upload is assembled once it reaches Length.
+type ResumableUpload struct {
+	ID                uuid.UUID  `json:"id"`
+	UserID            uuid.UUID  `json:"user_id"`
+	DocumentType      string     `json:"document_type"`                 // DocumentTypeTradeLicense or a vault document type
+	DocumentExpiresOn *time.Time `json:"document_expires_on,omitempty"` // expiry date of the document it becomes
+	// Issue date and issuing authority of the trade license it becomes
+	DocumentIssuedOn         *time.Time `json:"document_issued_on,omitempty"`
+	DocumentIssuingAuthority string     `json:"document_issuing_authority,omitempty"`
+	Filename                 string     `json:"filename"`
+	Length                   int64      `json:"length"`
+	Offset                   int64      `json:"offset"`
+	Status                   string     `json:"status"`
+	Error                    string     `json:"error,omitempty"`
+	DocumentID               *uuid.UUID `json:"document_id,omitempty"` // set once completed
+	ExpiresAt                time.Time  `json:"expires_at"`
+	CreatedAt                time.Time  `json:"created_at"`
+	UpdatedAt                time.Time  `json:"updated_at"`
+}
+
+// UploadChunk is one stored piece of a resumable upload
+type UploadChunk struct {
+	Offset    int64
+	Size      int64
+	ObjectKey string
+}
+
+const resumableUploadColumns = `id, user_id, document_type, document_expires_on, document_issued_on,
+	          COALESCE(document_issuing_authority, ''), filename, upload_length, upload_offset, status, COALESCE(error, ''),
+	          document_id, expires_at, created_at, updated_at`
+
+func scanResumableUpload(row interface{ Scan(...interface{}) error }) (*ResumableUpload, error) {
+	u := &ResumableUpload{}
+	var documentID uuid.NullUUID
+	var documentExpiresOn, documentIssuedOn sql.NullTime
+	err := row.Scan(&u.ID, &u.UserID, &u.DocumentType, &documentExpiresOn, &documentIssuedOn, &u.DocumentIssuingAuthority,
+		&u.Filename, &u.Length, &u.Offset, &u.Status, &u.Error, &documentID, &u.ExpiresAt, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if documentID.Valid {
+		u.DocumentID = &documentID.UUID
+	}
+	if documentExpiresOn.Valid {
+		u.DocumentExpiresOn = &documentExpiresOn.Time
+	}
+	if documentIssuedOn.Valid {
+		u.DocumentIssuedOn = &documentIssuedOn.Time
+	}
+	return u, nil
+}
+
+// CreateResumableUpload stores a new, empty upload
+func CreateResumableUpload(db *sql.DB, u *ResumableUpload) error {
+	now := time.Now()
+	u.ID = uuid.New()
+	u.Offset = 0
+	u.Status = UploadStatusUploading
+	u.CreatedAt, u.UpdatedAt = now, now
+	query := `INSERT INTO resumable_uploads (id, user_id, document_type, document_expires_on, document_issued_on,
+	              document_issuing_authority, filename, upload_length, status, expires_at, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11, $11)`
+	_, err := db.Exec(query, u.ID, u.UserID, u.DocumentType, u.DocumentExpiresOn, u.DocumentIssuedOn, u.DocumentIssuingAuthority,
+		u.Filename, u.Length, u.Status, u.ExpiresAt, now)
+	return err
+}
+
+// GetResumableUpload returns an upload, or nil if it does not exist
+func GetResumableUpload(db *sql.DB, id uuid.UUID) (*ResumableUpload, error) {
+	u, err := scanResumableUpload(db.QueryRow(`SELECT `+resumableUploadColumns+` FROM resumable_uploads WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return u, err
+}
+
+// AppendUploadChunk records a chunk stored at the current offset of an upload in progress,
+// advances the offset past it and pushes the expiry out to expiresAt. It returns
+// ErrUploadOffsetMismatch if the offset has moved or the upload is no longer in progress.
+func AppendUploadChunk(db *sql.DB, id uuid.UUID, chunk UploadChunk, expiresAt time.Time) (*ResumableUpload, error) {
+	var u *ResumableUpload
+	err := withTx(db, func(tx *sql.Tx) error {
+		query := `UPDATE resumable_uploads SET upload_offset = upload_offset + $1, expires_at = $2, updated_at = $3
+		          WHERE id = $4 AND upload_offset = $5 AND upload_offset + $1 <= upload_length
+		              AND status = 'uploading' AND expires_at > $3
+		          RETURNING ` + resumableUploadColumns
+		var err error
+		u, err = scanResumableUpload(tx.QueryRow(query, chunk.Size, expiresAt, time.Now(), id, chunk.Offset))
+		if err == sql.ErrNoRows {
+			return ErrUploadOffsetMismatch
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO resumable_upload_chunks (upload_id, chunk_offset, size, object_key) VALUES ($1, $2, $3, $4)`,
+			id, chunk.Offset, chunk.Size, chunk.ObjectKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// GetUploadChunks returns the chunks of an upload in offset order
+func GetUploadChunks(db *sql.DB, id uuid.UUID) ([]UploadChunk, error) {
+	rows, err := db.Query(`SELECT chunk_offset, size, object_key FROM resumable_upload_chunks
+	                       WHERE upload_id = $1 ORDER BY chunk_offset`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := []UploadChunk{}
+	for rows.Next() {
+		var c UploadChunk
+		if err := rows.Scan(&c.Offset, &c.Size, &c.ObjectKey); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// StartUploadAssembly claims a fully received upload for assembly, which must be over by
+// deadline. The upload does not expire before then, so the daily job only takes assemblies
+// that are stuck. It reports false if the upload is incomplete or another request already
+// claimed it.
+func StartUploadAssembly(db *sql.DB, id uuid.UUID, deadline time.Time) (bool, error) {
+	query := `UPDATE resumable_uploads SET status = 'assembling', expires_at = GREATEST(expires_at, $1), updated_at = $2
+	          WHERE id = $3 AND status = 'uploading' AND upload_offset = upload_length`
+	result, err := db.Exec(query, deadline, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// EndUploadAssembly records the outcome of an assembly: completed with the document it
+// produced, failed with the reason, or back to uploading so that it can be retried. The
+// chunk records of completed and failed uploads are dropped; their objects are the caller's
+// to delete.
+func EndUploadAssembly(db *sql.DB, id uuid.UUID, status string, documentID *uuid.UUID, message string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		query := `UPDATE resumable_uploads SET status = $1, document_id = $2, error = NULLIF($3, ''), updated_at = $4
+		          WHERE id = $5 AND status = 'assembling'`
+		if _, err := tx.Exec(query, status, documentID, message, time.Now(), id); err != nil {
+			return err
+		}
+		if status == UploadStatusUploading {
+			return nil
+		}
+		_, err := tx.Exec(`DELETE FROM resumable_upload_chunks WHERE upload_id = $1`, id)
+		return err
+	})
+}
+
+// DeleteResumableUpload removes an upload and its chunk records, unless it is being assembled.
+// It reports whether the upload was removed.
+func DeleteResumableUpload(db *sql.DB, id uuid.UUID) (bool, error) {
+	result, err := db.Exec(`DELETE FROM resumable_uploads WHERE id = $1 AND status <> 'assembling'`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// GetExpiredResumableUploads returns up to limit uploads that were abandoned before they
+// were assembled, oldest first
+func GetExpiredResumableUploads(db *sql.DB, asOf time.Time, limit int) ([]ResumableUpload, error) {
+	query := `SELECT ` + resumableUploadColumns + ` FROM resumable_uploads
+	          WHERE status IN ('uploading', 'assembling') AND expires_at <= $1
+	          ORDER BY expires_at LIMIT $2`
+	rows, err := db.Query(query, asOf, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []ResumableUpload{}
+	for rows.Next() {
+		u, err := scanResumableUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *u)
+	}
+	return uploads, rows.Err()
+}
+
+// ExpireResumableUpload marks an abandoned upload expired, drops its chunk records and returns
+// the object keys of its chunks. It returns no keys if the upload was resumed meanwhile.
+func ExpireResumableUpload(db *sql.DB, id uuid.UUID, asOf time.Time) ([]string, error) {
+	var keys []string
+	err := withTx(db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE resumable_uploads SET status = 'expired', updated_at = $1
+		                        WHERE id = $2 AND status IN ('uploading', 'assembling') AND expires_at <= $3`, time.Now(), id, asOf)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+
+		rows, err := tx.Query(`DELETE FROM resumable_upload_chunks WHERE upload_id = $1 RETURNING object_key`, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
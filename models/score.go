@@ -0,0 +1,84 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"sme_fin_backend/scoring"
+
+	"github.com/google/uuid"
+)
+
+// FinancingRequestScore is the recorded result of scoring a financing request.
+// A request is scored again each time its terms change; the latest score applies.
+type FinancingRequestScore struct {
+	ID                 uuid.UUID           `json:"id"`
+	FinancingRequestID uuid.UUID           `json:"financing_request_id"`
+	Score              int                 `json:"score"`
+	Band               string              `json:"band"`
+	FiredRules         []scoring.FiredRule `json:"fired_rules"`
+	RulesVersion       string              `json:"rules_version"`
+	AutoRejected       bool                `json:"auto_rejected"`
+	CreatedAt          time.Time           `json:"created_at"`
+}
+
+func (s *FinancingRequestScore) Create(db DBTX) error {
+	s.ID = uuid.New()
+	s.CreatedAt = time.Now()
+	if s.FiredRules == nil {
+		s.FiredRules = []scoring.FiredRule{}
+	}
+
+	firedRules, err := json.Marshal(s.FiredRules)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO financing_request_scores (id, financing_request_id, score, band, fired_rules, rules_version, auto_rejected, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = db.Exec(query, s.ID, s.FinancingRequestID, s.Score, s.Band, firedRules, s.RulesVersion, s.AutoRejected, s.CreatedAt)
+	return err
+}
+
+// GetLatestFinancingRequestScore returns the most recent score of a request, or nil if it was never scored
+func GetLatestFinancingRequestScore(db *sql.DB, requestID uuid.UUID) (*FinancingRequestScore, error) {
+	s := &FinancingRequestScore{}
+	var firedRules []byte
+	query := `SELECT id, financing_request_id, score, band, fired_rules, rules_version, auto_rejected, created_at
+	          FROM financing_request_scores WHERE financing_request_id = $1 ORDER BY created_at DESC LIMIT 1`
+	err := db.QueryRow(query, requestID).Scan(&s.ID, &s.FinancingRequestID, &s.Score, &s.Band, &firedRules,
+		&s.RulesVersion, &s.AutoRejected, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(firedRules, &s.FiredRules); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RecordFinancingRequestScore saves a score and, when it is marked AutoRejected, rejects the
+// still-pending request in the same transaction as a system action. It returns the rejected
+// request, or nil when the request was not rejected.
+func RecordFinancingRequestScore(db *sql.DB, s *FinancingRequestScore, rejectReason string) (*FinancingRequest, error) {
+	var rejected *FinancingRequest
+	err := withTx(db, func(tx *sql.Tx) error {
+		if err := s.Create(tx); err != nil {
+			return err
+		}
+		if !s.AutoRejected {
+			return nil
+		}
+		var err error
+		rejected, err = transitionFinancingRequest(tx, s.FinancingRequestID, FinancingStatusPending, FinancingStatusRejected, nil, rejectReason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rejected, nil
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a signed-in device. The refresh token itself is never stored, only its hash.
+type Session struct {
+	ID                uuid.UUID  `json:"id"`
+	UserID            uuid.UUID  `json:"user_id"`
+	RefreshTokenHash  string     `json:"-"`
+	PreviousTokenHash string     `json:"-"`
+	DeviceName        string     `json:"device_name"`
+	UserAgent         string     `json:"user_agent"`
+	IPAddress         string     `json:"ip_address"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	Current           bool       `json:"current"`
+}
+
+const sessionColumns = `id, user_id, refresh_token_hash, COALESCE(previous_token_hash, ''), device_name, user_agent,
+	          ip_address, created_at, last_used_at, expires_at, revoked_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	s := &Session{}
+	var revokedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.UserID, &s.RefreshTokenHash, &s.PreviousTokenHash, &s.DeviceName, &s.UserAgent,
+		&s.IPAddress, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	return s, nil
+}
+
+// IsActive reports whether the session can still be used
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+func (s *Session) Create(db *sql.DB) error {
+	s.ID = uuid.New()
+	s.CreatedAt = time.Now()
+	s.LastUsedAt = s.CreatedAt
+
+	query := `INSERT INTO sessions (id, user_id, refresh_token_hash, device_name, user_agent, ip_address, created_at, last_used_at, expires_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := db.Exec(query, s.ID, s.UserID, s.RefreshTokenHash, s.DeviceName, s.UserAgent, s.IPAddress,
+		s.CreatedAt, s.LastUsedAt, s.ExpiresAt)
+	return err
+}
+
+// Rotate replaces the refresh token hash. It only succeeds if the session still holds
+// the hash it was loaded with, so two concurrent refreshes cannot both win.
+func (s *Session) Rotate(db *sql.DB, newHash string, expiresAt time.Time, ipAddress string) (bool, error) {
+	now := time.Now()
+	query := `UPDATE sessions SET previous_token_hash = refresh_token_hash, refresh_token_hash = $1,
+	          last_used_at = $2, expires_at = $3, ip_address = $4
+	          WHERE id = $5 AND refresh_token_hash = $6 AND revoked_at IS NULL`
+	result, err := db.Exec(query, newHash, now, expiresAt, ipAddress, s.ID, s.RefreshTokenHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	s.PreviousTokenHash = s.RefreshTokenHash
+	s.RefreshTokenHash = newHash
+	s.LastUsedAt = now
+	s.ExpiresAt = expiresAt
+	s.IPAddress = ipAddress
+	return true, nil
+}
+
+func GetSessionByID(db *sql.DB, id uuid.UUID) (*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+	s, err := scanSession(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+func GetSessionByRefreshTokenHash(db *sql.DB, hash string) (*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE refresh_token_hash = $1`
+	s, err := scanSession(db.QueryRow(query, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+// GetSessionByPreviousTokenHash finds the session a rotated-out refresh token belonged to
+func GetSessionByPreviousTokenHash(db *sql.DB, hash string) (*Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE previous_token_hash = $1`
+	s, err := scanSession(db.QueryRow(query, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+func GetActiveSessionsByUserID(db *sql.DB, userID uuid.UUID) ([]Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+	          WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+	          ORDER BY last_used_at DESC`
+
+	rows, err := db.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// IsSessionActive reports whether a session exists and has neither been revoked nor expired
+func IsSessionActive(db *sql.DB, id uuid.UUID) (bool, error) {
+	var active bool
+	query := `SELECT revoked_at IS NULL AND expires_at > $2 FROM sessions WHERE id = $1`
+	err := db.QueryRow(query, id, time.Now()).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return active, err
+}
+
+// RevokeSession revokes one of the user's sessions. It returns false if no active session matched.
+func RevokeSession(db *sql.DB, id, userID uuid.UUID) (bool, error) {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+	result, err := db.Exec(query, time.Now(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// RevokeAllSessions revokes every active session of a user
+func RevokeAllSessions(db DBTX, userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	_, err := db.Exec(query, time.Now(), userID)
+	return err
+}
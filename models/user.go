@@ -2,14 +2,35 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 
+	"sme_fin_backend/money"
+	"sme_fin_backend/utils"
+
 	"github.com/google/uuid"
 )
 
+// Roles seeded in the roles table
+const (
+	RoleSME         = "sme"
+	RoleUnderwriter = "underwriter"
+	RoleAdmin       = "admin"
+)
+
+// ValidRole reports whether role is one of the seeded roles
+func ValidRole(role string) bool {
+	switch role {
+	case RoleSME, RoleUnderwriter, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -17,7 +38,8 @@ type User struct {
 type OTPVerification struct {
 	ID        uuid.UUID `json:"id"`
 	Email     string    `json:"email"`
-	OTP       string    `json:"otp"`
+	OTP       string    `json:"-"` // plain code, only held in memory until it is delivered
+	OTPHash   string    `json:"-"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 	Verified  bool      `json:"verified"`
@@ -34,19 +56,38 @@ type PersonalDetails struct {
 }
 
 type BusinessDetails struct {
-	ID                 uuid.UUID `json:"id"`
-	UserID             uuid.UUID `json:"user_id"`
-	BusinessName       string    `json:"business_name"`
-	TradeLicenseNumber string    `json:"trade_license_number"`
-	CreatedAt          time.Time `json:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at"`
+	ID                 uuid.UUID  `json:"id"`
+	UserID             uuid.UUID  `json:"user_id"`
+	BusinessName       string     `json:"business_name"`
+	TradeLicenseNumber string     `json:"trade_license_number"`
+	EstablishedOn      *time.Time `json:"established_on,omitempty"` // date the business was founded
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
 }
 
+// TradeLicense is the trade license step. Its file is the current version of the user's
+// trade_license document, which carries the scan and the review.
 type TradeLicense struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Filename  string    `json:"filename"`
-	FileURL   string    `json:"file_url"`
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	DocumentID   uuid.UUID  `json:"document_id"` // current version
+	Version      int        `json:"version"`
+	Filename     string     `json:"filename"`
+	ObjectKey    string     `json:"-"`                  // key of the uploaded file in private storage
+	FileURL      string     `json:"file_url,omitempty"` // set for licenses registered by URL instead of uploaded
+	DownloadURL  string     `json:"download_url"`
+	FileSize     *int64     `json:"file_size,omitempty"`   // bytes, for uploaded files
+	SHA256       string     `json:"sha256,omitempty"`      // hex digest, for uploaded files
+	ScanStatus   string     `json:"scan_status,omitempty"` // ScanStatus* for uploaded files
+	ScannedAt    *time.Time `json:"scanned_at,omitempty"`
+	ReviewStatus string     `json:"review_status"` // ReviewStatus*
+	ReviewNote   string     `json:"review_note,omitempty"`
+
+	IssuedOn         *time.Time `json:"issued_on,omitempty"`
+	ExpiresOn        *time.Time `json:"expires_on,omitempty"` // last day the license is valid
+	IssuingAuthority string     `json:"issuing_authority,omitempty"`
+	ExpiryStatus     string     `json:"expiry_status,omitempty"` // LicenseExpiry*, set by the daily job
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -59,8 +100,17 @@ type AccountStatus struct {
 	HasBusinessDetails bool      `json:"has_business_details"`
 	HasTradeLicense    bool      `json:"has_trade_license"`
 	IsComplete         bool      `json:"is_complete"`
+	NextStep           string    `json:"next_step,omitempty"` // first registration step not yet complete, or NextStepDocuments
+	Drafts             []string  `json:"drafts"`              // steps with a saved draft
+
+	// Documents is the account checklist (AccountRequiredDocuments)
+	Documents *DocumentChecklist `json:"documents"`
 }
 
+// NextStepDocuments is the next step of an account that completed registration but not its
+// document checklist
+const NextStepDocuments = "documents"
+
 type RegistrationSummary struct {
 	PersonalInfo PersonalDetails `json:"personal_info"`
 	BusinessInfo BusinessDetails `json:"business_info"`
@@ -68,14 +118,19 @@ type RegistrationSummary struct {
 }
 
 type FinancingRequest struct {
-	ID              uuid.UUID `json:"id"`
-	UserID          uuid.UUID `json:"user_id"`
-	Amount          float64   `json:"amount"`
-	Purpose         string    `json:"purpose"`
-	RepaymentPeriod int       `json:"repayment_period"` // in months
-	Status          string    `json:"status"`           // "pending", "approved", "rejected", "disbursed"
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              uuid.UUID   `json:"id"`
+	UserID          uuid.UUID   `json:"user_id"`
+	ProductID       *uuid.UUID  `json:"product_id,omitempty"` // nil for requests made before the product catalog
+	Amount          money.Money `json:"amount"`               // exact; encoded as a number in major units
+	Currency        string      `json:"currency"`
+	Purpose         string      `json:"purpose"`
+	RepaymentPeriod int         `json:"repayment_period"` // in months
+	Status          string      `json:"status"`           // see FinancingStatus* and financingTransitions
+	DecisionReason  string      `json:"decision_reason,omitempty"`
+	DecidedBy       *uuid.UUID  `json:"decided_by,omitempty"`
+	DecidedAt       *time.Time  `json:"decided_at,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
 }
 
 // Database methods
@@ -83,16 +138,45 @@ func (u *User) Create(db *sql.DB) error {
 	u.ID = uuid.New()
 	u.CreatedAt = time.Now()
 	u.UpdatedAt = time.Now()
+	if u.Role == "" {
+		u.Role = RoleSME
+	}
 
-	query := `INSERT INTO users (id, email, created_at, updated_at) VALUES ($1, $2, $3, $4)`
-	_, err := db.Exec(query, u.ID, u.Email, u.CreatedAt, u.UpdatedAt)
+	query := `INSERT INTO users (id, email, role, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := db.Exec(query, u.ID, u.Email, u.Role, u.CreatedAt, u.UpdatedAt)
 	return err
 }
 
+// UpdateRole changes the user's role and, in the same transaction, revokes all of their
+// sessions, so tokens issued under the old role stop working. Neither happens if the
+// revocation fails. It returns false if the user does not exist.
+func (u *User) UpdateRole(db *sql.DB, role string) (bool, error) {
+	now := time.Now()
+	found := false
+	err := withTx(db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`, role, now, u.ID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil || rows == 0 {
+			return err
+		}
+		found = true
+		return RevokeAllSessions(tx, u.ID)
+	})
+	if err != nil || !found {
+		return false, err
+	}
+	u.Role = role
+	u.UpdatedAt = now
+	return true, nil
+}
+
 func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 	user := &User{}
-	query := `SELECT id, email, created_at, updated_at FROM users WHERE email = $1`
-	err := db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	query := `SELECT id, email, role, created_at, updated_at FROM users WHERE email = $1`
+	err := db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -101,15 +185,25 @@ func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 
 func GetUserByID(db *sql.DB, id uuid.UUID) (*User, error) {
 	user := &User{}
-	query := `SELECT id, email, created_at, updated_at FROM users WHERE id = $1`
-	err := db.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	query := `SELECT id, email, role, created_at, updated_at FROM users WHERE id = $1`
+	err := db.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return user, err
 }
 
-func (otp *OTPVerification) Create(db *sql.DB) error {
+// Create generates a random code (unless OTP is preset) and stores only its hash
+func (otp *OTPVerification) Create(db DBTX) error {
+	if otp.OTP == "" {
+		code, err := utils.GenerateOTP()
+		if err != nil {
+			return err
+		}
+		otp.OTP = code
+	}
+	otp.OTPHash = utils.HashOTP(otp.Email, otp.OTP)
+
 	otp.ID = uuid.New()
 	otp.CreatedAt = time.Now()
 	otp.ExpiresAt = time.Now().Add(10 * time.Minute) // OTP expires in 10 minutes
@@ -117,7 +211,7 @@ func (otp *OTPVerification) Create(db *sql.DB) error {
 
 	query := `INSERT INTO otp_verifications (id, email, otp, expires_at, created_at, verified) 
 	          VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := db.Exec(query, otp.ID, otp.Email, otp.OTP, otp.ExpiresAt, otp.CreatedAt, otp.Verified)
+	_, err := db.Exec(query, otp.ID, otp.Email, otp.OTPHash, otp.ExpiresAt, otp.CreatedAt, otp.Verified)
 	return err
 }
 
@@ -128,8 +222,8 @@ func VerifyOTP(db *sql.DB, email, otp string) (*OTPVerification, error) {
 	          WHERE email = $1 AND otp = $2 AND verified = false 
 	          ORDER BY created_at DESC LIMIT 1`
 
-	err := db.QueryRow(query, email, otp).Scan(
-		&otpVerification.ID, &otpVerification.Email, &otpVerification.OTP,
+	err := db.QueryRow(query, email, utils.HashOTP(email, otp)).Scan(
+		&otpVerification.ID, &otpVerification.Email, &otpVerification.OTPHash,
 		&otpVerification.ExpiresAt, &otpVerification.CreatedAt, &otpVerification.Verified,
 	)
 
@@ -155,29 +249,17 @@ func VerifyOTP(db *sql.DB, email, otp string) (*OTPVerification, error) {
 	return otpVerification, nil
 }
 
-func (pd *PersonalDetails) CreateOrUpdate(db *sql.DB) error {
-	var existingID uuid.UUID
-	checkQuery := `SELECT id FROM personal_details WHERE user_id = $1`
-	err := db.QueryRow(checkQuery, pd.UserID).Scan(&existingID)
-
-	if err == sql.ErrNoRows {
-		// Create new
-		pd.ID = uuid.New()
-		pd.CreatedAt = time.Now()
-		pd.UpdatedAt = time.Now()
-		query := `INSERT INTO personal_details (id, user_id, full_name, email, phone_number, created_at, updated_at) 
-		          VALUES ($1, $2, $3, $4, $5, $6, $7)`
-		_, err = db.Exec(query, pd.ID, pd.UserID, pd.FullName, pd.Email, pd.PhoneNumber, pd.CreatedAt, pd.UpdatedAt)
-	} else if err == nil {
-		// Update existing
-		pd.ID = existingID
-		pd.UpdatedAt = time.Now()
-		query := `UPDATE personal_details SET full_name = $1, email = $2, phone_number = $3, updated_at = $4 
-		          WHERE user_id = $5`
-		_, err = db.Exec(query, pd.FullName, pd.Email, pd.PhoneNumber, pd.UpdatedAt, pd.UserID)
-	}
-
-	return err
+// CreateOrUpdate saves the user's personal details in one upsert, so concurrent saves cannot
+// create duplicates. db may be a transaction.
+func (pd *PersonalDetails) CreateOrUpdate(db DBTX) error {
+	now := time.Now()
+	query := `INSERT INTO personal_details (id, user_id, full_name, email, phone_number, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $6)
+	          ON CONFLICT (user_id) DO UPDATE SET full_name = EXCLUDED.full_name, email = EXCLUDED.email,
+	              phone_number = EXCLUDED.phone_number, updated_at = EXCLUDED.updated_at
+	          RETURNING id, created_at, updated_at`
+	return db.QueryRow(query, uuid.New(), pd.UserID, pd.FullName, pd.Email, pd.PhoneNumber, now).
+		Scan(&pd.ID, &pd.CreatedAt, &pd.UpdatedAt)
 }
 
 func GetPersonalDetails(db *sql.DB, userID uuid.UUID) (*PersonalDetails, error) {
@@ -193,80 +275,197 @@ func GetPersonalDetails(db *sql.DB, userID uuid.UUID) (*PersonalDetails, error)
 	return pd, err
 }
 
-func (bd *BusinessDetails) CreateOrUpdate(db *sql.DB) error {
-	var existingID uuid.UUID
-	checkQuery := `SELECT id FROM business_details WHERE user_id = $1`
-	err := db.QueryRow(checkQuery, bd.UserID).Scan(&existingID)
-
-	if err == sql.ErrNoRows {
-		// Create new
-		bd.ID = uuid.New()
-		bd.CreatedAt = time.Now()
-		bd.UpdatedAt = time.Now()
-		query := `INSERT INTO business_details (id, user_id, business_name, trade_license_number, created_at, updated_at) 
-		          VALUES ($1, $2, $3, $4, $5, $6)`
-		_, err = db.Exec(query, bd.ID, bd.UserID, bd.BusinessName, bd.TradeLicenseNumber, bd.CreatedAt, bd.UpdatedAt)
-	} else if err == nil {
-		// Update existing
-		bd.ID = existingID
-		bd.UpdatedAt = time.Now()
-		query := `UPDATE business_details SET business_name = $1, trade_license_number = $2, updated_at = $3 
-		          WHERE user_id = $4`
-		_, err = db.Exec(query, bd.BusinessName, bd.TradeLicenseNumber, bd.UpdatedAt, bd.UserID)
+// CreateOrUpdate saves the user's business details in one upsert. db may be a transaction.
+func (bd *BusinessDetails) CreateOrUpdate(db DBTX) error {
+	now := time.Now()
+	// A missing establishment date keeps the stored one
+	query := `INSERT INTO business_details (id, user_id, business_name, trade_license_number, established_on, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $6)
+	          ON CONFLICT (user_id) DO UPDATE SET business_name = EXCLUDED.business_name,
+	              trade_license_number = EXCLUDED.trade_license_number,
+	              established_on = COALESCE(EXCLUDED.established_on, business_details.established_on),
+	              updated_at = EXCLUDED.updated_at
+	          RETURNING id, established_on, created_at, updated_at`
+	var establishedOn sql.NullTime
+	err := db.QueryRow(query, uuid.New(), bd.UserID, bd.BusinessName, bd.TradeLicenseNumber, bd.EstablishedOn, now).
+		Scan(&bd.ID, &establishedOn, &bd.CreatedAt, &bd.UpdatedAt)
+	if err != nil {
+		return err
 	}
-
-	return err
+	if establishedOn.Valid {
+		bd.EstablishedOn = &establishedOn.Time
+	}
+	return nil
 }
 
 func GetBusinessDetails(db *sql.DB, userID uuid.UUID) (*BusinessDetails, error) {
 	bd := &BusinessDetails{}
-	query := `SELECT id, user_id, business_name, trade_license_number, created_at, updated_at 
+	var establishedOn sql.NullTime
+	query := `SELECT id, user_id, business_name, trade_license_number, established_on, created_at, updated_at 
 	          FROM business_details WHERE user_id = $1`
 	err := db.QueryRow(query, userID).Scan(
-		&bd.ID, &bd.UserID, &bd.BusinessName, &bd.TradeLicenseNumber, &bd.CreatedAt, &bd.UpdatedAt,
+		&bd.ID, &bd.UserID, &bd.BusinessName, &bd.TradeLicenseNumber, &establishedOn, &bd.CreatedAt, &bd.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	if establishedOn.Valid {
+		bd.EstablishedOn = &establishedOn.Time
+	}
 	return bd, err
 }
 
-func (tl *TradeLicense) CreateOrUpdate(db *sql.DB) error {
-	var existingID uuid.UUID
-	checkQuery := `SELECT id FROM trade_licenses WHERE user_id = $1`
-	err := db.QueryRow(checkQuery, tl.UserID).Scan(&existingID)
+// CreateOrUpdate saves the user's trade license in one upsert. db should be a transaction.
+// A new file, or one replacing a version that was rejected or found infected, is stored as the
+// next version of the trade_license document, awaiting review, with its FileSize and SHA256.
+// An uploaded file stays quarantined (ScanStatusPending) unless ScanStatus is ScanStatusClean. Missing dates and issuing authority keep the stored ones; a
+// new expiry date clears the expiry flag and the reminders sent.
+func (tl *TradeLicense) CreateOrUpdate(db DBTX) error {
+	current, err := getTradeLicense(db, tl.UserID, true)
+	if err != nil {
+		return err
+	}
 
-	if err == sql.ErrNoRows {
-		// Create new
-		tl.ID = uuid.New()
-		tl.CreatedAt = time.Now()
-		tl.UpdatedAt = time.Now()
-		query := `INSERT INTO trade_licenses (id, user_id, filename, file_url, created_at, updated_at) 
-		          VALUES ($1, $2, $3, $4, $5, $6)`
-		_, err = db.Exec(query, tl.ID, tl.UserID, tl.Filename, tl.FileURL, tl.CreatedAt, tl.UpdatedAt)
-	} else if err == nil {
-		// Update existing
-		tl.ID = existingID
-		tl.UpdatedAt = time.Now()
-		query := `UPDATE trade_licenses SET filename = $1, file_url = $2, updated_at = $3 
-		          WHERE user_id = $4`
-		_, err = db.Exec(query, tl.Filename, tl.FileURL, tl.UpdatedAt, tl.UserID)
+	documentID := uuid.Nil
+	if current != nil && current.ObjectKey == tl.ObjectKey && current.FileURL == tl.FileURL &&
+		current.ScanStatus != ScanStatusInfected && current.ReviewStatus != ReviewStatusRejected {
+		documentID = current.DocumentID
+	}
+	expiresOn := tl.ExpiresOn
+	if expiresOn == nil && current != nil {
+		expiresOn = current.ExpiresOn
+	}
+	if documentID == uuid.Nil {
+		document := &BusinessDocument{
+			UserID:       tl.UserID,
+			DocumentType: DocumentTypeTradeLicense,
+			Filename:     tl.Filename,
+			ObjectKey:    tl.ObjectKey,
+			FileURL:      tl.FileURL,
+			ExpiresOn:    expiresOn,
+		}
+		if tl.ObjectKey != "" {
+			document.SHA256 = tl.SHA256
+			document.ScanStatus = ScanStatusPending
+			if tl.FileSize != nil {
+				document.FileSize = *tl.FileSize
+			}
+			if tl.ScanStatus == ScanStatusClean {
+				document.ScanStatus = ScanStatusClean
+			}
+		}
+		if err := createBusinessDocument(db, document); err != nil {
+			return err
+		}
+		documentID = document.ID
+	} else if expiresOn != nil {
+		_, err := db.Exec(`UPDATE documents SET expires_on = $1, updated_at = $2 WHERE id = $3 AND expires_on IS DISTINCT FROM $1`,
+			expiresOn, time.Now(), documentID)
+		if err != nil {
+			return err
+		}
 	}
 
-	return err
+	now := time.Now()
+	query := `INSERT INTO trade_licenses (id, user_id, document_id, filename, object_key, file_url, issued_on, expires_on,
+	              issuing_authority, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $8, $9, NULLIF($10, ''), $7, $7)
+	          ON CONFLICT (user_id) DO UPDATE SET document_id = EXCLUDED.document_id, filename = EXCLUDED.filename,
+	              object_key = EXCLUDED.object_key, file_url = EXCLUDED.file_url, updated_at = EXCLUDED.updated_at,
+	              issued_on = COALESCE(EXCLUDED.issued_on, trade_licenses.issued_on),
+	              expires_on = COALESCE(EXCLUDED.expires_on, trade_licenses.expires_on),
+	              issuing_authority = COALESCE(EXCLUDED.issuing_authority, trade_licenses.issuing_authority),
+	              expiry_status = CASE WHEN EXCLUDED.expires_on IS NULL OR EXCLUDED.expires_on = trade_licenses.expires_on
+	                  THEN trade_licenses.expiry_status END,
+	              expiry_reminder_days = CASE WHEN EXCLUDED.expires_on IS NULL OR EXCLUDED.expires_on = trade_licenses.expires_on
+	                  THEN trade_licenses.expiry_reminder_days END`
+	_, err = db.Exec(query, uuid.New(), tl.UserID, documentID, tl.Filename, tl.ObjectKey, tl.FileURL, now,
+		tl.IssuedOn, tl.ExpiresOn, tl.IssuingAuthority)
+	if err != nil {
+		return err
+	}
+
+	saved, err := getTradeLicense(db, tl.UserID, false)
+	if err != nil {
+		return err
+	}
+	*tl = *saved
+	return nil
 }
 
+// SaveRegistration saves personal details, business details and the trade license in one
+// transaction: either all three are stored or none is. The drafts of the steps are removed,
+// since every step is now complete; it returns the files they held that no document refers
+// to, for the caller to delete from storage.
+func SaveRegistration(db *sql.DB, pd *PersonalDetails, bd *BusinessDetails, tl *TradeLicense) ([]string, error) {
+	var orphaned []string
+	err := withTx(db, func(tx *sql.Tx) error {
+		if err := pd.CreateOrUpdate(tx); err != nil {
+			return fmt.Errorf("saving personal details: %w", err)
+		}
+		if err := bd.CreateOrUpdate(tx); err != nil {
+			return fmt.Errorf("saving business details: %w", err)
+		}
+		if err := tl.CreateOrUpdate(tx); err != nil {
+			return fmt.Errorf("saving trade license: %w", err)
+		}
+		var err error
+		if _, orphaned, err = deleteRegistrationDrafts(tx, `user_id = $1`, pd.UserID); err != nil {
+			return fmt.Errorf("removing registration drafts: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphaned, nil
+}
+
+// GetTradeLicense returns the user's trade license with its current version, or nil if the
+// step was never saved
 func GetTradeLicense(db *sql.DB, userID uuid.UUID) (*TradeLicense, error) {
+	return getTradeLicense(db, userID, false)
+}
+
+func getTradeLicense(db DBTX, userID uuid.UUID, forUpdate bool) (*TradeLicense, error) {
+	query := `SELECT tl.id, tl.user_id, tl.document_id, d.version, d.filename, COALESCE(d.object_key, ''), COALESCE(d.file_url, ''),
+	              d.file_size, COALESCE(d.sha256, ''), COALESCE(d.scan_status, ''), d.scanned_at, d.review_status,
+	              COALESCE(d.review_note, ''), tl.issued_on, tl.expires_on, COALESCE(tl.issuing_authority, ''),
+	              COALESCE(tl.expiry_status, ''), tl.created_at, tl.updated_at
+	          FROM trade_licenses tl JOIN documents d ON d.id = tl.document_id
+	          WHERE tl.user_id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE OF tl`
+	}
 	tl := &TradeLicense{}
-	query := `SELECT id, user_id, filename, file_url, created_at, updated_at 
-	          FROM trade_licenses WHERE user_id = $1`
+	var fileSize sql.NullInt64
+	var scannedAt, issuedOn, expiresOn sql.NullTime
 	err := db.QueryRow(query, userID).Scan(
-		&tl.ID, &tl.UserID, &tl.Filename, &tl.FileURL, &tl.CreatedAt, &tl.UpdatedAt,
+		&tl.ID, &tl.UserID, &tl.DocumentID, &tl.Version, &tl.Filename, &tl.ObjectKey, &tl.FileURL,
+		&fileSize, &tl.SHA256, &tl.ScanStatus, &scannedAt, &tl.ReviewStatus,
+		&tl.ReviewNote, &issuedOn, &expiresOn, &tl.IssuingAuthority,
+		&tl.ExpiryStatus, &tl.CreatedAt, &tl.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return tl, err
+	if err != nil {
+		return nil, err
+	}
+	if fileSize.Valid {
+		tl.FileSize = &fileSize.Int64
+	}
+	if scannedAt.Valid {
+		tl.ScannedAt = &scannedAt.Time
+	}
+	if issuedOn.Valid {
+		tl.IssuedOn = &issuedOn.Time
+	}
+	if expiresOn.Valid {
+		tl.ExpiresOn = &expiresOn.Time
+	}
+	tl.DownloadURL = DocumentDownloadPath(tl.DocumentID)
+	return tl, nil
 }
 
 func GetAccountStatus(db *sql.DB, userID uuid.UUID) (*AccountStatus, error) {
@@ -298,15 +497,38 @@ func GetAccountStatus(db *sql.DB, userID uuid.UUID) (*AccountStatus, error) {
 	}
 	status.HasBusinessDetails = bd != nil
 
-	// Check trade license
-	tl, err := GetTradeLicense(db, userID)
+	// Check the trade license and the other required documents
+	status.Documents, err = GetDocumentChecklist(db, userID, AccountRequiredDocuments, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range status.Documents.Items {
+		if item.Requirement == DocumentTypeTradeLicense {
+			status.HasTradeLicense = item.Met()
+		}
+	}
+
+	status.Drafts, err = GetRegistrationDraftSteps(db, userID)
 	if err != nil {
 		return nil, err
 	}
-	status.HasTradeLicense = tl != nil
+	completed := map[string]bool{
+		RegistrationStepPersonal:     status.HasPersonalDetails,
+		RegistrationStepBusiness:     status.HasBusinessDetails,
+		RegistrationStepTradeLicense: status.HasTradeLicense,
+	}
+	for _, step := range RegistrationSteps {
+		if !completed[step] {
+			status.NextStep = step
+			break
+		}
+	}
+	if status.NextStep == "" && !status.Documents.Complete {
+		status.NextStep = NextStepDocuments
+	}
 
 	// Determine if account is "old" (complete)
-	status.IsComplete = status.HasPersonalDetails && status.HasBusinessDetails && status.HasTradeLicense
+	status.IsComplete = status.HasPersonalDetails && status.HasBusinessDetails && status.Documents.Complete
 	if status.IsComplete {
 		status.Status = "old"
 	}
@@ -350,18 +572,56 @@ func (fr *FinancingRequest) Create(db *sql.DB) error {
 	fr.ID = uuid.New()
 	fr.CreatedAt = time.Now()
 	fr.UpdatedAt = time.Now()
-	if fr.Status == "" {
-		fr.Status = "pending"
-	}
+	fr.Status = FinancingStatusPending
+	fr.Currency = fr.Amount.Currency
 
-	query := `INSERT INTO financing_requests (id, user_id, amount, purpose, repayment_period, status, created_at, updated_at) 
-	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := db.Exec(query, fr.ID, fr.UserID, fr.Amount, fr.Purpose, fr.RepaymentPeriod, fr.Status, fr.CreatedAt, fr.UpdatedAt)
-	return err
+	return withTx(db, func(tx *sql.Tx) error {
+		query := `INSERT INTO financing_requests (id, user_id, product_id, amount_minor, currency, purpose, repayment_period, status, created_at, updated_at) 
+		          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+		_, err := tx.Exec(query, fr.ID, fr.UserID, fr.ProductID, fr.Amount.Minor, fr.Amount.Currency, fr.Purpose, fr.RepaymentPeriod, fr.Status, fr.CreatedAt, fr.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		// Every request starts its history with the submission
+		event := &FinancingRequestEvent{
+			FinancingRequestID: fr.ID,
+			ToStatus:           fr.Status,
+			ActorID:            &fr.UserID,
+			CreatedAt:          fr.CreatedAt,
+		}
+		return event.Create(tx)
+	})
+}
+
+// financingRequestColumns matches the scan order of scanFinancingRequest
+const financingRequestColumns = `id, user_id, product_id, amount_minor, currency, purpose, repayment_period, status,
+	          COALESCE(decision_reason, ''), decided_by, decided_at, created_at, updated_at`
+
+func scanFinancingRequest(row interface{ Scan(...interface{}) error }) (*FinancingRequest, error) {
+	fr := &FinancingRequest{}
+	var productID, decidedBy uuid.NullUUID
+	var decidedAt sql.NullTime
+	err := row.Scan(&fr.ID, &fr.UserID, &productID, &fr.Amount.Minor, &fr.Currency, &fr.Purpose, &fr.RepaymentPeriod, &fr.Status,
+		&fr.DecisionReason, &decidedBy, &decidedAt, &fr.CreatedAt, &fr.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	fr.Amount.Currency = fr.Currency
+	if productID.Valid {
+		fr.ProductID = &productID.UUID
+	}
+	if decidedBy.Valid {
+		fr.DecidedBy = &decidedBy.UUID
+	}
+	if decidedAt.Valid {
+		fr.DecidedAt = &decidedAt.Time
+	}
+	return fr, nil
 }
 
 func GetFinancingRequestsByUserID(db *sql.DB, userID uuid.UUID) ([]FinancingRequest, error) {
-	query := `SELECT id, user_id, amount, purpose, repayment_period, status, created_at, updated_at 
+	query := `SELECT ` + financingRequestColumns + `
 	          FROM financing_requests WHERE user_id = $1 ORDER BY created_at DESC`
 
 	rows, err := db.Query(query, userID)
@@ -372,24 +632,20 @@ func GetFinancingRequestsByUserID(db *sql.DB, userID uuid.UUID) ([]FinancingRequ
 
 	var requests []FinancingRequest
 	for rows.Next() {
-		var fr FinancingRequest
-		err := rows.Scan(&fr.ID, &fr.UserID, &fr.Amount, &fr.Purpose, &fr.RepaymentPeriod, &fr.Status, &fr.CreatedAt, &fr.UpdatedAt)
+		fr, err := scanFinancingRequest(rows)
 		if err != nil {
 			return nil, err
 		}
-		requests = append(requests, fr)
+		requests = append(requests, *fr)
 	}
 
 	return requests, rows.Err()
 }
 
 func GetFinancingRequestByID(db *sql.DB, id uuid.UUID) (*FinancingRequest, error) {
-	fr := &FinancingRequest{}
-	query := `SELECT id, user_id, amount, purpose, repayment_period, status, created_at, updated_at 
+	query := `SELECT ` + financingRequestColumns + `
 	          FROM financing_requests WHERE id = $1`
-	err := db.QueryRow(query, id).Scan(
-		&fr.ID, &fr.UserID, &fr.Amount, &fr.Purpose, &fr.RepaymentPeriod, &fr.Status, &fr.CreatedAt, &fr.UpdatedAt,
-	)
+	fr, err := scanFinancingRequest(db.QueryRow(query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -397,12 +653,9 @@ func GetFinancingRequestByID(db *sql.DB, id uuid.UUID) (*FinancingRequest, error
 }
 
 func GetLatestFinancingRequestByUserID(db *sql.DB, userID uuid.UUID) (*FinancingRequest, error) {
-	fr := &FinancingRequest{}
-	query := `SELECT id, user_id, amount, purpose, repayment_period, status, created_at, updated_at 
+	query := `SELECT ` + financingRequestColumns + `
 	          FROM financing_requests WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`
-	err := db.QueryRow(query, userID).Scan(
-		&fr.ID, &fr.UserID, &fr.Amount, &fr.Purpose, &fr.RepaymentPeriod, &fr.Status, &fr.CreatedAt, &fr.UpdatedAt,
-	)
+	fr, err := scanFinancingRequest(db.QueryRow(query, userID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -0,0 +1,189 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Currency describes an ISO 4217 currency accepted for financing
+type Currency struct {
+	Code     string
+	Exponent int   // number of minor-unit digits (2 for AED: 1 dirham = 100 fils)
+	MinMinor int64 // smallest financing amount, in minor units
+	MaxMinor int64 // largest financing amount, in minor units
+}
+
+// currencies lists the supported currencies and their financing limits
+var currencies = map[string]Currency{
+	"AED": {Code: "AED", Exponent: 2, MinMinor: 1000_00, MaxMinor: 5_000_000_00},
+	"SAR": {Code: "SAR", Exponent: 2, MinMinor: 1000_00, MaxMinor: 5_000_000_00},
+	"USD": {Code: "USD", Exponent: 2, MinMinor: 250_00, MaxMinor: 1_500_000_00},
+	"EUR": {Code: "EUR", Exponent: 2, MinMinor: 250_00, MaxMinor: 1_500_000_00},
+	"GBP": {Code: "GBP", Exponent: 2, MinMinor: 200_00, MaxMinor: 1_200_000_00},
+}
+
+var (
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrTooManyDecimals     = errors.New("amount has more decimal places than the currency allows")
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+)
+
+// LookupCurrency returns the currency for an ISO 4217 code (case-insensitive)
+func LookupCurrency(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	return c, ok
+}
+
+// CurrencyCodes returns the codes of the supported currencies, sorted
+func CurrencyCodes() []string {
+	codes := make([]string, 0, len(currencies))
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// DefaultCurrency is the currency assumed when a client does not send one (DEFAULT_CURRENCY, default AED)
+func DefaultCurrency() string {
+	if code := os.Getenv("DEFAULT_CURRENCY"); code != "" {
+		return strings.ToUpper(code)
+	}
+	return "AED"
+}
+
+// Money is an exact amount in the minor units of a currency
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// New returns an amount in minor units
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// Parse converts a decimal string such as "50000" or "1250.75" into minor units without
+// going through floating point. More decimal places than the currency has are rejected.
+func Parse(amount, currency string) (Money, error) {
+	c, ok := LookupCurrency(currency)
+	if !ok {
+		return Money{}, ErrUnsupportedCurrency
+	}
+
+	s := strings.TrimSpace(amount)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" || (hasPoint && frac == "") || !isDigits(whole) || !isDigits(frac) {
+		return Money{}, ErrInvalidAmount
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > c.Exponent {
+		return Money{}, ErrTooManyDecimals
+	}
+	frac += strings.Repeat("0", c.Exponent-len(frac))
+
+	minor, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{Minor: minor, Currency: c.Code}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) exponent() int {
+	if c, ok := LookupCurrency(m.Currency); ok {
+		return c.Exponent
+	}
+	return 2
+}
+
+// String formats the amount in major units with all minor digits, e.g. "1250.50"
+func (m Money) String() string {
+	exp := m.exponent()
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(minor, 10)
+	}
+	scale := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/scale, exp, minor%scale)
+}
+
+// Display formats the amount for people, e.g. "AED 1,250.50"
+func (m Money) Display() string {
+	s := m.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if hasFrac {
+		b.WriteString("." + frac)
+	}
+	return m.Currency + " " + sign + b.String()
+}
+
+// MarshalJSON encodes the amount as a JSON number in major units ("50000", "1250.5"),
+// which keeps the wire format of the former float amount while staying exact
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := m.String()
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return []byte(s), nil
+}
+
+// Add returns m + other. Both amounts must be in the same currency.
+func (m Money) Add(other Money) Money {
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}
+}
+
+// Sub returns m - other. Both amounts must be in the same currency.
+func (m Money) Sub(other Money) Money {
+	return Money{Minor: m.Minor - other.Minor, Currency: m.Currency}
+}
+
+// CheckLimits verifies the amount is within the currency's financing limits
+func (m Money) CheckLimits() error {
+	c, ok := LookupCurrency(m.Currency)
+	if !ok {
+		return ErrUnsupportedCurrency
+	}
+	if m.Minor < c.MinMinor || m.Minor > c.MaxMinor {
+		return fmt.Errorf("amount must be between %s and %s", New(c.MinMinor, c.Code).Display(), New(c.MaxMinor, c.Code).Display())
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{amount: "50000", currency: "AED", want: New(50000_00, "AED")},
+		{amount: "1250.75", currency: "AED", want: New(1250_75, "AED")},
+		{amount: " 1250.75 ", currency: "AED", want: New(1250_75, "AED")},
+		{amount: "1250.5", currency: "USD", want: New(1250_50, "USD")},
+		{amount: "1250.750", currency: "USD", want: New(1250_75, "USD")},
+		{amount: "0.01", currency: "GBP", want: New(1, "GBP")},
+		{amount: "0", currency: "EUR", want: New(0, "EUR")},
+		{amount: "-0.01", currency: "AED", want: New(-1, "AED")},
+		{amount: "+12", currency: "AED", want: New(12_00, "AED")},
+		{amount: "100", currency: " sar ", want: New(100_00, "SAR")},
+		{amount: "92233720368547758.07", currency: "AED", want: New(math.MaxInt64, "AED")},
+
+		{amount: "1.234", currency: "AED", wantErr: ErrTooManyDecimals},
+		{amount: "0.001", currency: "USD", wantErr: ErrTooManyDecimals},
+
+		{amount: "", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "-", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: ".5", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "5.", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "1,000", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "1e3", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "1.2.3", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "+-5", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "٥٠٠", currency: "AED", wantErr: ErrInvalidAmount},
+		{amount: "92233720368547758.08", currency: "AED", wantErr: ErrInvalidAmount},
+
+		{amount: "100", currency: "XYZ", wantErr: ErrUnsupportedCurrency},
+		{amount: "100", currency: "", wantErr: ErrUnsupportedCurrency},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.amount, tt.currency)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Parse(%q, %q) error = %v, want %v", tt.amount, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %q) = %+v, want %+v", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		m       Money
+		str     string
+		display string
+		json    string
+	}{
+		{m: New(1250_50, "AED"), str: "1250.50", display: "AED 1,250.50", json: "1250.5"},
+		{m: New(50000_00, "USD"), str: "50000.00", display: "USD 50,000.00", json: "50000"},
+		{m: New(5, "GBP"), str: "0.05", display: "GBP 0.05", json: "0.05"},
+		{m: New(-1234567_89, "EUR"), str: "-1234567.89", display: "EUR -1,234,567.89", json: "-1234567.89"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.str {
+			t.Errorf("%+v.String() = %q, want %q", tt.m, got, tt.str)
+		}
+		if got := tt.m.Display(); got != tt.display {
+			t.Errorf("%+v.Display() = %q, want %q", tt.m, got, tt.display)
+		}
+		if got, _ := tt.m.MarshalJSON(); string(got) != tt.json {
+			t.Errorf("%+v.MarshalJSON() = %s, want %s", tt.m, got, tt.json)
+		}
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	tests := []struct {
+		m       Money
+		wantErr bool
+	}{
+		{m: New(1000_00, "AED")},
+		{m: New(5_000_000_00, "AED")},
+		{m: New(999_99, "AED"), wantErr: true},
+		{m: New(5_000_000_01, "AED"), wantErr: true},
+		{m: New(250_00, "USD")},
+		{m: New(100_00, "XYZ"), wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.m.CheckLimits(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v.CheckLimits() = %v, want error %v", tt.m, err, tt.wantErr)
+		}
+	}
+}
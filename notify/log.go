@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogNotifier is a development/test sink. Messages are appended as JSON lines to Path,
+// or written to the standard logger when Path is empty.
+type LogNotifier struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (n *LogNotifier) Send(ctx context.Context, msg Message) error {
+	if n.Path == "" {
+		log.Printf("notification to=%s subject=%q body=%q", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	line, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sent_at"`
+	}{msg, time.Now()})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open notification log: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"sme_fin_backend/utils"
+)
+
+// Message is a single notification addressed to one recipient
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers messages to users (OTP codes, reminders, ...)
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv builds the notifier selected by the NOTIFIER environment variable.
+// Supported values are "smtp" and "log". When NOTIFIER is not set, SMTP is used if
+// SMTP_HOST is configured, and the log sink is only used as a fallback in dev mode.
+func NewFromEnv() (Notifier, error) {
+	kind := strings.ToLower(os.Getenv("NOTIFIER"))
+	if kind == "" {
+		switch {
+		case os.Getenv("SMTP_HOST") != "":
+			kind = "smtp"
+		case utils.IsDevMode():
+			kind = "log"
+		default:
+			return nil, fmt.Errorf("no notifier configured: set NOTIFIER or SMTP_HOST")
+		}
+	}
+
+	switch kind {
+	case "smtp":
+		return NewSMTPNotifierFromEnv()
+	case "log":
+		return &LogNotifier{Path: os.Getenv("NOTIFY_LOG_FILE")}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", kind)
+	}
+}
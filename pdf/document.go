@@ -0,0 +1,226 @@
+// Package pdf writes simple text documents as PDF 1.4 without external dependencies.
+// Text is set in the standard Courier fonts, so layout is a fixed-width character grid.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 56.0
+)
+
+// Font sizes used by the document
+const (
+	bodySize    = 9.5
+	headingSize = 13.0
+)
+
+// charWidth is the advance of every Courier glyph, as a fraction of the font size
+const charWidth = 0.6
+
+type line struct {
+	text string
+	bold bool
+	size float64
+}
+
+// Document accumulates lines of text and lays them out on A4 pages
+type Document struct {
+	title string
+	lines []line
+}
+
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// Heading adds a bold heading, wrapped to the page width
+func (d *Document) Heading(text string) {
+	for _, l := range wrap(text, columns(headingSize)) {
+		d.lines = append(d.lines, line{text: l, bold: true, size: headingSize})
+	}
+}
+
+// Subheading adds a bold line in the body size, wrapped to the page width
+func (d *Document) Subheading(text string) {
+	for _, l := range wrap(text, columns(bodySize)) {
+		d.lines = append(d.lines, line{text: l, bold: true, size: bodySize})
+	}
+}
+
+// Text adds a paragraph, wrapped to the page width
+func (d *Document) Text(text string) {
+	for _, l := range wrap(text, columns(bodySize)) {
+		d.lines = append(d.lines, line{text: l, size: bodySize})
+	}
+}
+
+// Preformatted adds a line as is, cut at the page width. Use it for aligned tables.
+func (d *Document) Preformatted(text string) {
+	if max := columns(bodySize); len([]rune(text)) > max {
+		text = string([]rune(text)[:max])
+	}
+	d.lines = append(d.lines, line{text: text, size: bodySize})
+}
+
+// Blank adds an empty line
+func (d *Document) Blank() {
+	d.lines = append(d.lines, line{size: bodySize})
+}
+
+// columns is how many characters fit on a line at the given size
+func columns(size float64) int {
+	return int((pageWidth - 2*margin) / (size * charWidth))
+}
+
+// wrap breaks text into lines of at most width characters, at spaces where possible
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		current := ""
+		for _, word := range words {
+			for len([]rune(word)) > width {
+				if current != "" {
+					lines = append(lines, current)
+					current = ""
+				}
+				lines = append(lines, string([]rune(word)[:width]))
+				word = string([]rune(word)[width:])
+			}
+			switch {
+			case current == "":
+				current = word
+			case len([]rune(current))+1+len([]rune(word)) <= width:
+				current += " " + word
+			default:
+				lines = append(lines, current)
+				current = word
+			}
+		}
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// Bytes renders the document. The output only depends on the content, so the same
+// document always produces the same bytes.
+func (d *Document) Bytes() []byte {
+	// Lay the lines out on pages, leaving room for the page number
+	var pages [][]string
+	var page []string
+	y := pageHeight - margin
+	for _, l := range d.lines {
+		leading := l.size * 1.35
+		if y-leading < margin+20 && len(page) > 0 {
+			pages = append(pages, page)
+			page = nil
+			y = pageHeight - margin
+		}
+		y -= leading
+		if l.text != "" {
+			font := "F1"
+			if l.bold {
+				font = "F2"
+			}
+			page = append(page, fmt.Sprintf("BT /%s %.1f Tf 1 0 0 1 %.2f %.2f Tm (%s) Tj ET", font, l.size, margin, y, escape(l.text)))
+		}
+	}
+	pages = append(pages, page)
+
+	var objects []string
+	addObject := func(body string) int {
+		objects = append(objects, body)
+		return len(objects)
+	}
+
+	catalog := addObject("") // filled in once the page tree is known
+	pagesID := addObject("")
+	regular := addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	bold := addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	var kids []string
+	for i, commands := range pages {
+		footer := fmt.Sprintf("BT /F1 8.0 Tf 1 0 0 1 %.2f %.2f Tm (%s) Tj ET", margin, margin-10,
+			escape(fmt.Sprintf("%s - page %d of %d", d.title, i+1, len(pages))))
+		content := strings.Join(append(commands, footer), "\n")
+		contentID := addObject(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+		pageID := addObject(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+			pagesID, pageWidth, pageHeight, regular, bold, contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+	objects[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID)
+	objects[pagesID-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+	info := addObject(fmt.Sprintf("<< /Title (%s) /Producer (SMEfin) >>", escape(d.title)))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, body := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, info, xref)
+	return buf.Bytes()
+}
+
+// UnsupportedTextError reports a character the standard fonts cannot set
+type UnsupportedTextError struct {
+	Char rune
+}
+
+func (e *UnsupportedTextError) Error() string {
+	return fmt.Sprintf("character %q (U+%04X) cannot be set in the standard PDF fonts", e.Char, e.Char)
+}
+
+// supported reports whether a character can be set: printable Latin-1
+func supported(r rune) bool {
+	return (r >= 32 && r < 127) || (r >= 160 && r < 256)
+}
+
+// CheckText returns an *UnsupportedTextError for the first character of text that the
+// document cannot show, such as Arabic script. Check text that must not be altered, like the
+// parties of a contract, before adding it: Bytes replaces such characters with '?'.
+func CheckText(text string) error {
+	for _, r := range text {
+		if r != '\n' && !supported(r) {
+			return &UnsupportedTextError{Char: r}
+		}
+	}
+	return nil
+}
+
+// escape encodes text as the body of a PDF literal string in WinAnsi encoding.
+// Characters outside Latin-1 are replaced with '?'.
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case supported(r):
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,168 @@
+package scoring
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Config is a set of weighted rules. It is loaded from JSON.
+type Config struct {
+	Version         string `json:"version"`
+	BaseScore       int    `json:"base_score"`
+	AutoRejectAbove int    `json:"auto_reject_above"` // 0 disables auto-reject
+	Bands           []Band `json:"bands"`             // ordered by max_score; the last must reach 100
+	Rules           []Rule `json:"rules"`
+}
+
+// Band names the range of scores up to and including MaxScore
+type Band struct {
+	Name     string `json:"name"`
+	MaxScore int    `json:"max_score"`
+}
+
+// Rule adds Weight to the score when the fact Field compares to Value with Op.
+// Products, when set, limits the rule to those product codes.
+type Rule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Field       string   `json:"field"`
+	Op          string   `json:"op"` // <, <=, >, >=, ==, !=
+	Value       float64  `json:"value"`
+	Weight      int      `json:"weight"`
+	Products    []string `json:"products,omitempty"`
+}
+
+func (r Rule) matches(facts map[string]float64, productCode string) (float64, bool) {
+	if len(r.Products) > 0 {
+		found := false
+		for _, code := range r.Products {
+			if code == productCode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+
+	value, ok := facts[r.Field]
+	if !ok {
+		return 0, false
+	}
+
+	switch r.Op {
+	case "<":
+		return value, value < r.Value
+	case "<=":
+		return value, value <= r.Value
+	case ">":
+		return value, value > r.Value
+	case ">=":
+		return value, value >= r.Value
+	case "==":
+		return value, value == r.Value
+	case "!=":
+		return value, value != r.Value
+	}
+	return value, false
+}
+
+// Validate checks that the rules and bands are usable
+func (c Config) Validate() error {
+	if c.BaseScore < 0 || c.BaseScore > 100 {
+		return errors.New("base_score must be between 0 and 100")
+	}
+	if c.AutoRejectAbove < 0 || c.AutoRejectAbove > 100 {
+		return errors.New("auto_reject_above must be between 0 and 100")
+	}
+
+	if len(c.Bands) == 0 {
+		return errors.New("at least one band is required")
+	}
+	previous := -1
+	for _, band := range c.Bands {
+		if band.Name == "" {
+			return errors.New("band name is required")
+		}
+		if band.MaxScore <= previous {
+			return fmt.Errorf("band %q: bands must be ordered by increasing max_score", band.Name)
+		}
+		previous = band.MaxScore
+	}
+	if previous < 100 {
+		return errors.New("the last band must reach a max_score of 100")
+	}
+
+	seen := map[string]bool{}
+	for _, rule := range c.Rules {
+		if rule.ID == "" || rule.Field == "" {
+			return errors.New("every rule needs an id and a field")
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		seen[rule.ID] = true
+		switch rule.Op {
+		case "<", "<=", ">", ">=", "==", "!=":
+		default:
+			return fmt.Errorf("rule %q: unknown op %q", rule.ID, rule.Op)
+		}
+	}
+
+	return nil
+}
+
+// RuleScorer is the Scorer backed by a Config
+type RuleScorer struct {
+	config Config
+}
+
+func NewRuleScorer(config Config) (*RuleScorer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &RuleScorer{config: config}, nil
+}
+
+// Score adds the weights of every matching rule to the base score, clamped to 0..100
+func (s *RuleScorer) Score(in Input) Result {
+	facts := in.Facts()
+	result := Result{
+		FiredRules:   []FiredRule{},
+		RulesVersion: s.config.Version,
+	}
+
+	score := s.config.BaseScore
+	for _, rule := range s.config.Rules {
+		value, ok := rule.matches(facts, in.ProductCode)
+		if !ok {
+			continue
+		}
+		score += rule.Weight
+		result.FiredRules = append(result.FiredRules, FiredRule{
+			ID:          rule.ID,
+			Description: rule.Description,
+			Weight:      rule.Weight,
+			Value:       value,
+		})
+	}
+
+	if score < 0 {
+		score = 0
+	}
+	if score > 100 {
+		score = 100
+	}
+	result.Score = score
+
+	for _, band := range s.config.Bands {
+		if score <= band.MaxScore {
+			result.Band = band.Name
+			break
+		}
+	}
+
+	result.AutoReject = s.config.AutoRejectAbove > 0 && score > s.config.AutoRejectAbove
+	return result
+}
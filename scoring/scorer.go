@@ -0,0 +1,130 @@
+// Package scoring computes a risk score for financing requests from configurable weighted rules.
+package scoring
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"sme_fin_backend/money"
+)
+
+//go:embed default_rules.json
+var defaultRules []byte
+
+// Input is what the scorer knows about a financing request and its applicant
+type Input struct {
+	Amount               money.Money
+	RepaymentPeriod      int
+	ProductCode          string
+	ProductMaxAmount     *money.Money // nil for requests without a product
+	RegistrationComplete bool
+	BusinessAgeMonths    *int // nil when the establishment date is unknown
+	PreviousRequests     int  // the applicant's other requests
+	PreviousApproved     int  // approved or disbursed
+	PreviousRejected     int
+	PreviousWithdrawn    int
+	OpenRequests         int // pending or under review
+}
+
+// Facts returns the named values rules can refer to. Booleans are 1 or 0; values that are
+// unknown are left out, so rules on them do not fire.
+func (in Input) Facts() map[string]float64 {
+	facts := map[string]float64{
+		"amount":                majorUnits(in.Amount),
+		"repayment_period":      float64(in.RepaymentPeriod),
+		"registration_complete": boolFact(in.RegistrationComplete),
+		"business_age_known":    boolFact(in.BusinessAgeMonths != nil),
+		"previous_requests":     float64(in.PreviousRequests),
+		"previous_approved":     float64(in.PreviousApproved),
+		"previous_rejected":     float64(in.PreviousRejected),
+		"previous_withdrawn":    float64(in.PreviousWithdrawn),
+		"open_requests":         float64(in.OpenRequests),
+	}
+	if in.BusinessAgeMonths != nil {
+		facts["business_age_months"] = float64(*in.BusinessAgeMonths)
+	}
+	if in.ProductMaxAmount != nil && in.ProductMaxAmount.Minor > 0 {
+		facts["amount_to_product_max"] = float64(in.Amount.Minor) / float64(in.ProductMaxAmount.Minor)
+	}
+	return facts
+}
+
+func majorUnits(m money.Money) float64 {
+	exponent := 2
+	if currency, ok := money.LookupCurrency(m.Currency); ok {
+		exponent = currency.Exponent
+	}
+	return float64(m.Minor) / math.Pow10(exponent)
+}
+
+func boolFact(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// FiredRule explains one rule that contributed to a score
+type FiredRule struct {
+	ID          string  `json:"id"`
+	Description string  `json:"description"`
+	Weight      int     `json:"weight"`
+	Value       float64 `json:"value"` // the fact value that matched
+}
+
+// Result is the outcome of scoring a request. Higher scores mean higher risk.
+type Result struct {
+	Score        int         `json:"score"` // 0 to 100
+	Band         string      `json:"band"`
+	FiredRules   []FiredRule `json:"fired_rules"`
+	RulesVersion string      `json:"rules_version"`
+	AutoReject   bool        `json:"auto_reject"`
+}
+
+// Scorer scores financing requests
+type Scorer interface {
+	Score(in Input) Result
+}
+
+// NewFromEnv loads the rules from SCORING_RULES_FILE, or the built-in defaults when unset.
+// SCORING_AUTO_REJECT_THRESHOLD overrides the file's auto_reject_above (0 disables auto-reject).
+func NewFromEnv() (Scorer, error) {
+	data := defaultRules
+	if path := os.Getenv("SCORING_RULES_FILE"); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("reading scoring rules: %w", err)
+		}
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if value := os.Getenv("SCORING_AUTO_REJECT_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 0 || threshold > 100 {
+			return nil, fmt.Errorf("SCORING_AUTO_REJECT_THRESHOLD must be between 0 and 100")
+		}
+		config.AutoRejectAbove = threshold
+	}
+
+	return NewRuleScorer(config)
+}
+
+// ParseConfig decodes and validates a JSON rules file
+func ParseConfig(data []byte) (Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("parsing scoring rules: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid scoring rules: %w", err)
+	}
+	return config, nil
+}
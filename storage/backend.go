@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sme_fin_backend/utils"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned by Get and Stat when the object does not exist
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrSignedURLUnsupported is returned by SignedURL when the backend cannot hand out
+// download URLs; the object has to be streamed instead
+var ErrSignedURLUnsupported = errors.New("storage: signed URLs are not supported")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Backend stores uploaded and generated files (trade licenses, agreements, ...). Objects
+// are private: callers keep the key and hand out signed URLs for downloads. Keys are object
+// names within the backend's bucket or directory.
+type Backend interface {
+	// Put stores the object. A size of -1 means the length is unknown.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that grants read access to the object until it expires
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+// NewFromEnv builds the backend selected by the STORAGE_BACKEND environment variable.
+// Supported values are "supabase", "s3" and "local". When STORAGE_BACKEND is not set,
+// Supabase is used if SUPABASE_URL is configured, and the local filesystem is only used
+// as a fallback in dev mode.
+func NewFromEnv() (Backend, error) {
+	kind := strings.ToLower(os.Getenv("STORAGE_BACKEND"))
+	if kind == "" {
+		switch {
+		case os.Getenv("SUPABASE_URL") != "":
+			kind = "supabase"
+		case utils.IsDevMode():
+			kind = "local"
+		default:
+			return nil, fmt.Errorf("no storage backend configured: set STORAGE_BACKEND or SUPABASE_URL")
+		}
+	}
+
+	switch kind {
+	case "supabase":
+		return NewSupabaseBackendFromEnv()
+	case "s3":
+		return NewS3BackendFromEnv()
+	case "local":
+		return NewLocalBackendFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", kind)
+	}
+}
+
+// NewObjectKey returns a unique key for a file, keeping the extension of its original name
+func NewObjectKey(filename string) string {
+	return fmt.Sprintf("%s_%d%s", uuid.New().String(), time.Now().Unix(), filepath.Ext(filename))
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// LocalBackend stores objects as files under a directory. It is meant for development
+// and offline testing; it has no signed URLs, so downloads are streamed.
+type LocalBackend struct {
+	Dir string
+}
+
+// NewLocalBackendFromEnv reads LOCAL_STORAGE_DIR (default ./uploads)
+func NewLocalBackendFromEnv() (*LocalBackend, error) {
+	b := &LocalBackend{Dir: os.Getenv("LOCAL_STORAGE_DIR")}
+	if b.Dir == "" {
+		b.Dir = "uploads"
+	}
+	if err := os.MkdirAll(b.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating storage directory: %w", err)
+	}
+	return b, nil
+}
+
+// path maps a key to a file inside the directory; ".." cannot climb out of it
+func (b *LocalBackend) path(key string) string {
+	return filepath.Join(b.Dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put writes the object through a temporary file, so readers never see a partial file
+func (b *LocalBackend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	target := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
+
+// Get opens the object
+func (b *LocalBackend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	f, err := os.Open(b.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, localObjectInfo(key, fi), nil
+}
+
+// Delete removes the object
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(b.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL is not supported; local files are streamed by the API
+func (b *LocalBackend) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", ErrSignedURLUnsupported
+}
+
+// Stat returns the size and type of the object
+func (b *LocalBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	fi, err := os.Stat(b.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return localObjectInfo(key, fi), nil
+}
+
+func localObjectInfo(key string, fi os.FileInfo) *ObjectInfo {
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &ObjectInfo{Key: key, Size: fi.Size(), ContentType: contentType, LastModified: fi.ModTime()}
+}
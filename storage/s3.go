@@ -0,0 +1,417 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unsignedPayload skips hashing request bodies, so uploads can be streamed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3PartSize is the size of multipart upload parts; S3 requires at least 5MB for all but the last
+const s3PartSize = 5 << 20
+
+type s3CompleteUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// S3Backend stores objects in an S3-compatible bucket (AWS S3, MinIO, ...). Requests use
+// path-style URLs and AWS Signature Version 4.
+type S3Backend struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+// NewS3BackendFromEnv reads S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID and
+// S3_SECRET_ACCESS_KEY
+func NewS3BackendFromEnv() (*S3Backend, error) {
+	b := &S3Backend{
+		Endpoint:  strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		Region:    os.Getenv("S3_REGION"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		Client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if b.Region == "" {
+		b.Region = "us-east-1"
+	}
+	if b.Endpoint == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT environment variable is required")
+	}
+	if b.Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET environment variable is required")
+	}
+	if b.AccessKey == "" || b.SecretKey == "" {
+		return nil, fmt.Errorf("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY environment variables are required")
+	}
+	return b, nil
+}
+
+func (b *S3Backend) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(b.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	u.Path = "/" + b.Bucket + "/" + key
+	u.RawPath = "/" + s3Escape(b.Bucket) + "/" + s3Escape(key)
+	return u, nil
+}
+
+func (b *S3Backend) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	u, err := b.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	return req, nil
+}
+
+// Put uploads the object. S3 needs the length of every request body, so a body of unknown
+// size is sent as a multipart upload, holding one part in memory at a time.
+func (b *S3Backend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if size >= 0 {
+		return b.putObject(ctx, key, body, size, contentType)
+	}
+
+	part := make([]byte, s3PartSize)
+	n, err := io.ReadFull(body, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// Small enough for a single request
+		return b.putObject(ctx, key, bytes.NewReader(part[:n]), int64(n), contentType)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	return b.putMultipart(ctx, key, body, part, contentType)
+}
+
+func (b *S3Backend) putObject(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := b.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	b.sign(req, time.Now())
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer resp.Body.Close()
+	return s3StatusError(resp, "upload")
+}
+
+// putMultipart uploads first, a full part already read from body, and the rest of body in
+// parts. A failed upload is aborted so S3 drops the parts already sent.
+func (b *S3Backend) putMultipart(ctx context.Context, key string, body io.Reader, first []byte, contentType string) error {
+	req, err := b.request(ctx, http.MethodPost, key, nil)
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = "uploads="
+	req.Header.Set("Content-Type", contentType)
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := b.doXML(req, "start upload", &created); err != nil {
+		return err
+	}
+
+	var complete s3CompleteUpload
+	err = func() error {
+		part := first
+		for number := 1; ; number++ {
+			etag, err := b.uploadPart(ctx, key, created.UploadID, number, part)
+			if err != nil {
+				return err
+			}
+			complete.Parts = append(complete.Parts, s3CompletedPart{PartNumber: number, ETag: etag})
+
+			n, err := io.ReadFull(body, first)
+			if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				return nil
+			}
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			part = first[:n]
+		}
+	}()
+	if err == nil {
+		err = b.completeMultipart(ctx, key, created.UploadID, &complete)
+	}
+	if err != nil {
+		b.abortMultipart(key, created.UploadID)
+		return err
+	}
+	return nil
+}
+
+func (b *S3Backend) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error) {
+	req, err := b.request(ctx, http.MethodPut, key, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.URL.RawQuery = url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}.Encode()
+	req.ContentLength = int64(len(data))
+	b.sign(req, time.Now())
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := s3StatusError(resp, "upload part"); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (b *S3Backend) completeMultipart(ctx context.Context, key, uploadID string, complete *s3CompleteUpload) error {
+	payload, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	req, err := b.request(ctx, http.MethodPost, key, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = url.Values{"uploadId": {uploadID}}.Encode()
+	req.Header.Set("Content-Type", "application/xml")
+	// S3 can report a failed completion in the body of a 200 response
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := b.doXML(req, "complete upload", &result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("complete upload failed: %s: %s", result.Code, result.Message)
+	}
+	return nil
+}
+
+// abortMultipart discards an unfinished upload. It runs even when the request was cancelled.
+func (b *S3Backend) abortMultipart(key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := b.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return
+	}
+	req.URL.RawQuery = url.Values{"uploadId": {uploadID}}.Encode()
+	b.sign(req, time.Now())
+	if resp, err := b.Client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// doXML signs and sends req and decodes the XML response into v
+func (b *S3Backend) doXML(req *http.Request, action string, v interface{}) error {
+	b.sign(req, time.Now())
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if err := s3StatusError(resp, action); err != nil {
+		return err
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", action, err)
+	}
+	return nil
+}
+
+// Get downloads the object
+func (b *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	req, err := b.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.sign(req, time.Now())
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if err := s3StatusError(resp, "download"); err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	return resp.Body, objectInfoFromHeader(key, resp), nil
+}
+
+// Delete removes the object. S3 answers 204 whether or not it existed.
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	req, err := b.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	b.sign(req, time.Now())
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := s3StatusError(resp, "delete"); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// Stat returns the size and type of the object
+func (b *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	req, err := b.request(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	b.sign(req, time.Now())
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := s3StatusError(resp, "stat"); err != nil {
+		return nil, err
+	}
+	return objectInfoFromHeader(key, resp), nil
+}
+
+// SignedURL returns a presigned GET URL. S3 allows at most seven days.
+func (b *S3Backend) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if expiry <= 0 || expiry > 7*24*time.Hour {
+		return "", fmt.Errorf("signed URL expiry must be between 1s and 7 days")
+	}
+	u, err := b.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := b.scope(amzDate[:8])
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", b.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	signature := b.signature(amzDate, scope, canonicalRequest)
+
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// sign adds SigV4 authorization headers to the request
+func (b *S3Backend) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", unsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + unsignedPayload + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := b.scope(amzDate[:8])
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.AccessKey, scope, signedHeaders, b.signature(amzDate, scope, canonicalRequest)))
+}
+
+func (b *S3Backend) scope(date string) string {
+	return date + "/" + b.Region + "/s3/aws4_request"
+}
+
+func (b *S3Backend) signature(amzDate, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, b.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes a key the way SigV4 expects: everything but unreserved
+// characters and the path separator
+func s3Escape(key string) string {
+	var sb strings.Builder
+	for _, c := range []byte(key) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func s3StatusError(resp *http.Response, action string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("%s failed with status %d: %s", action, resp.StatusCode, string(bodyBytes))
+}
@@ -2,81 +2,185 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/google/uuid"
 )
 
-// UploadFileToSupabase uploads a file to Supabase storage bucket
-func UploadFileToSupabase(file multipart.File, filename string, bucketName string) (string, error) {
-	// Get Supabase credentials from environment
-	supabaseURL := os.Getenv("SUPABASE_URL")
+// SupabaseBackend stores objects in a private Supabase storage bucket
+type SupabaseBackend struct {
+	URL    string // project URL, e.g. https://your-project.supabase.co
+	Key    string // service role key; the anon key only works if storage policies allow it
+	Bucket string
+	Client *http.Client
+}
+
+// NewSupabaseBackendFromEnv reads SUPABASE_URL, SUPABASE_SERVICE_ROLE_KEY (or SUPABASE_ANON_KEY)
+// and SUPABASE_BUCKET_NAME
+func NewSupabaseBackendFromEnv() (*SupabaseBackend, error) {
+	b := &SupabaseBackend{
+		URL:    strings.TrimRight(os.Getenv("SUPABASE_URL"), "/"),
+		Key:    os.Getenv("SUPABASE_SERVICE_ROLE_KEY"),
+		Bucket: os.Getenv("SUPABASE_BUCKET_NAME"),
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
 	// Try service role key first (for server-side uploads), fallback to anon key
-	supabaseKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	if supabaseKey == "" {
-		supabaseKey = os.Getenv("SUPABASE_ANON_KEY")
+	if b.Key == "" {
+		b.Key = os.Getenv("SUPABASE_ANON_KEY")
+	}
+	if b.Bucket == "" {
+		b.Bucket = "vercel_bucket" // Default bucket name
 	}
 
-	if supabaseURL == "" {
-		return "", fmt.Errorf("SUPABASE_URL environment variable is required")
+	if b.URL == "" {
+		return nil, fmt.Errorf("SUPABASE_URL environment variable is required")
 	}
-	if supabaseKey == "" {
-		return "", fmt.Errorf("SUPABASE_SERVICE_ROLE_KEY or SUPABASE_ANON_KEY environment variable is required")
+	if b.Key == "" {
+		return nil, fmt.Errorf("SUPABASE_SERVICE_ROLE_KEY or SUPABASE_ANON_KEY environment variable is required")
 	}
+	return b, nil
+}
 
-	// Generate unique filename
-	ext := filepath.Ext(filename)
-	uniqueFilename := fmt.Sprintf("%s_%d%s", uuid.New().String(), time.Now().Unix(), ext)
+func (b *SupabaseBackend) objectURL(kind, key string) string {
+	if kind != "" {
+		kind += "/"
+	}
+	return fmt.Sprintf("%s/storage/v1/object/%s%s/%s", b.URL, kind, b.Bucket, key)
+}
 
-	// Read file content
-	fileBytes, err := io.ReadAll(file)
+func (b *SupabaseBackend) do(ctx context.Context, method, url string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Authorization", "Bearer "+b.Key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return b.Client.Do(req)
+}
 
-	// Create the upload URL
-	uploadURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", supabaseURL, bucketName, uniqueFilename)
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(fileBytes))
+// Put uploads the object. Bodies of unknown size are streamed with chunked transfer encoding.
+func (b *SupabaseBackend) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.objectURL("", key), body)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
-
-	// Set headers
-	req.Header.Set("Authorization", "Bearer "+supabaseKey)
-	req.Header.Set("Content-Type", "application/octet-stream")
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	req.Header.Set("Authorization", "Bearer "+b.Key)
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("x-upsert", "true") // Allow overwriting
 
-	// Make the request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := b.Client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
+		return fmt.Errorf("failed to upload file: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// Get downloads the object
+func (b *SupabaseBackend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.objectURL("authenticated", key), nil, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if err := supabaseStatusError(resp, "download"); err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	return resp.Body, objectInfoFromHeader(key, resp), nil
+}
+
+// Delete removes the object
+func (b *SupabaseBackend) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, b.objectURL("", key), nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := supabaseStatusError(resp, "delete"); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// SignedURL asks Supabase for a URL that expires after the given duration
+func (b *SupabaseBackend) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	payload, err := json.Marshal(map[string]int{"expiresIn": int(expiry.Seconds())})
+	if err != nil {
+		return "", err
+	}
+	resp, err := b.do(ctx, http.MethodPost, b.objectURL("sign", key), bytes.NewReader(payload), "application/json")
+	if err != nil {
+		return "", fmt.Errorf("failed to sign URL: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := supabaseStatusError(resp, "sign"); err != nil {
+		return "", err
 	}
 
-	// Return the public URL
-	publicURL := fmt.Sprintf("%s/storage/v1/object/public/%s/%s", supabaseURL, bucketName, uniqueFilename)
-	return publicURL, nil
+	var signed struct {
+		SignedURL string `json:"signedURL"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return "", fmt.Errorf("failed to decode signed URL: %w", err)
+	}
+	// The returned path is relative to the storage API
+	return b.URL + "/storage/v1" + signed.SignedURL, nil
 }
 
-// GetSupabasePublicURL generates the public URL for a file in Supabase storage
-func GetSupabasePublicURL(filename string, bucketName string) string {
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	if supabaseURL == "" {
-		return ""
+// Stat returns the size and type of the object
+func (b *SupabaseBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, b.objectURL("authenticated", key), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := supabaseStatusError(resp, "stat"); err != nil {
+		return nil, err
+	}
+	return objectInfoFromHeader(key, resp), nil
+}
+
+// supabaseStatusError turns a failed response into an error. Supabase reports missing
+// objects as 404, or as 400 with a "not_found" error body.
+func supabaseStatusError(resp *http.Response, action string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound ||
+		(resp.StatusCode == http.StatusBadRequest && strings.Contains(string(bodyBytes), "not_found")) {
+		return ErrNotFound
+	}
+	return fmt.Errorf("%s failed with status %d: %s", action, resp.StatusCode, string(bodyBytes))
+}
+
+// objectInfoFromHeader reads object metadata from a GET or HEAD response
+func objectInfoFromHeader(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{Key: key, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if info.Size < 0 {
+		if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+			info.Size = size
+		}
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = modified
 	}
-	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", supabaseURL, bucketName, filename)
+	return info
 }
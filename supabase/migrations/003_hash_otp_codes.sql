@@ -0,0 +1,5 @@
+-- OTP codes are now stored as SHA-256/HMAC hex digests instead of plain text
+ALTER TABLE otp_verifications ALTER COLUMN otp TYPE VARCHAR(64);
+
+-- Plain-text codes issued before this migration can no longer be verified
+UPDATE otp_verifications SET verified = true WHERE verified = false;
@@ -0,0 +1,14 @@
+-- Verification attempts used for per-email and per-IP brute-force protection
+CREATE TABLE IF NOT EXISTS otp_attempts (
+    id UUID PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    success BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_attempts_email_created_at ON otp_attempts (email, created_at);
+CREATE INDEX IF NOT EXISTS idx_otp_attempts_ip_created_at ON otp_attempts (ip_address, created_at);
+
+-- Resend cooldown and daily caps look up OTPs by email and creation time
+CREATE INDEX IF NOT EXISTS idx_otp_verifications_email_created_at ON otp_verifications (email, created_at);
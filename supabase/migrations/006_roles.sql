@@ -0,0 +1,16 @@
+-- Roles for role-based access control
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(32) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('sme', 'Small business applicant'),
+    ('underwriter', 'Reviews and decides financing requests'),
+    ('admin', 'Back-office administrator')
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'sme' REFERENCES roles(name);
+
+-- Promote the first administrator manually, e.g.:
+-- UPDATE users SET role = 'admin' WHERE email = 'ops@example.com';
@@ -0,0 +1,6 @@
+-- Back-office decisions on financing requests
+ALTER TABLE financing_requests ADD COLUMN IF NOT EXISTS decision_reason TEXT;
+ALTER TABLE financing_requests ADD COLUMN IF NOT EXISTS decided_by UUID REFERENCES users(id);
+ALTER TABLE financing_requests ADD COLUMN IF NOT EXISTS decided_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_financing_requests_status_created_at ON financing_requests (status, created_at);
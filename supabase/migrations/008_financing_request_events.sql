@@ -0,0 +1,23 @@
+-- Status history of financing requests
+CREATE TABLE IF NOT EXISTS financing_request_events (
+    id UUID PRIMARY KEY,
+    financing_request_id UUID NOT NULL REFERENCES financing_requests(id) ON DELETE CASCADE,
+    from_status VARCHAR(32),
+    to_status VARCHAR(32) NOT NULL,
+    actor_id UUID REFERENCES users(id),
+    reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_financing_request_events_request_id ON financing_request_events (financing_request_id, created_at);
+
+-- Only statuses known to the state machine may be stored
+ALTER TABLE financing_requests DROP CONSTRAINT IF EXISTS financing_requests_status_check;
+ALTER TABLE financing_requests ADD CONSTRAINT financing_requests_status_check
+    CHECK (status IN ('pending', 'under_review', 'approved', 'rejected', 'disbursed', 'withdrawn'));
+
+-- Seed the history of existing requests with their submission
+INSERT INTO financing_request_events (id, financing_request_id, from_status, to_status, actor_id, created_at)
+SELECT gen_random_uuid(), fr.id, NULL, 'pending', fr.user_id, fr.created_at
+FROM financing_requests fr
+WHERE NOT EXISTS (SELECT 1 FROM financing_request_events e WHERE e.financing_request_id = fr.id);
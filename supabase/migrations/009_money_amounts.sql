@@ -0,0 +1,10 @@
+-- Store financing amounts exactly, as integer minor units plus an ISO 4217 currency code
+ALTER TABLE financing_requests ADD COLUMN IF NOT EXISTS amount_minor BIGINT;
+ALTER TABLE financing_requests ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'AED';
+
+-- Existing amounts were AED in major units
+UPDATE financing_requests SET amount_minor = ROUND(amount * 100)::BIGINT WHERE amount_minor IS NULL;
+
+ALTER TABLE financing_requests ALTER COLUMN amount_minor SET NOT NULL;
+ALTER TABLE financing_requests ADD CONSTRAINT financing_requests_amount_minor_positive CHECK (amount_minor > 0);
+ALTER TABLE financing_requests DROP COLUMN IF EXISTS amount;
@@ -0,0 +1,32 @@
+-- Repayment schedule fixed when a financing request is approved
+CREATE TABLE IF NOT EXISTS repayment_schedules (
+    financing_request_id UUID PRIMARY KEY REFERENCES financing_requests(id) ON DELETE CASCADE,
+    currency CHAR(3) NOT NULL,
+    principal_minor BIGINT NOT NULL CHECK (principal_minor > 0),
+    months INTEGER NOT NULL CHECK (months > 0),
+    annual_rate_bps INTEGER NOT NULL CHECK (annual_rate_bps >= 0),
+    method VARCHAR(20) NOT NULL CHECK (method IN ('flat', 'reducing_balance')),
+    processing_fee_bps INTEGER NOT NULL DEFAULT 0 CHECK (processing_fee_bps >= 0),
+    total_interest_minor BIGINT NOT NULL,
+    total_fees_minor BIGINT NOT NULL,
+    total_payable_minor BIGINT NOT NULL,
+    start_date DATE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS repayment_installments (
+    id UUID PRIMARY KEY,
+    financing_request_id UUID NOT NULL REFERENCES repayment_schedules(financing_request_id) ON DELETE CASCADE,
+    installment_number INTEGER NOT NULL,
+    due_date DATE NOT NULL,
+    principal_minor BIGINT NOT NULL,
+    interest_minor BIGINT NOT NULL,
+    fee_minor BIGINT NOT NULL DEFAULT 0,
+    payment_minor BIGINT NOT NULL,
+    balance_minor BIGINT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (financing_request_id, installment_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_repayment_installments_due_date ON repayment_installments (due_date, status);
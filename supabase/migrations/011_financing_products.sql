@@ -0,0 +1,39 @@
+-- Financing products and their eligibility rules
+CREATE TABLE IF NOT EXISTS financing_products (
+    id UUID PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    currency CHAR(3) NOT NULL,
+    min_amount_minor BIGINT NOT NULL CHECK (min_amount_minor > 0),
+    max_amount_minor BIGINT NOT NULL,
+    tenors INTEGER[] NOT NULL,
+    annual_rate_bps INTEGER NOT NULL CHECK (annual_rate_bps >= 0),
+    rate_method VARCHAR(20) NOT NULL CHECK (rate_method IN ('flat', 'reducing_balance')),
+    processing_fee_bps INTEGER NOT NULL DEFAULT 0 CHECK (processing_fee_bps >= 0),
+    min_business_age_months INTEGER NOT NULL DEFAULT 0,
+    required_documents TEXT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (max_amount_minor >= min_amount_minor),
+    CHECK (cardinality(tenors) > 0)
+);
+
+INSERT INTO financing_products (id, code, name, description, currency, min_amount_minor, max_amount_minor, tenors,
+                                annual_rate_bps, rate_method, processing_fee_bps, min_business_age_months, required_documents)
+VALUES
+    (gen_random_uuid(), 'working_capital', 'Working Capital', 'Short-term financing for day-to-day operations and inventory',
+     'AED', 1000000, 50000000, '{3,6,9,12}', 1400, 'reducing_balance', 150, 12, '{trade_license}'),
+    (gen_random_uuid(), 'invoice_discounting', 'Invoice Discounting', 'Advance against unpaid customer invoices',
+     'AED', 2500000, 200000000, '{1,2,3,4,6}', 1200, 'flat', 100, 6, '{trade_license}'),
+    (gen_random_uuid(), 'equipment_loan', 'Equipment Loan', 'Financing for machinery, vehicles and equipment',
+     'AED', 5000000, 500000000, '{12,24,36,48,60}', 1000, 'reducing_balance', 200, 24, '{trade_license}')
+ON CONFLICT (code) DO NOTHING;
+
+-- Requests made before the catalog existed have no product
+ALTER TABLE financing_requests ADD COLUMN IF NOT EXISTS product_id UUID REFERENCES financing_products(id);
+CREATE INDEX IF NOT EXISTS idx_financing_requests_product_id ON financing_requests (product_id);
+
+-- Used for the business age rule
+ALTER TABLE business_details ADD COLUMN IF NOT EXISTS established_on DATE;
@@ -0,0 +1,13 @@
+-- Credit scores computed when a financing request is submitted or edited
+CREATE TABLE IF NOT EXISTS financing_request_scores (
+    id UUID PRIMARY KEY,
+    financing_request_id UUID NOT NULL REFERENCES financing_requests(id) ON DELETE CASCADE,
+    score INTEGER NOT NULL CHECK (score BETWEEN 0 AND 100),
+    band VARCHAR(32) NOT NULL,
+    fired_rules JSONB NOT NULL DEFAULT '[]',
+    rules_version VARCHAR(100) NOT NULL DEFAULT '',
+    auto_rejected BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_financing_request_scores_request_id ON financing_request_scores (financing_request_id, created_at DESC);
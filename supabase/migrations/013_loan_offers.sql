@@ -0,0 +1,25 @@
+-- Offers issued by underwriters on financing requests under review
+CREATE TABLE IF NOT EXISTS loan_offers (
+    id UUID PRIMARY KEY,
+    financing_request_id UUID NOT NULL REFERENCES financing_requests(id) ON DELETE CASCADE,
+    amount_minor BIGINT NOT NULL CHECK (amount_minor > 0),
+    currency CHAR(3) NOT NULL,
+    repayment_period INTEGER NOT NULL CHECK (repayment_period > 0),
+    annual_rate_bps INTEGER NOT NULL CHECK (annual_rate_bps >= 0),
+    rate_method VARCHAR(20) NOT NULL CHECK (rate_method IN ('flat', 'reducing_balance')),
+    processing_fee_bps INTEGER NOT NULL DEFAULT 0 CHECK (processing_fee_bps >= 0),
+    note TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'accepted', 'declined', 'expired', 'superseded')),
+    expires_at TIMESTAMPTZ NOT NULL,
+    issued_by UUID NOT NULL REFERENCES users(id),
+    responded_at TIMESTAMPTZ,
+    response_reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_loan_offers_request_id ON loan_offers (financing_request_id, created_at DESC);
+
+-- At most one open offer per request
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loan_offers_one_pending ON loan_offers (financing_request_id) WHERE status = 'pending';
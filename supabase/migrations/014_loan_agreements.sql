@@ -0,0 +1,20 @@
+-- Loan agreements generated for approved financing requests and their click-to-sign acceptance
+CREATE TABLE IF NOT EXISTS loan_agreements (
+    id UUID PRIMARY KEY,
+    financing_request_id UUID NOT NULL UNIQUE REFERENCES financing_requests(id) ON DELETE CASCADE,
+    offer_id UUID REFERENCES loan_offers(id),
+    agreement_number VARCHAR(50) NOT NULL,
+    template VARCHAR(255) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    file_url TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    signed_at TIMESTAMPTZ,
+    signed_by UUID REFERENCES users(id),
+    signer_ip VARCHAR(64),
+    signer_user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- A signature is only valid with all of its evidence
+    CHECK ((signed_at IS NULL) = (signed_by IS NULL)),
+    CHECK (signed_at IS NULL OR signer_ip IS NOT NULL)
+);
@@ -0,0 +1,125 @@
+-- Double-entry ledger for disbursed financing requests.
+-- Postings are signed: debits are positive, credits negative. Every journal entry must
+-- balance to zero, and the ledger is append-only (mistakes are corrected with new entries).
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id UUID PRIMARY KEY,
+    code VARCHAR(40) NOT NULL,
+    type VARCHAR(10) NOT NULL CHECK (type IN ('asset', 'liability', 'income', 'expense')),
+    -- Receivables are kept per financing request; cash, income and losses are shared
+    financing_request_id UUID REFERENCES financing_requests(id),
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ledger_accounts_shared ON ledger_accounts (code, currency) WHERE financing_request_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ledger_accounts_request ON ledger_accounts (code, financing_request_id) WHERE financing_request_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id UUID PRIMARY KEY,
+    financing_request_id UUID REFERENCES financing_requests(id),
+    entry_type VARCHAR(20) NOT NULL
+        CHECK (entry_type IN ('disbursement', 'installment_due', 'repayment', 'fee', 'write_off')),
+    currency CHAR(3) NOT NULL,
+    description TEXT,
+    reference VARCHAR(100),
+    installment_id UUID REFERENCES repayment_installments(id),
+    effective_date DATE NOT NULL,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_journal_entries_request_id ON journal_entries (financing_request_id, effective_date, created_at);
+
+-- An installment falls due once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_journal_entries_installment_due ON journal_entries (installment_id) WHERE entry_type = 'installment_due';
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id UUID PRIMARY KEY,
+    journal_entry_id UUID NOT NULL REFERENCES journal_entries(id),
+    account_id UUID NOT NULL REFERENCES ledger_accounts(id),
+    amount_minor BIGINT NOT NULL CHECK (amount_minor <> 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry_id ON ledger_postings (journal_entry_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_account_id ON ledger_postings (account_id);
+
+-- Checked at commit, so the postings of an entry can be inserted one by one
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS TRIGGER AS $$
+DECLARE
+    entry_id UUID;
+    posting_count INTEGER;
+    total BIGINT;
+    mismatched INTEGER;
+BEGIN
+    IF TG_TABLE_NAME = 'journal_entries' THEN
+        entry_id := NEW.id;
+    ELSE
+        entry_id := COALESCE(NEW.journal_entry_id, OLD.journal_entry_id);
+    END IF;
+
+    SELECT COUNT(*), COALESCE(SUM(p.amount_minor), 0), COUNT(*) FILTER (WHERE a.currency <> e.currency)
+    INTO posting_count, total, mismatched
+    FROM journal_entries e
+    JOIN ledger_postings p ON p.journal_entry_id = e.id
+    JOIN ledger_accounts a ON a.id = p.account_id
+    WHERE e.id = entry_id;
+
+    IF posting_count < 2 THEN
+        RAISE EXCEPTION 'journal entry % needs at least two postings', entry_id;
+    END IF;
+    IF total <> 0 THEN
+        RAISE EXCEPTION 'journal entry % does not balance (off by %)', entry_id, total;
+    END IF;
+    IF mismatched > 0 THEN
+        RAISE EXCEPTION 'journal entry % posts to accounts in another currency', entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS journal_entries_balanced ON journal_entries;
+CREATE CONSTRAINT TRIGGER journal_entries_balanced
+    AFTER INSERT ON journal_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+DROP TRIGGER IF EXISTS ledger_postings_balanced ON ledger_postings;
+CREATE CONSTRAINT TRIGGER ledger_postings_balanced
+    AFTER INSERT ON ledger_postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+CREATE OR REPLACE FUNCTION reject_ledger_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'the ledger is append-only; post a correcting entry instead';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS journal_entries_append_only ON journal_entries;
+CREATE TRIGGER journal_entries_append_only
+    BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION reject_ledger_change();
+
+DROP TRIGGER IF EXISTS ledger_postings_append_only ON ledger_postings;
+CREATE TRIGGER ledger_postings_append_only
+    BEFORE UPDATE OR DELETE ON ledger_postings
+    FOR EACH ROW EXECUTE FUNCTION reject_ledger_change();
+
+CREATE OR REPLACE VIEW ledger_account_balances AS
+SELECT a.id AS account_id, a.code, a.type, a.financing_request_id, a.currency,
+       COALESCE(SUM(p.amount_minor), 0) AS balance_minor
+FROM ledger_accounts a
+LEFT JOIN ledger_postings p ON p.account_id = a.id
+GROUP BY a.id;
+
+-- Repayments received against each installment
+ALTER TABLE repayment_installments ADD COLUMN IF NOT EXISTS paid_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE repayment_installments ADD COLUMN IF NOT EXISTS paid_at TIMESTAMPTZ;
+
+ALTER TABLE repayment_installments DROP CONSTRAINT IF EXISTS repayment_installments_status_check;
+ALTER TABLE repayment_installments ADD CONSTRAINT repayment_installments_status_check
+    CHECK (status IN ('scheduled', 'partially_paid', 'paid', 'written_off'));
+ALTER TABLE repayment_installments DROP CONSTRAINT IF EXISTS repayment_installments_paid_check;
+ALTER TABLE repayment_installments ADD CONSTRAINT repayment_installments_paid_check
+    CHECK (paid_minor >= 0 AND paid_minor <= payment_minor);
@@ -0,0 +1,47 @@
+-- Overdue installments, late fees and the collections queue
+
+ALTER TABLE repayment_installments DROP CONSTRAINT IF EXISTS repayment_installments_status_check;
+ALTER TABLE repayment_installments ADD CONSTRAINT repayment_installments_status_check
+    CHECK (status IN ('scheduled', 'partially_paid', 'paid', 'overdue', 'written_off'));
+ALTER TABLE repayment_installments ADD COLUMN IF NOT EXISTS overdue_at TIMESTAMPTZ;
+
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS journal_entries_entry_type_check;
+ALTER TABLE journal_entries ADD CONSTRAINT journal_entries_entry_type_check
+    CHECK (entry_type IN ('disbursement', 'installment_due', 'repayment', 'fee', 'late_fee', 'write_off'));
+
+-- An installment is charged one late fee
+CREATE UNIQUE INDEX IF NOT EXISTS idx_journal_entries_late_fee ON journal_entries (installment_id) WHERE entry_type = 'late_fee';
+
+CREATE TABLE IF NOT EXISTS collection_cases (
+    id UUID PRIMARY KEY,
+    financing_request_id UUID NOT NULL REFERENCES financing_requests(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'promise_to_pay', 'resolved')),
+    currency CHAR(3) NOT NULL,
+    overdue_minor BIGINT NOT NULL DEFAULT 0,
+    overdue_installments INTEGER NOT NULL DEFAULT 0,
+    days_past_due INTEGER NOT NULL DEFAULT 0,
+    assigned_to UUID REFERENCES users(id),
+    promised_amount_minor BIGINT CHECK (promised_amount_minor > 0),
+    promised_date DATE,
+    opened_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((status = 'promise_to_pay') = (promised_date IS NOT NULL)),
+    CHECK ((status = 'resolved') = (resolved_at IS NOT NULL))
+);
+
+-- At most one case is worked per loan at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_collection_cases_one_active ON collection_cases (financing_request_id) WHERE status <> 'resolved';
+CREATE INDEX IF NOT EXISTS idx_collection_cases_queue ON collection_cases (status, days_past_due DESC);
+
+CREATE TABLE IF NOT EXISTS collection_notes (
+    id UUID PRIMARY KEY,
+    case_id UUID NOT NULL REFERENCES collection_cases(id) ON DELETE CASCADE,
+    author_id UUID REFERENCES users(id), -- NULL for notes written by the daily job
+    note TEXT NOT NULL,
+    promised_amount_minor BIGINT,
+    promised_date DATE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_collection_notes_case_id ON collection_notes (case_id, created_at);
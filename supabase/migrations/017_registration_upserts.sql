@@ -0,0 +1,14 @@
+-- Registration tables hold one row per user, which INSERT ... ON CONFLICT (user_id) relies on.
+-- Duplicates left by the former select-then-write code are removed first, keeping the latest row.
+
+DELETE FROM personal_details a USING personal_details b
+WHERE a.user_id = b.user_id AND (a.updated_at, a.id) < (b.updated_at, b.id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_details_user_id ON personal_details (user_id);
+
+DELETE FROM business_details a USING business_details b
+WHERE a.user_id = b.user_id AND (a.updated_at, a.id) < (b.updated_at, b.id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_business_details_user_id ON business_details (user_id);
+
+DELETE FROM trade_licenses a USING trade_licenses b
+WHERE a.user_id = b.user_id AND (a.updated_at, a.id) < (b.updated_at, b.id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trade_licenses_user_id ON trade_licenses (user_id);
@@ -0,0 +1,10 @@
+-- Unfinished onboarding steps. A draft holds the fields entered so far for one step and is
+-- removed once the step is complete and saved to its own table.
+
+CREATE TABLE IF NOT EXISTS registration_drafts (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    step VARCHAR(20) NOT NULL CHECK (step IN ('personal', 'business', 'trade_license')),
+    fields JSONB NOT NULL DEFAULT '{}'::jsonb,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, step)
+);
@@ -0,0 +1,26 @@
+-- Documents are kept in a private bucket. Rows store the object key and downloads go through
+-- /api/user/documents/{id}/download, which hands out short-lived signed URLs. file_url is
+-- only kept for documents registered by URL instead of uploaded.
+
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS object_key TEXT;
+ALTER TABLE trade_licenses ALTER COLUMN file_url DROP NOT NULL;
+
+ALTER TABLE loan_agreements ADD COLUMN IF NOT EXISTS object_key TEXT;
+ALTER TABLE loan_agreements ALTER COLUMN file_url DROP NOT NULL;
+
+-- Earlier uploads were recorded by their public URL: keep only the object key
+UPDATE trade_licenses
+SET object_key = regexp_replace(file_url, '^.*/storage/v1/object/public/[^/]+/', ''), file_url = NULL
+WHERE object_key IS NULL AND file_url ~ '/storage/v1/object/public/[^/]+/';
+
+UPDATE loan_agreements
+SET object_key = regexp_replace(file_url, '^.*/storage/v1/object/public/[^/]+/', ''), file_url = NULL
+WHERE object_key IS NULL AND file_url ~ '/storage/v1/object/public/[^/]+/';
+
+ALTER TABLE trade_licenses DROP CONSTRAINT IF EXISTS trade_licenses_file_check;
+ALTER TABLE trade_licenses ADD CONSTRAINT trade_licenses_file_check
+    CHECK (object_key IS NOT NULL OR file_url IS NOT NULL);
+
+ALTER TABLE loan_agreements DROP CONSTRAINT IF EXISTS loan_agreements_file_check;
+ALTER TABLE loan_agreements ADD CONSTRAINT loan_agreements_file_check
+    CHECK (object_key IS NOT NULL OR file_url IS NOT NULL);
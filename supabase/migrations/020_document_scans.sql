@@ -0,0 +1,13 @@
+-- Malware scan state of uploaded trade licenses. Uploads sit in quarantine ('pending') until
+-- a scan finds them clean; infected files are deleted from storage and the row kept as a record.
+-- Licenses registered by URL are not held by us and have no scan state.
+
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20)
+    CHECK (scan_status IN ('pending', 'clean', 'infected'));
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS scan_signature TEXT;
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMPTZ;
+
+-- Files uploaded before scanning existed are scanned by the next daily job
+UPDATE trade_licenses SET scan_status = 'pending' WHERE object_key IS NOT NULL AND scan_status IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_trade_licenses_scan_pending ON trade_licenses (updated_at) WHERE scan_status = 'pending';
@@ -0,0 +1,5 @@
+-- Size and SHA-256 digest of uploaded trade licenses, computed while the file streams to storage.
+-- Files uploaded earlier, and licenses registered by URL, have neither.
+
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS file_size BIGINT CHECK (file_size >= 0);
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS sha256 CHAR(64);
@@ -0,0 +1,35 @@
+-- Resumable uploads (tus 1.0). Each PATCH request is stored as its own chunk object, so a
+-- dropped connection only loses the request in flight. Once every byte has arrived the chunks
+-- are assembled into the document and deleted. Abandoned uploads expire and are cleaned up by
+-- the daily job.
+
+CREATE TABLE IF NOT EXISTS resumable_uploads (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    document_type VARCHAR(30) NOT NULL CHECK (document_type IN ('trade_license')),
+    filename TEXT NOT NULL,
+    upload_length BIGINT NOT NULL CHECK (upload_length > 0),
+    upload_offset BIGINT NOT NULL DEFAULT 0 CHECK (upload_offset >= 0 AND upload_offset <= upload_length),
+    status VARCHAR(20) NOT NULL DEFAULT 'uploading'
+        CHECK (status IN ('uploading', 'assembling', 'completed', 'failed', 'expired')),
+    error TEXT,
+    document_id UUID,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_resumable_uploads_user_id ON resumable_uploads (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_resumable_uploads_expiry ON resumable_uploads (expires_at)
+    WHERE status IN ('uploading', 'assembling');
+
+-- The chunks received so far, in offset order. A chunk covers
+-- [chunk_offset, chunk_offset + size) of the file.
+CREATE TABLE IF NOT EXISTS resumable_upload_chunks (
+    upload_id UUID NOT NULL REFERENCES resumable_uploads(id) ON DELETE CASCADE,
+    chunk_offset BIGINT NOT NULL CHECK (chunk_offset >= 0),
+    size BIGINT NOT NULL CHECK (size > 0),
+    object_key TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (upload_id, chunk_offset)
+);
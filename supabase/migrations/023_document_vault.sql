@@ -0,0 +1,44 @@
+-- Document vault: the KYC/KYB documents of a business besides its trade license, which stays a
+-- registration step. Every upload of a type is a new version; the latest one is current.
+-- Back-office staff review each version, and documents with an expiry date stop counting
+-- once it has passed.
+
+CREATE TABLE IF NOT EXISTS documents (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    document_type VARCHAR(40) NOT NULL
+        CHECK (document_type IN ('emirates_id', 'passport', 'memorandum_of_association', 'vat_certificate', 'bank_statement')),
+    version INTEGER NOT NULL CHECK (version > 0),
+    filename TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    file_size BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    scan_status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (scan_status IN ('pending', 'clean', 'infected')),
+    scan_signature TEXT,
+    scanned_at TIMESTAMPTZ,
+    expires_on DATE,
+    review_status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (review_status IN ('pending', 'approved', 'rejected')),
+    review_note TEXT,
+    reviewed_by UUID REFERENCES users(id),
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, document_type, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_documents_review_queue ON documents (created_at) WHERE review_status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_documents_pending_scan ON documents (created_at) WHERE scan_status = 'pending';
+
+-- Product checklists. "identity" is met by an Emirates ID or a passport.
+UPDATE financing_products SET required_documents = '{trade_license,identity,bank_statement}'
+WHERE code = 'working_capital' AND required_documents = '{trade_license}';
+UPDATE financing_products SET required_documents = '{trade_license,identity,vat_certificate,bank_statement}'
+WHERE code = 'invoice_discounting' AND required_documents = '{trade_license}';
+UPDATE financing_products SET required_documents = '{trade_license,identity,memorandum_of_association,bank_statement}'
+WHERE code = 'equipment_loan' AND required_documents = '{trade_license}';
+
+-- Vault documents can be sent as resumable uploads too
+ALTER TABLE resumable_uploads DROP CONSTRAINT IF EXISTS resumable_uploads_document_type_check;
+ALTER TABLE resumable_uploads ADD CONSTRAINT resumable_uploads_document_type_check
+    CHECK (document_type IN ('trade_license', 'emirates_id', 'passport', 'memorandum_of_association', 'vat_certificate', 'bank_statement'));
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS document_expires_on DATE;
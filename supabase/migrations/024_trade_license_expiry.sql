@@ -0,0 +1,16 @@
+-- Trade license validity. Licenses are renewed yearly; the daily job flags the ones about to
+-- expire or expired and reminds their owners. Licenses saved earlier have no dates until the
+-- step is saved again.
+
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS issued_on DATE;
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS expires_on DATE;
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS issuing_authority VARCHAR(255);
+
+-- Set by the daily job once the license expires within 30 days; cleared when the expiry date
+-- changes
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS expiry_status VARCHAR(20)
+    CHECK (expiry_status IN ('expiring', 'expired'));
+-- The last reminder sent for the current expiry date, in days before it (30, 7 or 0)
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS expiry_reminder_days INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_trade_licenses_expires_on ON trade_licenses (expires_on) WHERE expires_on IS NOT NULL;
@@ -0,0 +1,21 @@
+-- What each installment's repayments paid off, per component. Repayments settle fees, then
+-- interest, then principal, and interest and fees can only be paid once they fall due, so a
+-- prepayment goes to principal as it does in the ledger.
+
+ALTER TABLE repayment_installments ADD COLUMN IF NOT EXISTS fee_paid_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE repayment_installments ADD COLUMN IF NOT EXISTS interest_paid_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE repayment_installments ADD COLUMN IF NOT EXISTS principal_paid_minor BIGINT NOT NULL DEFAULT 0;
+
+-- Earlier repayments were applied to whole installments; split them in the same order
+UPDATE repayment_installments
+SET fee_paid_minor = LEAST(paid_minor, fee_minor),
+    interest_paid_minor = LEAST(GREATEST(paid_minor - fee_minor, 0), interest_minor),
+    principal_paid_minor = GREATEST(paid_minor - fee_minor - interest_minor, 0)
+WHERE paid_minor > 0 AND fee_paid_minor + interest_paid_minor + principal_paid_minor = 0;
+
+ALTER TABLE repayment_installments DROP CONSTRAINT IF EXISTS repayment_installments_allocation_check;
+ALTER TABLE repayment_installments ADD CONSTRAINT repayment_installments_allocation_check
+    CHECK (fee_paid_minor BETWEEN 0 AND fee_minor
+       AND interest_paid_minor BETWEEN 0 AND interest_minor
+       AND principal_paid_minor BETWEEN 0 AND principal_minor
+       AND fee_paid_minor + interest_paid_minor + principal_paid_minor = paid_minor);
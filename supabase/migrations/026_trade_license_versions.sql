@@ -0,0 +1,40 @@
+-- Trade licenses are versioned documents too. Every file saved for the trade license step is a
+-- new version in documents, reviewed like the other documents; the step points at the current
+-- version and keeps the license details. A license registered by URL has no stored file, so
+-- it is not scanned.
+
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_document_type_check;
+ALTER TABLE documents ADD CONSTRAINT documents_document_type_check
+    CHECK (document_type IN ('trade_license', 'emirates_id', 'passport', 'memorandum_of_association', 'vat_certificate', 'bank_statement'));
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_url TEXT;
+ALTER TABLE documents ALTER COLUMN object_key DROP NOT NULL;
+ALTER TABLE documents ALTER COLUMN file_size DROP NOT NULL;
+ALTER TABLE documents ALTER COLUMN sha256 DROP NOT NULL;
+ALTER TABLE documents ALTER COLUMN scan_status DROP NOT NULL;
+ALTER TABLE documents ALTER COLUMN scan_status DROP DEFAULT;
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_file_check;
+ALTER TABLE documents ADD CONSTRAINT documents_file_check
+    CHECK ((object_key IS NULL) <> (file_url IS NULL) AND (object_key IS NULL) = (scan_status IS NULL));
+
+ALTER TABLE trade_licenses ADD COLUMN IF NOT EXISTS document_id UUID REFERENCES documents(id);
+
+-- The license on file becomes version 1, under the same ID so its download URL keeps working.
+INSERT INTO documents (id, user_id, document_type, version, filename, object_key, file_url, file_size, sha256,
+    scan_status, scan_signature, scanned_at, expires_on, review_status, created_at, updated_at)
+SELECT id, user_id, 'trade_license', 1, filename, object_key, CASE WHEN object_key IS NULL THEN file_url END,
+    file_size, sha256, CASE WHEN object_key IS NOT NULL THEN COALESCE(scan_status, 'pending') END, scan_signature,
+    scanned_at, expires_on, 'pending', created_at, updated_at
+FROM trade_licenses WHERE document_id IS NULL
+ON CONFLICT (id) DO NOTHING;
+UPDATE trade_licenses SET document_id = id WHERE document_id IS NULL;
+
+ALTER TABLE trade_licenses ALTER COLUMN document_id SET NOT NULL;
+
+-- The file, its scan and its review live in documents now
+DROP INDEX IF EXISTS idx_trade_licenses_scan_pending;
+ALTER TABLE trade_licenses DROP COLUMN IF EXISTS scan_status;
+ALTER TABLE trade_licenses DROP COLUMN IF EXISTS scan_signature;
+ALTER TABLE trade_licenses DROP COLUMN IF EXISTS scanned_at;
+ALTER TABLE trade_licenses DROP COLUMN IF EXISTS file_size;
+ALTER TABLE trade_licenses DROP COLUMN IF EXISTS sha256;
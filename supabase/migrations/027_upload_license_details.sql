@@ -0,0 +1,5 @@
+-- Resumable uploads of a trade license carry the license's issue date and issuing authority
+-- (its expiry date goes in document_expires_on), which new trade license saves require
+
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS document_issued_on DATE;
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS document_issuing_authority VARCHAR(255);
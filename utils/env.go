@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// IsDevMode reports whether the server runs in development mode.
+// Development mode is enabled with APP_ENV=development (or "dev"/"local").
+func IsDevMode() bool {
+	switch strings.ToLower(os.Getenv("APP_ENV")) {
+	case "development", "dev", "local":
+		return true
+	}
+	return false
+}
+
+// GetEnvInt returns the integer value of an environment variable, or def when unset or invalid
+func GetEnvInt(key string, def int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return def
+}
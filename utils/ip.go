@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ClientIP returns the caller's IP address. Forwarding headers are only trusted when
+// TRUSTED_PROXY names the proxy that sets them, since a client can send any value:
+//   - "vercel" (the default on Vercel): X-Vercel-Forwarded-For, or X-Real-IP
+//   - "forwarded": the rightmost X-Forwarded-For entry, added by a single reverse proxy
+//
+// Otherwise, and when the header is missing, RemoteAddr is used.
+func ClientIP(r *http.Request) string {
+	proxy := strings.ToLower(os.Getenv("TRUSTED_PROXY"))
+	if proxy == "" && os.Getenv("VERCEL") != "" {
+		proxy = "vercel"
+	}
+
+	switch proxy {
+	case "vercel":
+		if forwarded := r.Header.Get("X-Vercel-Forwarded-For"); forwarded != "" {
+			if ip := strings.TrimSpace(strings.Split(forwarded, ",")[0]); ip != "" {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	case "forwarded":
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
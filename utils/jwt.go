@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"os"
-	"strconv"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,39 +14,51 @@ import (
 )
 
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	SessionID uuid.UUID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uuid.UUID, email string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "default-secret-key-change-in-production"
-	}
+// AccessTokenTTL is the lifetime of access tokens (JWT_ACCESS_TOKEN_MINUTES, default 15)
+func AccessTokenTTL() time.Duration {
+	return time.Duration(GetEnvInt("JWT_ACCESS_TOKEN_MINUTES", 15)) * time.Minute
+}
 
-	expiryHours := 24
-	if hoursStr := os.Getenv("JWT_EXPIRY_HOURS"); hoursStr != "" {
-		if hours, err := strconv.Atoi(hoursStr); err == nil {
-			expiryHours = hours
-		}
+// RefreshTokenTTL is the lifetime of refresh tokens (JWT_REFRESH_TOKEN_DAYS, default 30)
+func RefreshTokenTTL() time.Duration {
+	return time.Duration(GetEnvInt("JWT_REFRESH_TOKEN_DAYS", 30)) * 24 * time.Hour
+}
+
+func GenerateJWT(userID uuid.UUID, email, role string, sessionID uuid.UUID) (string, error) {
+	kr, err := getKeyring()
+	if err != nil {
+		return "", err
 	}
 
-	expirationTime := time.Now().Add(time.Duration(expiryHours) * time.Hour)
+	now := time.Now()
+	expirationTime := now.Add(AccessTokenTTL())
 
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    "sme_fin_backend",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
+	token := jwt.NewWithClaims(kr.signing.Method, claims)
+	if kr.signing.ID != "" {
+		token.Header["kid"] = kr.signing.ID
+	}
+	tokenString, err := token.SignedString(kr.signing.Private)
 	if err != nil {
 		return "", err
 	}
@@ -52,17 +67,23 @@ func GenerateJWT(userID uuid.UUID, email string) (string, error) {
 }
 
 func ValidateJWT(tokenString string) (*Claims, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "default-secret-key-change-in-production"
+	kr, err := getKeyring()
+	if err != nil {
+		return nil, err
 	}
 
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Tokens carry the kid of the key they were signed with; HS256 tokens have none
+		kid, _ := token.Header["kid"].(string)
+		key, ok := kr.verify[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, errors.New("invalid signing method")
 		}
-		return []byte(secret), nil
+		return key.Public, nil
 	})
 
 	if err != nil {
@@ -75,3 +96,18 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// GenerateRefreshToken returns an opaque random refresh token
+func GenerateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 digest under which opaque tokens are stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
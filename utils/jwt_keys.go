@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultJWTSecret = "default-secret-key-change-in-production"
+
+// jwtKey is a key tokens can be signed or verified with
+type jwtKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private is the signing key: []byte for HMAC, crypto.Signer for RSA/ECDSA. Nil for verify-only keys.
+	Private interface{}
+	// Public is the verification key: []byte for HMAC, *rsa.PublicKey or *ecdsa.PublicKey otherwise
+	Public interface{}
+}
+
+type jwtKeyring struct {
+	signing *jwtKey
+	verify  map[string]*jwtKey
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	keyring     *jwtKeyring
+	keyringErr  error
+	keyringOnce sync.Once
+)
+
+func getKeyring() (*jwtKeyring, error) {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = loadKeyring()
+	})
+	return keyring, keyringErr
+}
+
+// CheckJWTConfig validates the signing configuration. Outside dev mode it refuses to
+// run HS256 with a missing or default secret, or RS256/ES256 without a private key.
+func CheckJWTConfig() error {
+	_, err := getKeyring()
+	return err
+}
+
+// JWKS returns the public verification keys (the signing key plus any rotated-out keys).
+// HMAC secrets are never published.
+func JWKS() (*JWKSet, error) {
+	kr, err := getKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &JWKSet{Keys: []JWK{}}
+	if jwk, ok := toJWK(kr.signing); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+	for id, key := range kr.verify {
+		if id == kr.signing.ID {
+			continue
+		}
+		if jwk, ok := toJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set, nil
+}
+
+// loadKeyring reads JWT_SIGNING_ALG (HS256, RS256 or ES256), JWT_SECRET for HS256,
+// JWT_PRIVATE_KEY / JWT_PRIVATE_KEY_FILE for RS256/ES256, and JWT_VERIFICATION_KEYS /
+// JWT_VERIFICATION_KEYS_FILE with PEM public keys that are still accepted after rotation.
+func loadKeyring() (*jwtKeyring, error) {
+	alg := strings.ToUpper(os.Getenv("JWT_SIGNING_ALG"))
+	if alg == "" {
+		alg = "HS256"
+	}
+
+	kr := &jwtKeyring{verify: map[string]*jwtKey{}}
+
+	switch alg {
+	case "HS256":
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" || secret == defaultJWTSecret {
+			if !IsDevMode() {
+				return nil, errors.New("JWT_SECRET must be set to a non-default value outside dev mode")
+			}
+			secret = defaultJWTSecret
+		}
+		kr.signing = &jwtKey{Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)}
+	case "RS256", "ES256":
+		pemData, err := readEnvOrFile("JWT_PRIVATE_KEY", "JWT_PRIVATE_KEY_FILE")
+		if err != nil {
+			return nil, err
+		}
+		var signer crypto.Signer
+		if pemData == "" {
+			if !IsDevMode() {
+				return nil, fmt.Errorf("JWT_PRIVATE_KEY or JWT_PRIVATE_KEY_FILE is required for %s", alg)
+			}
+			// Dev convenience: tokens stop validating when the process restarts
+			log.Printf("No JWT private key configured, generating an ephemeral %s key (dev mode)", alg)
+			signer, err = generateKey(alg)
+		} else {
+			signer, err = parsePrivateKey(pemData)
+		}
+		if err != nil {
+			return nil, err
+		}
+		key, err := newAsymmetricKey(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		if key.Method.Alg() != alg {
+			return nil, fmt.Errorf("JWT private key does not match JWT_SIGNING_ALG %s", alg)
+		}
+		key.Private = signer
+		kr.signing = key
+	default:
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q", alg)
+	}
+	kr.verify[kr.signing.ID] = kr.signing
+
+	verifyPEM, err := readEnvOrFile("JWT_VERIFICATION_KEYS", "JWT_VERIFICATION_KEYS_FILE")
+	if err != nil {
+		return nil, err
+	}
+	publicKeys, err := parsePublicKeys(verifyPEM)
+	if err != nil {
+		return nil, err
+	}
+	for _, pub := range publicKeys {
+		key, err := newAsymmetricKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := kr.verify[key.ID]; !exists {
+			kr.verify[key.ID] = key
+		}
+	}
+
+	return kr, nil
+}
+
+func readEnvOrFile(envKey, fileKey string) (string, error) {
+	if value := os.Getenv(envKey); value != "" {
+		// Allow PEMs stored in single-line env vars with escaped newlines
+		return strings.ReplaceAll(value, `\n`, "\n"), nil
+	}
+	if path := os.Getenv(fileKey); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", fileKey, err)
+		}
+		return string(data), nil
+	}
+	return "", nil
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	if alg == "ES256" {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+func parsePrivateKey(pemData string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("JWT private key is not valid PEM")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, errors.New("unsupported JWT private key type")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("failed to parse JWT private key (expected PKCS#8, PKCS#1 or SEC 1)")
+}
+
+func parsePublicKeys(pemData string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	rest := []byte(pemData)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+			keys = append(keys, key)
+			continue
+		}
+		if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+			keys = append(keys, key)
+			continue
+		}
+		return nil, fmt.Errorf("failed to parse JWT verification key (%s block)", block.Type)
+	}
+	return keys, nil
+}
+
+// newAsymmetricKey wraps a public key, deriving its kid from the RFC 7638 thumbprint
+func newAsymmetricKey(pub crypto.PublicKey) (*jwtKey, error) {
+	key := &jwtKey{Public: pub}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported (ES256)")
+		}
+		key.Method = jwt.SigningMethodES256
+	default:
+		return nil, errors.New("unsupported JWT key type")
+	}
+
+	jwk, _ := toJWK(key)
+	var canonical []byte
+	if jwk.Kty == "RSA" {
+		canonical, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	} else {
+		canonical, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	}
+	sum := sha256.Sum256(canonical)
+	key.ID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return key, nil
+}
+
+func toJWK(key *jwtKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA", Kid: key.ID, Use: "sig", Alg: "RS256",
+			N: b64(pub.N.Bytes()),
+			E: b64(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC", Kid: key.ID, Use: "sig", Alg: "ES256", Crv: "P-256",
+			X: b64(pub.X.FillBytes(make([]byte, size))),
+			Y: b64(pub.Y.FillBytes(make([]byte, size))),
+		}, true
+	}
+	return JWK{}, false
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// GenerateOTP returns a cryptographically random 6-digit code
+func GenerateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate OTP: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// HashOTP returns the hex digest stored in place of the plain code.
+// The email is mixed in so equal codes for different users never share a hash,
+// and OTP_HASH_KEY (if set) keys the digest so a leaked table cannot be brute-forced offline.
+func HashOTP(email, otp string) string {
+	message := []byte(strings.ToLower(strings.TrimSpace(email)) + ":" + otp)
+	if key := os.Getenv("OTP_HASH_KEY"); key != "" {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(message)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(message)
+	return hex.EncodeToString(sum[:])
+}
@@ -2,7 +2,10 @@ package utils
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type Response struct {
@@ -15,27 +18,36 @@ type Response struct {
 func SendSuccessResponse(w http.ResponseWriter, message string, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	
+
 	response := Response{
 		Success:    true,
 		Message:    message,
 		StatusCode: statusCode,
 		Data:       data,
 	}
-	
+
 	json.NewEncoder(w).Encode(response)
 }
 
 func SendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	
+
 	response := Response{
 		Success:    false,
 		Message:    message,
 		StatusCode: statusCode,
 	}
-	
+
 	json.NewEncoder(w).Encode(response)
 }
 
+// SendTooManyRequestsResponse sends a 429 error with a Retry-After header (in seconds)
+func SendTooManyRequestsResponse(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	SendErrorResponse(w, message, http.StatusTooManyRequests)
+}